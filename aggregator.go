@@ -1,175 +1,1324 @@
-package main
+package aggregator
 
 import (
+	"context"
+	"crypto/sha1"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
+	"os/signal"
+	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/antchfx/htmlquery"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/cleonty/news-aggregator/server"
+	"github.com/cleonty/news-aggregator/storage"
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/html"
+	"google.golang.org/grpc"
 )
 
-const databseFile = "./news.db"
-const parsingRulesFile = "./rules.json"
+const defaultDatabaseFile = "./news.db"
+const defaultParsingRulesFile = "./rules.json"
+
+// DefaultPort is the HTTP port of the server by default
+const DefaultPort = 8383
+
+const (
+	busyRetries = 5
+	busyBackoff = 50 * time.Millisecond
+)
+
+// storeTimeout bounds the database writes of one update of a source
+const storeTimeout = time.Minute
+
+var errDatabaseBusy = errors.New("database is busy, try again later")
 
 type ExtractRule struct {
 	XPathExpr string `json:"expr"`
+	// Selector is a CSS selector used instead of XPathExpr when present
+	Selector  string `json:"selector,omitempty"`
 	Attribute string `json:"attr,omitempty"`
+	// Alternatives are tried in order when the expression finds nothing, so a
+	// rule survives the markup of a site changing between variants. The
+	// expression may be left empty when alternatives are given.
+	Alternatives []ExtractRule `json:"alternatives,omitempty"`
+	// Transforms clean up the extracted value in order, those of an
+	// alternative run before the ones of the rule
+	Transforms []FieldTransform `json:"transforms,omitempty"`
+	// selectorExpr is the XPath translation of Selector
+	selectorExpr string
+}
+
+// expr returns the XPath expression of the rule
+func (rule *ExtractRule) expr() string {
+	if rule.Selector != "" {
+		return rule.selectorExpr
+	}
+	return rule.XPathExpr
+}
+
+// isEmpty tells whether the rule has neither an expression nor alternatives
+func (rule *ExtractRule) isEmpty() bool {
+	return rule.XPathExpr == "" && rule.Selector == "" && len(rule.Alternatives) == 0
+}
+
+// PairingRule extracts items whose title and link are siblings rather than
+// children of one node. Title and link nodes found under a container are
+// paired by position.
+type PairingRule struct {
+	TitleNodesXPathExpr string `json:"titleNodesExpr"`
+	LinkNodesXPathExpr  string `json:"linkNodesExpr"`
+}
+
+// BasicAuth are the credentials of a source behind HTTP basic authentication
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 type ParsingRule struct {
-	Interval           uint        `json:"intervalMinutes"`
-	URL                string      `json:"url"`
-	NewsNodesXPathExpr string      `json:"newsNodesExpr"`
-	LinkRule           ExtractRule `json:"linkRule"`
-	TitleRule          ExtractRule `json:"titleRule"`
+	// Name identifies the source of the items, the host of URL by default
+	Name string `json:"name,omitempty"`
+	// Enabled false keeps the rule without updating its source
+	Enabled *bool `json:"enabled,omitempty"`
+	// Category is stored with the items of the rule to filter them by
+	Category string `json:"category,omitempty"`
+	// Language is the ISO 639-1 code of the items whose language can not be
+	// detected, such as short titles
+	Language string `json:"language,omitempty"`
+	// Type is either "html", the default, or "rss" for RSS and Atom feeds,
+	// which need neither NewsNodesXPathExpr nor LinkRule and TitleRule. For
+	// "json" documents the expressions of the rule are JSONPath.
+	Type string `json:"type,omitempty"`
+	// Interval is the number of minutes between updates, Schedule is a cron
+	// expression such as "0 7,18 * * mon-fri" in local time used instead
+	Interval uint   `json:"intervalMinutes,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+	// JitterSeconds is the maximal random delay of every update, -jitter by
+	// default, so the sources do not fire at once
+	JitterSeconds      *uint  `json:"jitterSeconds,omitempty"`
+	URL                string `json:"url"`
+	NewsNodesXPathExpr string `json:"newsNodesExpr"`
+	// NewsNodesSelector is a CSS selector used instead of NewsNodesXPathExpr
+	// when present
+	NewsNodesSelector string      `json:"newsNodesSelector,omitempty"`
+	LinkRule          ExtractRule `json:"linkRule"`
+	TitleRule         ExtractRule `json:"titleRule"`
+	// SummaryRule extracts a short description of the item
+	SummaryRule *ExtractRule `json:"summaryRule,omitempty"`
+	// ImageRule extracts the URL of a picture of the item
+	ImageRule *ExtractRule `json:"imageRule,omitempty"`
+	// MetadataRules extract extra named fields stored with each item as JSON
+	MetadataRules map[string]ExtractRule `json:"metadataRules,omitempty"`
+	// DateRule extracts the publication date parsed with one of DateFormat layouts
+	DateRule   *ExtractRule `json:"dateRule,omitempty"`
+	DateFormat DateLayouts  `json:"dateFormat,omitempty"`
+	// Transforms are names of registered transforms applied to every item
+	Transforms []string `json:"transforms,omitempty"`
+	// StripParams are query parameters removed from the links, a trailing *
+	// matches every parameter with the prefix, e.g. "utm_*"
+	StripParams []string `json:"stripParams,omitempty"`
+	// VerifyLinks skips items whose links respond with 4xx or 5xx to HEAD requests
+	VerifyLinks bool `json:"verifyLinks,omitempty"`
+	// UpdateOnChange updates the title of an already stored link when it
+	// changes, the previous titles are kept in the history of the item
+	UpdateOnChange bool `json:"updateOnChange,omitempty"`
+	// Pairing makes NewsNodesXPathExpr select containers of paired title and
+	// link nodes, TitleRule and LinkRule are then applied to these nodes
+	Pairing *PairingRule `json:"pairing,omitempty"`
+	// Method is the HTTP method of the request, GET by default. Body is sent
+	// with ContentType, application/json by default.
+	Method      string `json:"method,omitempty"`
+	Body        string `json:"body,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	// DetailRules extract metadata fields from the page of every item, up to
+	// DetailConcurrency pages are fetched at once
+	DetailRules       map[string]ExtractRule `json:"detailRules,omitempty"`
+	DetailConcurrency int                    `json:"detailConcurrency,omitempty"`
+	// Render is "chromium" to load the page in a headless browser running its
+	// scripts, for sites that build their headlines client-side
+	Render string `json:"render,omitempty"`
+	// URLPattern is a regular expression the URLs of a sitemap rule must
+	// match, MaxAgeHours skips URLs modified longer ago
+	URLPattern  string `json:"urlPattern,omitempty"`
+	MaxAgeHours uint   `json:"maxAgeHours,omitempty"`
+	// PageMetadata fetches the pages of new items lacking a title, a summary
+	// or an image and takes them from their OpenGraph tags or JSON-LD, so
+	// titleRule may be left empty
+	PageMetadata bool `json:"pageMetadata,omitempty"`
+	// FetchContent stores the article body found on the page of every item,
+	// by ContentRule when set or else by the text density of the page
+	FetchContent bool         `json:"fetchContent,omitempty"`
+	ContentRule  *ExtractRule `json:"contentRule,omitempty"`
+	// RequestDelay is the minimal delay in milliseconds between requests to
+	// one host, including detail pages, 250 by default and at least -minRequestDelay
+	RequestDelay *uint `json:"requestDelayMs,omitempty"`
+	// TimeoutSeconds limits every request of the rule, -fetchTimeout by default.
+	// UserAgent replaces the default browser-like User-Agent header.
+	TimeoutSeconds uint   `json:"timeoutSeconds,omitempty"`
+	UserAgent      string `json:"userAgent,omitempty"`
+	// Headers, Cookies and BasicAuth are sent with the requests of the rule
+	// to the host of its url, for sources requiring a login or a token
+	Headers   map[string]string `json:"headers,omitempty"`
+	Cookies   map[string]string `json:"cookies,omitempty"`
+	BasicAuth *BasicAuth        `json:"basicAuth,omitempty"`
+	// Proxy is the URL of the HTTP or SOCKS5 proxy of the requests of the
+	// rule with its credentials, or "direct" to bypass -proxy
+	Proxy string `json:"proxy,omitempty"`
+	// IgnoreRobots fetches the pages of the rule disallowed by robots.txt,
+	// for sites the operator owns or may scrape anyway
+	IgnoreRobots bool `json:"ignoreRobots,omitempty"`
+	// NextPageRule extracts the link to older items of an html page, the
+	// first update of a new source follows it to store up to MaxPages pages,
+	// 10 by default, later updates only fetch the first page
+	NextPageRule *ExtractRule `json:"nextPageRule,omitempty"`
+	MaxPages     uint         `json:"maxPages,omitempty"`
+	// MaxRetries is how many times a request failing with a network error or
+	// a 5xx response is retried, 3 by default
+	MaxRetries *uint `json:"maxRetries,omitempty"`
+	// IncludeKeywords keep only items whose titles contain one of them and
+	// ExcludeKeywords drop items whose titles contain one of them, ignoring case
+	IncludeKeywords []string `json:"includeKeywords,omitempty"`
+	ExcludeKeywords []string `json:"excludeKeywords,omitempty"`
+	// IncludePatterns keep only items whose titles or summaries match one of
+	// them and ExcludePatterns drop items matching one of them. A pattern is a
+	// substring or a /regular expression/, both ignoring case.
+	IncludePatterns []string `json:"includePatterns,omitempty"`
+	ExcludePatterns []string `json:"excludePatterns,omitempty"`
+	// RetentionDays and MaxItems limit the age and the number of the stored
+	// items of the source in addition to the global limits
+	RetentionDays uint `json:"retentionDays,omitempty"`
+	MaxItems      uint `json:"maxItems,omitempty"`
+
+	include         *keywordMatcher
+	exclude         *keywordMatcher
+	includePatterns *keywordMatcher
+	excludePatterns *keywordMatcher
+	cron            *cronSchedule
+	// urlPattern is the compiled URLPattern
+	urlPattern *regexp.Regexp
+	// newsNodesSelectorExpr is the XPath translation of NewsNodesSelector
+	newsNodesSelectorExpr string
+}
+
+// newsNodesExpr returns the XPath expression of the news nodes
+func (rule *ParsingRule) newsNodesExpr() string {
+	if rule.NewsNodesSelector != "" {
+		return rule.newsNodesSelectorExpr
+	}
+	return rule.NewsNodesXPathExpr
+}
+
+// Version returns a hash of the rule fields affecting extraction, so items
+// scraped before and after a rule change can be told apart
+func (rule *ParsingRule) Version() string {
+	data, _ := json.Marshal(struct {
+		NewsNodesXPathExpr string
+		LinkRule           ExtractRule
+		TitleRule          ExtractRule
+		MetadataRules      map[string]ExtractRule
+		DateRule           *ExtractRule
+		DateFormat         DateLayouts
+		Transforms         []string
+		Pairing            *PairingRule
+		DetailRules        map[string]ExtractRule
+		// omitted when absent so versions of older rules stay the same
+		SummaryRule *ExtractRule `json:",omitempty"`
+		ImageRule   *ExtractRule `json:",omitempty"`
+		StripParams []string     `json:",omitempty"`
+		Render      string       `json:",omitempty"`
+		// NewsNodesSelector is a selector of the news nodes
+		NewsNodesSelector string `json:",omitempty"`
+		PageMetadata      bool   `json:",omitempty"`
+	}{rule.NewsNodesXPathExpr, rule.LinkRule, rule.TitleRule, rule.MetadataRules, rule.DateRule, rule.DateFormat,
+		rule.Transforms, rule.Pairing, rule.DetailRules, rule.SummaryRule, rule.ImageRule, rule.StripParams, rule.Render,
+		rule.NewsNodesSelector, rule.PageMetadata})
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// enabled tells whether the source of the rule is updated
+func (rule *ParsingRule) enabled() bool {
+	return rule.Enabled == nil || *rule.Enabled
+}
+
+// clone returns a deep copy of the rule without its compiled state, which
+// prepare builds again. A live rule is read by its updater, so a change of it
+// is made on a clone.
+func (rule *ParsingRule) clone() (*ParsingRule, error) {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return nil, err
+	}
+	clone := new(ParsingRule)
+	if err := json.Unmarshal(data, clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// Source returns the name stored with the items of the rule
+func (rule *ParsingRule) Source() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	if u, err := url.Parse(rule.URL); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	return rule.URL
+}
+
+// ID returns a short hash of the URL of the rule identifying its source in
+// the API
+func (rule *ParsingRule) ID() string {
+	sum := sha1.Sum([]byte(rule.URL))
+	return hex.EncodeToString(sum[:6])
 }
 
 // NewsItem represnts a news
 type NewsItem struct {
-	Link  string `json:"link"`
-	Title string `json:"title"`
+	ID int64 `json:"id,omitempty"`
+	// StableID is derived from the link so it is the same in every database
+	StableID    string            `json:"stable_id,omitempty"`
+	Link        string            `json:"link"`
+	Title       string            `json:"title"`
+	Source      string            `json:"source,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Language    string            `json:"language,omitempty"`
+	Summary     string            `json:"summary,omitempty"`
+	Image       string            `json:"image,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	RuleVersion string            `json:"ruleVersion,omitempty"`
+	Published   *time.Time        `json:"published,omitempty"`
+	// Timestamp is when the item was first seen
+	Timestamp   time.Time `json:"timestamp"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	// Seq is a global insertion order number
+	Seq int64 `json:"seq"`
+	// Content is the article body, it is only read for a single item
+	Content string `json:"content,omitempty"`
+	// Read, Starred and Hidden are the reading state set by the reader
+	Read    bool `json:"read,omitempty"`
+	Starred bool `json:"starred,omitempty"`
+	Hidden  bool `json:"hidden,omitempty"`
+	// ClusterSize and ClusterLinks are set when the items are grouped by
+	// story, the links are of all the matching items of the cluster
+	ClusterSize  int      `json:"clusterSize,omitempty"`
+	ClusterLinks []string `json:"clusterLinks,omitempty"`
+	// TitleHistory are the previous titles, newest first, it is only read for
+	// a single item
+	TitleHistory []TitleChange `json:"titleHistory,omitempty"`
+}
+
+// TitleChange is a title an item had until it changed
+type TitleChange struct {
+	Title   string    `json:"title"`
+	Changed time.Time `json:"changed"`
+}
+
+// NewsFilter selects news items returned by getNews
+type NewsFilter struct {
+	// Query is a search of words, "quoted phrases", -excluded terms and OR
+	// alternatives matched ignoring case
+	Query       string `json:"q"`
+	MetaKey     string `json:"metaKey,omitempty"`
+	MetaValue   string `json:"metaValue,omitempty"`
+	RuleVersion string `json:"ruleVersion,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Language    string `json:"lang,omitempty"`
+	// From and To bound the publication time of the items, both inclusive,
+	// items without a parsed date by the time they were first seen
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// Since selects items stored after the one with this seq, a client polling
+	// for new items passes the highest seq it has got
+	Since int64 `json:"since,omitempty"`
+	// Limit is the maximum number of returned items, 0 means no limit
+	Limit int `json:"limit,omitempty"`
+	// Offset is the number of skipped items, it is used only with a limit
+	Offset int `json:"offset,omitempty"`
+	// OrderBy is either empty for the insertion order, "updated", "published"
+	// or "relevance"
+	OrderBy string `json:"orderBy,omitempty"`
+	// Unread and Starred select items by their state, hidden items are
+	// excluded unless Hidden selects only them
+	Unread  bool `json:"unread,omitempty"`
+	Starred bool `json:"starred,omitempty"`
+	Hidden  bool `json:"hidden,omitempty"`
+	// Group returns one item per cluster of near-duplicate stories
+	Group bool `json:"group,omitempty"`
+	// Edited selects the items whose titles changed after they were stored,
+	// with orderBy "updated" the recently edited come first
+	Edited bool `json:"edited,omitempty"`
+	// userID is the user whose state and subscriptions apply, 0 without users
+	userID int64
+	// clusters selects the items of these clusters
+	clusters []int64
+}
+
+// NewsPage is a page of news items with the total number of matching items
+type NewsPage struct {
+	Total  int        `json:"total"`
+	Limit  int        `json:"limit"`
+	Offset int        `json:"offset"`
+	Items  []NewsItem `json:"items"`
+}
+
+// Config holds the settings of the application
+type Config struct {
+	// DatabaseFile and RulesFile are the paths of the SQLite database and
+	// the parsing rules
+	DatabaseFile string
+	RulesFile    string
+	// CompactRetention enables the compact mode when positive: items older
+	// than the retention are deleted leaving only a hash of their link
+	CompactRetention time.Duration
+	// RetentionDays deletes items older than this many days and MaxItems the
+	// oldest items beyond this number when positive
+	RetentionDays uint
+	MaxItems      uint
+	// MaxErrorAge is how long the last fetch error of a source is remembered
+	MaxErrorAge time.Duration
+	// Pragmas are executed on every database connection
+	Pragmas []string
+	// IngestLog is the verbosity of the per cycle ingestion summary
+	IngestLog string
+	// WaitFor is a host:port that must be reachable before sources are polled
+	WaitFor        string
+	WaitForTimeout time.Duration
+	// ForceHTTPS and StripWWW make http/https and www/non-www links equal
+	ForceHTTPS bool
+	StripWWW   bool
+	// StripParams are the tracking query parameters removed from all links
+	StripParams []string
+	// StatsWindow is the rolling window of the deduplication statistics
+	StatsWindow time.Duration
+	// BackfillSpacing staggers timestamps of the first items of a new source
+	BackfillSpacing time.Duration
+	// ExcludeKeywords drop items of every source whose titles contain them
+	ExcludeKeywords   []string
+	ExcludeWholeWords bool
+	// WatchRules is how often the rules file is checked for changes
+	WatchRules time.Duration
+	// MaxConcurrentFetches is the number of workers updating sources, so at
+	// most as many are fetched at once
+	MaxConcurrentFetches int
+	// JobTimeout bounds one update of a source including its detail pages
+	JobTimeout time.Duration
+	// ChromiumPath is the browser rendering the pages of rules with render,
+	// up to RenderConcurrency run at once for at most RenderTimeout each
+	ChromiumPath      string
+	RenderConcurrency int
+	RenderTimeout     time.Duration
+	// FetchTimeout is the timeout of requests of rules without their own
+	FetchTimeout time.Duration
+	// TelegramToken is the bot token of Telegram alerts, the SMTP settings
+	// are used by email alerts
+	TelegramToken string
+	// TelegramBot answers the commands sent to the bot, from the chats of
+	// TelegramChats or any chat when it is empty
+	TelegramBot   bool
+	TelegramChats []string
+	SMTPAddr      string
+	SMTPFrom      string
+	SMTPUser      string
+	SMTPPassword  string
+	// QuietHours is a daily window without alert deliveries, the alerts of
+	// the window are dropped unless QuietDigest sends them together after it
+	QuietHours  QuietHours
+	QuietDigest bool
+	// MinRequestDelay is the minimal delay between requests to one host
+	MinRequestDelay time.Duration
+	// Proxy is the HTTP or SOCKS5 proxy of rules without their own, the
+	// proxy of the environment when empty
+	Proxy string
+	// IgnoreRobots sends requests disallowed by the robots.txt of their host
+	// and ignores its Crawl-delay
+	IgnoreRobots bool
+	// Jitter is the maximal random delay of the updates of rules without
+	// their own
+	Jitter time.Duration
+	// NoBrowser disables opening the application in a browser on start
+	NoBrowser bool
+	// RestoreFile is a backup replacing the database when it is opened
+	RestoreFile string
+	// SnapshotRetention is how long the snapshots of pages giving no items
+	// are kept, 0 keeps them until the next snapshot of the source
+	SnapshotRetention time.Duration
+	// OTLPEndpoint is the host:port of the OTLP/gRPC collector receiving the
+	// traces of updates and requests, OTLPInsecure sends them without TLS
+	OTLPEndpoint string
+	OTLPInsecure bool
+	// LogRequests logs every request of the HTTP API with its status and
+	// duration
+	LogRequests bool
+	// APIKey protects the search and admin endpoints when set, it is the key
+	// of an administrator when there are users
+	APIKey string
+	// ReadAPIKeys are keys allowed to read the news but to change nothing,
+	// with PublicRead no credentials are needed to read
+	ReadAPIKeys []string
+	PublicRead  bool
+	// RateLimit is the number of API requests per second allowed to a client
+	// with bursts of RateBurst, 0 disables the limit. With TrustProxy the
+	// client is the first address of the X-Forwarded-For header.
+	RateLimit  float64
+	RateBurst  int
+	TrustProxy bool
+	// ProtectStatic requires the API key for the static files as well
+	ProtectStatic bool
+	// AllowOrigins are the origins allowed to call the API from a browser, "*"
+	// allows any, with AllowMethods and AllowHeaders in preflight requests
+	AllowOrigins []string
+	AllowMethods []string
+	AllowHeaders []string
+	// CompressContent and CompressSummary gzip the article bodies and the
+	// summaries stored from now on
+	CompressContent bool
+	CompressSummary bool
+	// Host is the address listened on, all interfaces when empty
+	Host string
+	// TLSCert and TLSKey are the files of the certificate served over HTTPS,
+	// AutocertHosts are the hosts of certificates obtained from Let's Encrypt
+	// instead and cached in AutocertCache
+	TLSCert       string
+	TLSKey        string
+	AutocertHosts []string
+	AutocertCache string
+	// HTTPRedirectPort is the port of a plain HTTP listener redirecting to
+	// HTTPS, 0 disables it
+	HTTPRedirectPort uint
+	// GRPCPort is the port of the gRPC API, 0 disables it
+	GRPCPort uint
+	// ImageCache is the directory the images of the items are downloaded to,
+	// they are not downloaded when empty
+	ImageCache string
+	// StaticDir is the directory of the static files served under /, the
+	// files embedded in the binary when empty
+	StaticDir string
+}
+
+// DefaultConfig returns the settings of the command line without flags
+func DefaultConfig() Config {
+	return Config{
+		DatabaseFile:         defaultDatabaseFile,
+		RulesFile:            defaultParsingRulesFile,
+		AutocertCache:        defaultAutocertCache,
+		SnapshotRetention:    7 * 24 * time.Hour,
+		MaxErrorAge:          24 * time.Hour,
+		IngestLog:            ingestLogAll,
+		WaitForTimeout:       time.Minute,
+		StripParams:          strings.Split(defaultTrackingParams, ","),
+		StatsWindow:          24 * time.Hour,
+		BackfillSpacing:      time.Minute,
+		ExcludeWholeWords:    true,
+		RateBurst:            20,
+		AllowMethods:         strings.Split(server.DefaultAllowMethods, ", "),
+		AllowHeaders:         strings.Split(server.DefaultAllowHeaders, ", "),
+		WatchRules:           10 * time.Second,
+		FetchTimeout:         defaultFetchTimeout,
+		Jitter:               defaultJitter,
+		MaxConcurrentFetches: 8,
+		RenderConcurrency:    2,
+		RenderTimeout:        defaultRenderTimeout,
+		JobTimeout:           defaultJobTimeout,
+	}
+}
+
+// Validate checks the settings that depend on each other
+func (config *Config) Validate() error {
+	switch config.IngestLog {
+	case ingestLogAll, ingestLogChanges, ingestLogNone:
+	default:
+		return fmt.Errorf("invalid IngestLog %q", config.IngestLog)
+	}
+	if (config.TLSCert == "") != (config.TLSKey == "") {
+		return errors.New("TLSCert and TLSKey must be given together")
+	}
+	if config.TLSCert != "" && len(config.AutocertHosts) > 0 {
+		return errors.New("TLSCert and AutocertHosts are exclusive")
+	}
+	if config.HTTPRedirectPort > 0 && config.TLSCert == "" && len(config.AutocertHosts) == 0 {
+		return errors.New("HTTPRedirectPort needs TLSCert or AutocertHosts")
+	}
+	if config.Proxy != "" && config.Proxy != proxyDirect {
+		if _, err := parseProxy(config.Proxy); err != nil {
+			return fmt.Errorf("invalid Proxy: %v", err)
+		}
+	}
+	if config.TelegramBot && config.TelegramToken == "" {
+		return errors.New("TelegramBot needs TelegramToken")
+	}
+	if config.RenderConcurrency < 1 {
+		return errors.New("RenderConcurrency must be positive")
+	}
+	if config.RateLimit < 0 || (config.RateLimit > 0 && config.RateBurst < 1) {
+		return errors.New("RateLimit must not be negative and RateBurst must be positive")
+	}
+	if config.MaxConcurrentFetches < 1 {
+		return errors.New("MaxConcurrentFetches must be positive")
+	}
+	return nil
 }
 
 type NewsApp struct {
-	db           *sql.DB
-	server       *http.Server
+	config Config
+	db     *sql.DB
+	server *http.Server
+	// redirect is the plain HTTP server of -httpRedirectPort
+	redirect *http.Server
+	// grpc serves the gRPC API on -grpcPort
+	grpc         *grpc.Server
+	mu           sync.Mutex
 	parsingRules []*ParsingRule
-	port         uint
+	// ctx is canceled on shutdown, the scheduler starts the updates of the
+	// rules
+	ctx       context.Context
+	scheduler ruleScheduler
+	// background counts the goroutines writing to the database
+	background sync.WaitGroup
+	// pool runs the updates started by the scheduler, renders holds a slot
+	// for every running browser
+	pool      *fetchPool
+	renders   chan struct{}
+	statuses  sourceStatuses
+	links     linkVerifier
+	dedup     dedupStats
+	metrics   metrics
+	blocklist *keywordMatcher
+	hosts     hostLimiter
+	// robotsCache holds the robots.txt of the hosts requested
+	robotsCache robotsCache
+	// proxies are the transports of the proxies of the rules
+	proxies proxyTransports
+	// client sends the requests of the rules
+	client *http.Client
+	// validators are the ETag and Last-Modified headers of the rule pages
+	validators pageValidators
+	// fts is set when items are searched with the full-text index
+	fts     bool
+	reindex reindexState
+	pruned  pruneCounter
+	hub     newsHub
+	alerts  alertSet
+	// hasUsers is set when requests need to be authenticated by a user
+	hasUsers atomic.Bool
+	port     uint
 }
 
 func (app *NewsApp) readParsingRules() error {
-	data, err := ioutil.ReadFile(parsingRulesFile)
+	rules, err := loadParsingRules(app.config.RulesFile)
 	if err != nil {
 		return err
 	}
-	if err = json.Unmarshal(data, &app.parsingRules); err != nil {
-		return fmt.Errorf("error while reading parsing rules: %v", err)
+	app.parsingRules = rules
+	return nil
+}
+
+func loadParsingRules(filename string) ([]*ParsingRule, error) {
+	var rules []*ParsingRule
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error while reading parsing rules: %v", err)
+	}
+	if err = prepareParsingRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// prepareParsingRules validates the rules and compiles their keywords,
+// selectors and schedules
+func prepareParsingRules(rules []*ParsingRule) error {
+	if err := validateParsingRules(rules); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := rule.prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareChangedRules validates the rules replacing the live ones and
+// compiles only the rules that are not live yet, the updaters keep reading
+// the live rules meanwhile
+func (app *NewsApp) prepareChangedRules(rules []*ParsingRule) error {
+	if err := validateParsingRules(rules); err != nil {
+		return err
+	}
+	live := make(map[*ParsingRule]bool, len(app.parsingRules))
+	for _, rule := range app.parsingRules {
+		live[rule] = true
+	}
+	for _, rule := range rules {
+		if live[rule] {
+			continue
+		}
+		if err := rule.prepare(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (app *NewsApp) loadNewsList(rule *ParsingRule) ([]NewsItem, error) {
+// prepare compiles the keywords, selectors, transforms and schedule of a
+// validated rule
+func (rule *ParsingRule) prepare() error {
+	if err := rule.compileKeywords(); err != nil {
+		return fmt.Errorf("error compiling keywords of %s: %v", rule.URL, err)
+	}
+	if err := rule.compileSelectors(); err != nil {
+		return fmt.Errorf("error compiling selectors of %s: %v", rule.URL, err)
+	}
+	if err := rule.compileTransforms(); err != nil {
+		return fmt.Errorf("error compiling transforms of %s: %v", rule.URL, err)
+	}
+	if err := rule.compileURLPattern(); err != nil {
+		return fmt.Errorf("invalid urlPattern of %s: %v", rule.URL, err)
+	}
+	rule.cron = nil
+	if rule.Schedule != "" {
+		schedule, err := parseCron(rule.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid schedule of %s: %v", rule.URL, err)
+		}
+		rule.cron = schedule
+	}
+	return nil
+}
+
+func (app *NewsApp) loadNewsList(ctx context.Context, rule *ParsingRule, stats *ingestStats) ([]NewsItem, error) {
+	var extracted []NewsItem
+	var err error
+	switch rule.Type {
+	case "", ruleTypeHTML:
+		extracted, err = app.loadPageNews(ctx, rule, stats)
+	case ruleTypeRSS:
+		extracted, err = app.loadFeedNews(ctx, rule, stats)
+	case ruleTypeSitemap:
+		extracted, err = app.loadSitemapNews(ctx, rule, stats)
+	case ruleTypeJSON:
+		extracted, err = app.loadJSONNews(ctx, rule, stats)
+	default:
+		err = fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return app.completeNews(ctx, rule, extracted, stats)
+}
+
+// completeNews verifies the links of the extracted items and fetches their
+// detail pages as the rule asks
+func (app *NewsApp) completeNews(ctx context.Context, rule *ParsingRule, extracted []NewsItem, stats *ingestStats) ([]NewsItem, error) {
 	var items []NewsItem
-	doc, err := htmlquery.LoadURL(rule.URL)
+	for _, item := range extracted {
+		if rule.VerifyLinks && !app.links.isAlive(item.Link) {
+			stats.skippedFiltered++
+			continue
+		}
+		items = append(items, item)
+	}
+	var untitled map[string]bool
+	if rule.PageMetadata {
+		untitled = make(map[string]bool)
+		for _, item := range items {
+			if item.Title == "" {
+				untitled[item.Link] = true
+			}
+		}
+	}
+	if len(rule.DetailRules) > 0 || rule.FetchContent || rule.PageMetadata {
+		app.fetchDetails(ctx, rule, items, stats)
+	}
+	if len(untitled) > 0 {
+		return app.filterPageTitled(rule, items, untitled, stats)
+	}
+	return items, nil
+}
+
+// loadPageNews requests the page of the rule and extracts its items
+func (app *NewsApp) loadPageNews(ctx context.Context, rule *ParsingRule, stats *ingestStats) ([]NewsItem, error) {
+	doc, err := app.fetchDocument(ctx, rule)
 	if err != nil {
 		return nil, err
 	}
-	for _, node := range htmlquery.Find(doc, rule.NewsNodesXPathExpr) {
-		link := extractEntity(node, &rule.LinkRule)
-		title := extractEntity(node, &rule.TitleRule)
-		link, err = convertToAbsURL(rule.URL, link)
+	app.updateSiteTitle(rule.URL, siteTitle(doc))
+	if rule.NextPageRule != nil {
+		stats.nextPage = nextPageURL(doc, rule, rule.URL)
+	}
+	start := time.Now()
+	_, span := tracer.Start(ctx, "extract", ruleAttributes(rule))
+	items, err := app.extractNews(rule, doc, stats)
+	span.SetAttributes(attribute.Int("items", len(items)))
+	endSpan(span, err)
+	stats.parseTime = time.Since(start)
+	if err == nil {
+		if reason := snapshotReason(items, stats); reason != "" {
+			app.saveSnapshot(rule, doc, reason)
+		}
+	}
+	return items, err
+}
+
+// extractNews extracts the items from a page of the rule without any network
+// requests or database writes
+func (app *NewsApp) extractNews(rule *ParsingRule, doc *html.Node, stats *ingestStats) ([]NewsItem, error) {
+	return app.observeNews(rule, doc, stats, nil)
+}
+
+// observeNews extracts the items like extractNews and, unless observe is nil,
+// calls it for every news node with the extracted link and title and the
+// reason the node was skipped
+func (app *NewsApp) observeNews(rule *ParsingRule, doc *html.Node, stats *ingestStats,
+	observe func(nodes newsNodes, link, title, skipped string)) (items []NewsItem, err error) {
+	defer recoverXPathPanic(rule, &err)
+	if observe == nil {
+		observe = func(newsNodes, string, string, string) {}
+	}
+	version := rule.Version()
+	source := rule.Source()
+	base := documentBase(doc, rule.URL)
+	dates := newDateStats()
+	for _, nodes := range findNewsNodes(doc, rule) {
+		stats.matched++
+		node := nodes.title
+		link := strings.TrimSpace(extractEntity(nodes.link, &rule.LinkRule))
+		title := collapseSpace(extractEntity(nodes.title, &rule.TitleRule))
+		// with pageMetadata the title may still be found on the page of the item
+		if link == "" || (title == "" && !rule.PageMetadata) {
+			stats.skippedEmpty++
+			observe(nodes, link, title, skipReasonEmpty)
+			continue
+		}
+		link, err = convertToAbsURL(base, link)
+		if err != nil {
+			return nil, fmt.Errorf("error converting link url %s to absolute url using base url %s: %v", link, base, err)
+		}
+		link, err = app.normalizeURL(link)
 		if err != nil {
-			return nil, fmt.Errorf("error converting link url %s to absolute url using base url %s: %v", link, rule.URL, err)
+			return nil, fmt.Errorf("error normalizing link url %s: %v", link, err)
 		}
 		item := NewsItem{
-			Link:  link,
-			Title: title,
+			Link:        link,
+			Title:       title,
+			Source:      source,
+			Category:    rule.Category,
+			RuleVersion: version,
 		}
-		items = append(items, item)
+		if len(rule.MetadataRules) > 0 {
+			item.Metadata = make(map[string]string)
+			for name, metadataRule := range rule.MetadataRules {
+				item.Metadata[name] = extractEntity(node, &metadataRule)
+			}
+		}
+		if rule.SummaryRule != nil {
+			item.Summary = extractValue(node, rule.SummaryRule)
+		}
+		if rule.ImageRule != nil {
+			if item.Image, err = absoluteImageURL(base, extractValue(node, rule.ImageRule)); err != nil {
+				return nil, err
+			}
+		}
+		if rule.DateRule != nil {
+			item.Published = dates.parse(extractEntity(node, rule.DateRule), rule.DateFormat)
+		}
+		if title == "" {
+			// filtered by the title from the page
+			observe(nodes, link, title, "")
+			items = append(items, item)
+			continue
+		}
+		transformed, keep, err := app.filterItem(&item, rule)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			stats.skippedFiltered++
+			observe(nodes, link, title, skipReasonFiltered)
+			continue
+		}
+		observe(nodes, link, title, "")
+		items = append(items, *transformed)
+	}
+	if rule.DateRule != nil {
+		dates.log(rule.URL)
 	}
 	return items, nil
 }
 
+// filterItem applies the transforms and the keywords of the rule and the
+// blocklist, it returns false when the item is dropped
+func (app *NewsApp) filterItem(item *NewsItem, rule *ParsingRule) (*NewsItem, bool, error) {
+	if len(rule.StripParams) > 0 {
+		item.Link = stripQueryParams(item.Link, rule.StripParams)
+	}
+	transformed, keep, err := applyTransforms(item, rule.Transforms)
+	if err != nil || !keep {
+		return nil, false, err
+	}
+	if !rule.keepItem(transformed) {
+		return nil, false, nil
+	}
+	return transformed, !app.blocklist.matches(transformed.Title), nil
+}
+
+// newsNodes are the nodes the title and the link of an item are extracted from
+type newsNodes struct {
+	title *html.Node
+	link  *html.Node
+}
+
+func findNewsNodes(doc *html.Node, rule *ParsingRule) []newsNodes {
+	var result []newsNodes
+	for _, node := range find(doc, rule.newsNodesExpr()) {
+		if rule.Pairing == nil {
+			result = append(result, newsNodes{title: node, link: node})
+			continue
+		}
+		titles := find(node, rule.Pairing.TitleNodesXPathExpr)
+		links := find(node, rule.Pairing.LinkNodesXPathExpr)
+		if len(titles) != len(links) {
+			slog.Warn("pairing rule found different numbers of titles and links, extra nodes are ignored", "source", rule.URL, "titles", len(titles), "links", len(links))
+		}
+		for i := 0; i < len(titles) && i < len(links); i++ {
+			result = append(result, newsNodes{title: titles[i], link: links[i]})
+		}
+	}
+	return result
+}
+
 func (app *NewsApp) searchHandler(w http.ResponseWriter, r *http.Request) {
+	if id := strings.TrimPrefix(r.URL.Path, "/news/"); id != "" {
+		if id, state, ok := strings.Cut(id, "/"); ok {
+			app.itemStateHandler(w, r, id, state)
+			return
+		}
+		app.itemHandler(w, r, id)
+		return
+	}
 	if err := r.ParseForm(); err != nil {
-		log.Println(err)
+		slog.Warn("unable to parse search request", "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	query := r.Form.Get("q")
-	items, err := app.getNews(query)
+	filter, err := newsFilterFromForm(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Limit, filter.Offset, err = paginationFromForm(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	data, err := json.MarshalIndent(items, "", "")
+	items, err := app.getNews(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
-	w.Header().Set("Content-type", "application/json")
-	fmt.Fprintf(w, "%s\n", data)
+	total, err := app.countNews(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	writeNews(w, r, NewsPage{Total: total, Limit: filter.Limit, Offset: filter.Offset, Items: items})
 }
 
-func (app *NewsApp) updateNewsPeriodically(rule *ParsingRule) {
-	app.updateNews(rule)
-	ticker := time.NewTicker(time.Duration(rule.Interval) * time.Minute)
-	for {
-		select {
-		case <-ticker.C:
-			app.updateNews(rule)
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+	// maxBulkQueries is the number of queries of one bulk search, at most
+	// bulkSearchConcurrency of them run at once
+	maxBulkQueries        = 20
+	bulkSearchConcurrency = 4
+)
+
+// paginationFromForm reads limit and offset of the search, the limit defaults
+// to defaultSearchLimit and is capped at maxSearchLimit
+func paginationFromForm(r *http.Request) (limit, offset int, err error) {
+	limit = defaultSearchLimit
+	if value := r.Form.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("limit must be a positive number")
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
 		}
 	}
+	if value := r.Form.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative number")
+		}
+	}
+	return limit, offset, nil
 }
 
-func (app *NewsApp) updateNews(rule *ParsingRule) {
-	items, err := app.loadNewsList(rule)
-	if err != nil {
-		log.Fatal(err)
+// newsFilterFromForm reads the filter from the parsed query parameters
+func newsFilterFromForm(r *http.Request) (NewsFilter, error) {
+	filter := NewsFilter{
+		Query:       r.Form.Get("q"),
+		MetaKey:     r.Form.Get("metaKey"),
+		MetaValue:   r.Form.Get("metaValue"),
+		RuleVersion: r.Form.Get("ruleVersion"),
+		Source:      r.Form.Get("source"),
+		Category:    r.Form.Get("category"),
+		Language:    r.Form.Get("lang"),
+		OrderBy:     r.Form.Get("orderBy"),
+		userID:      requestUserID(r),
 	}
-	for _, item := range items {
-		err = app.insertNewsItem(&item)
+	for _, state := range []struct {
+		name  string
+		value *bool
+	}{{"unread", &filter.Unread}, {"starred", &filter.Starred}, {"hidden", &filter.Hidden}, {"group", &filter.Group}, {"edited", &filter.Edited}} {
+		if value := r.Form.Get(state.name); value != "" {
+			set, err := strconv.ParseBool(value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be 1 or 0", state.name)
+			}
+			*state.value = set
+		}
+	}
+	if value := r.Form.Get("since"); value != "" {
+		var err error
+		if filter.Since, err = strconv.ParseInt(value, 10, 64); err != nil || filter.Since < 0 {
+			return filter, fmt.Errorf("since must be a non-negative seq")
+		}
+	}
+	for _, bound := range []struct {
+		name  string
+		value **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := r.Form.Get(bound.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC3339 time such as 2006-01-02T15:04:05Z", bound.name)
+			}
+			*bound.value = &t
+		}
+	}
+	return filter, filter.validate()
+}
+
+// validate checks the fields of a filter that the query builder can not
+// handle, the limit and the offset are checked by the callers
+func (filter *NewsFilter) validate() error {
+	if _, ok := newsOrders[filter.OrderBy]; !ok {
+		return fmt.Errorf("unknown orderBy %q", filter.OrderBy)
+	}
+	if filter.Since < 0 {
+		return fmt.Errorf("since must be a non-negative seq")
+	}
+	// the JSON path of SQLite has no escapes for a quote in a key
+	if strings.Contains(filter.MetaKey, `"`) {
+		return fmt.Errorf("metaKey must not contain a double quote")
+	}
+	if filter.From != nil && filter.To != nil && filter.From.After(*filter.To) {
+		return fmt.Errorf("from must not be after to")
+	}
+	return nil
+}
+
+// bulkSearchHandler runs the queries of a JSON array, up to maxBulkQueries,
+// and returns their results in the same order. The limits of the queries
+// default to defaultSearchLimit and are capped at maxSearchLimit.
+func (app *NewsApp) bulkSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var queries []NewsFilter
+	if err := json.NewDecoder(r.Body).Decode(&queries); err != nil {
+		http.Error(w, fmt.Sprintf("invalid search request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(queries) > maxBulkQueries {
+		http.Error(w, fmt.Sprintf("at most %d queries are allowed", maxBulkQueries), http.StatusBadRequest)
+		return
+	}
+	for i := range queries {
+		queries[i].userID = requestUserID(r)
+		if err := queries[i].validate(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid query %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case queries[i].Limit < 0 || queries[i].Offset < 0:
+			http.Error(w, fmt.Sprintf("invalid query %d: limit and offset must not be negative", i+1), http.StatusBadRequest)
+			return
+		case queries[i].Limit == 0:
+			queries[i].Limit = defaultSearchLimit
+		case queries[i].Limit > maxSearchLimit:
+			queries[i].Limit = maxSearchLimit
+		}
+	}
+	results := make([][]NewsItem, len(queries))
+	errs := make([]error, len(queries))
+	semaphore := make(chan struct{}, bulkSearchConcurrency)
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, query NewsFilter) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i], errs[i] = app.getNews(r.Context(), query)
+		}(i, query)
+	}
+	wg.Wait()
+	for _, err := range errs {
 		if err != nil {
-			log.Println(err)
+			http.Error(w, err.Error(), errorStatus(err))
+			return
 		}
 	}
+	w.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
-func (app *NewsApp) startUpdaters() {
-	for _, rule := range app.parsingRules {
-		go app.updateNewsPeriodically(rule)
+// tryUpdateNews runs one update recovering from panics, so a failure of one
+// source neither stops its updater nor the whole application
+func (app *NewsApp) tryUpdateNews(ctx context.Context, rule *ParsingRule, stats *ingestStats) {
+	defer func() {
+		if r := recover(); r != nil {
+			stats.errors++
+			err := fmt.Errorf("update panicked: %v", r)
+			slog.Error("unable to update news", "source", rule.URL, "err", err)
+			app.statuses.failure(rule.URL, err)
+		}
+	}()
+	app.updateNews(ctx, rule, stats)
+}
+
+// updateNews loads the items of the rule counting them in stats, the requests
+// are canceled with ctx
+func (app *NewsApp) updateNews(ctx context.Context, rule *ParsingRule, stats *ingestStats) {
+	ctx, span := tracer.Start(ctx, "update", ruleAttributes(rule))
+	start := time.Now()
+	defer func() {
+		stats.duration = time.Since(start)
+		stats.log(rule.URL, app.config.IngestLog)
+		span.SetAttributes(attribute.Int("items.matched", stats.matched), attribute.Int("items.new", stats.inserted),
+			attribute.Int("items.updated", stats.updated), attribute.Int("errors", stats.errors))
+		span.End()
+	}()
+	items, err := app.loadNewsList(ctx, rule, stats)
+	if err == errNotModified {
+		slog.Debug("page not modified", "source", rule.URL)
+		app.metrics.observeFetch(rule, time.Since(start), nil)
+		app.statuses.success(rule.URL)
+		return
+	}
+	app.metrics.observeFetch(rule, time.Since(start), err)
+	if err != nil {
+		stats.errors++
+		slog.Error("unable to load news", "source", rule.URL, "err", err)
+		app.statuses.failure(rule.URL, err)
+		return
+	}
+	app.metrics.observeParse(rule, stats.parseTime)
+	app.statuses.success(rule.URL)
+	firstRun := false
+	if app.config.BackfillSpacing > 0 || rule.NextPageRule != nil {
+		backfilled, err := app.isBackfilled(rule.URL)
+		if err != nil {
+			slog.Error("unable to check backfill state", "source", rule.URL, "err", err)
+		}
+		firstRun = err == nil && !backfilled
+	}
+	if firstRun && stats.nextPage != "" {
+		items = append(items, app.loadOlderNews(ctx, rule, stats)...)
+	}
+	if firstRun && app.config.BackfillSpacing > 0 {
+		staggerTimestamps(items, app.config.BackfillSpacing)
+	}
+	orderForInsert(items)
+	_, storeSpan := tracer.Start(ctx, "store", ruleAttributes(rule), trace.WithAttributes(attribute.Int("items", len(items))))
+	err = app.storeNews(rule, items, stats)
+	endSpan(storeSpan, err)
+	if err != nil {
+		stats.errors++
+		slog.Error("unable to store news", "source", rule.URL, "err", err)
+		app.validators.forget(rule)
+		return
+	}
+	app.metrics.addStored(rule, stats.inserted, stats.duplicates)
+	if app.config.ImageCache != "" {
+		app.cacheImages(ctx, rule, items)
+	}
+	app.statuses.stored(rule.URL, len(items), stats.inserted)
+	app.dedup.record(rule.URL, stats, app.config.StatsWindow)
+	if firstRun {
+		if err := app.markBackfilled(rule.URL); err != nil {
+			slog.Error("unable to save backfill state", "source", rule.URL, "err", err)
+		}
 	}
 }
 
-func (app *NewsApp) openDatabase() error {
-	const newsStatement = `
-		CREATE TABLE IF NOT EXISTS 'news' (
-		'id' INTEGER PRIMARY KEY AUTOINCREMENT,
-		'link' VARCHAR(1024) UNIQUE NOT NULL,
-		'title' VARCHAR(1024) NOT NULL,
-		'timestamp' DATETIME DEFAULT CURRENT_TIMESTAMP)`
-	db, err := sql.Open("sqlite3", databseFile)
+// storeNews inserts the items in one transaction, an item failing to insert is
+// skipped and the rest are still committed
+func (app *NewsApp) storeNews(rule *ParsingRule, items []NewsItem, stats *ingestStats) error {
+	defer app.metrics.observeQuery("store", time.Now())
+	ctx, cancel := context.WithTimeout(app.ctx, storeTimeout)
+	defer cancel()
+	batch, err := app.beginNewsBatch(ctx)
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(newsStatement)
+	defer batch.rollback()
+	for _, item := range items {
+		item.Language = rule.itemLanguage(&item)
+		result, err := app.insertNewsItem(ctx, batch, &item, rule.UpdateOnChange)
+		if err != nil {
+			stats.errors++
+			slog.Error("unable to store item", "source", rule.URL, "link", item.Link, "err", err)
+			continue
+		}
+		stats.count(result)
+	}
+	if err := batch.commit(); err != nil {
+		return err
+	}
+	if stats.inserted > 0 {
+		app.hub.notify()
+	}
+	if batch.alerts > 0 {
+		app.alerts.notify()
+	}
+	return nil
+}
+
+func (app *NewsApp) openDatabase() error {
+	if app.config.RestoreFile != "" {
+		if err := storage.Restore(app.config.DatabaseFile, app.config.RestoreFile); err != nil {
+			return fmt.Errorf("unable to restore %s: %v", app.config.RestoreFile, err)
+		}
+		slog.Info("restored the database", "backup", app.config.RestoreFile, "db", app.config.DatabaseFile)
+	}
+	db, err := storage.Open(app.config.DatabaseFile, app.config.Pragmas)
 	if err != nil {
-		db.Close()
 		return err
 	}
 	app.db = db
-	return nil
+	return app.setupFullTextSearch()
+}
+
+// newsOrders maps orderBy values to ORDER BY clauses
+var newsOrders = map[string]string{
+	"":        "seq DESC",
+	"updated": "last_updated DESC, seq DESC",
+	// items without a parsed publication date fall back to when they were seen
+	"published": "COALESCE(published, timestamp) DESC, seq DESC",
+	// ranks full-text matches, without a query it is the default order
+	"relevance": "match_rank, seq DESC",
+}
+
+// errorStatus returns the HTTP status code reported for a read error
+func errorStatus(err error) int {
+	if err == errDatabaseBusy || errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
 
-func (app *NewsApp) getNews(query string) ([]NewsItem, error) {
+func isBusyError(err error) bool {
+	if sqliteErr, ok := err.(sqlite3.Error); ok {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// retryOnBusy runs a read until it stops failing with SQLITE_BUSY or SQLITE_LOCKED.
+// Other errors are returned immediately. errDatabaseBusy is returned when all
+// retries are exhausted, and the error of ctx when it is done while waiting.
+func retryOnBusy(ctx context.Context, read func() error) error {
+	backoff := busyBackoff
+	for attempt := 0; ; attempt++ {
+		err := read()
+		if !isBusyError(err) {
+			return err
+		}
+		if attempt == busyRetries {
+			slog.Warn("database is busy, giving up", "retries", busyRetries, "err", err)
+			return errDatabaseBusy
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// getNews reads the items matching the filter, the read is abandoned when the
+// context is done
+func (app *NewsApp) getNews(ctx context.Context, filter NewsFilter) ([]NewsItem, error) {
+	defer app.metrics.observeQuery("search", time.Now())
+	var items []NewsItem
+	err := retryOnBusy(ctx, func() error {
+		var err error
+		items, err = app.queryNews(ctx, filter)
+		return err
+	})
+	return items, err
+}
+
+func (app *NewsApp) queryNews(ctx context.Context, filter NewsFilter) ([]NewsItem, error) {
 	items := make([]NewsItem, 0)
-	var statement string
-	if query != "" {
-		statement = "SELECT link, title FROM news WHERE instr(title, ?) <> 0 ORDER BY timestamp DESC"
-	} else {
-		statement = "SELECT link, title FROM news ORDER BY timestamp DESC"
+	order, ok := newsOrders[filter.OrderBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown orderBy %q", filter.OrderBy)
+	}
+	from, args := app.newsSelection(filter)
+	if filter.OrderBy == "relevance" && !strings.Contains(from, "match_rank") {
+		order = newsOrders[""]
+	}
+	if filter.Group {
+		return app.groupNews(ctx, filter, order)
+	}
+	statement := "SELECT " + newsColumns(filter.userID) + from + " ORDER BY " + order
+	if filter.Limit > 0 {
+		statement += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
 	}
-	rows, err := app.db.Query(statement, query)
+	rows, err := app.db.QueryContext(ctx, statement, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var item NewsItem
-		if err := rows.Scan(&item.Link, &item.Title); err != nil {
+		item, err := scanNewsItem(rows)
+		if err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		items = append(items, *item)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -177,66 +1326,552 @@ func (app *NewsApp) getNews(query string) ([]NewsItem, error) {
 	return items, nil
 }
 
-func (app *NewsApp) insertNewsItem(item *NewsItem) error {
-	_, err := app.db.Exec("INSERT INTO news(link, title) values(?, ?)", item.Link, item.Title)
+// countNews returns the number of items matching the filter regardless of
+// its limit and offset
+func (app *NewsApp) countNews(ctx context.Context, filter NewsFilter) (int, error) {
+	defer app.metrics.observeQuery("count", time.Now())
+	var total int
+	from, args := app.newsSelection(filter)
+	count := "SELECT COUNT(*)"
+	if filter.Group {
+		count = "SELECT COUNT(DISTINCT " + clusterColumn + ")"
+	}
+	err := retryOnBusy(ctx, func() error {
+		return app.db.QueryRowContext(ctx, count+from, args...).Scan(&total)
+	})
+	return total, err
+}
+
+// newsSelection builds the FROM and WHERE clauses of the filter and their
+// arguments, the query is matched by the full-text index when there is one
+func (app *NewsApp) newsSelection(filter NewsFilter) (string, []interface{}) {
+	from := " FROM news"
+	var conditions []string
+	var args []interface{}
+	query := parseSearch(filter.Query)
+	if match := ftsQuery(query); app.fts && match != "" {
+		// the join exposes only its own columns so the columns of news stay unambiguous
+		from += " JOIN (SELECT rowid AS match_id, rank AS match_rank FROM news_fts WHERE news_fts MATCH ?) ON match_id = news.id"
+		args = append(args, match)
+	} else if len(query) > 0 {
+		likeConditions, likeArgs := query.likeConditions()
+		conditions = append(conditions, likeConditions...)
+		args = append(args, likeArgs...)
+	}
+	if filter.MetaKey != "" {
+		conditions = append(conditions, "json_extract(metadata, ?) = ?")
+		args = append(args, metadataPath(filter.MetaKey), filter.MetaValue)
+	}
+	if filter.RuleVersion != "" {
+		conditions = append(conditions, "rule_version = ?")
+		args = append(args, filter.RuleVersion)
+	}
+	if filter.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, filter.Source)
+	}
+	if filter.Category != "" {
+		conditions = append(conditions, "category = ?")
+		args = append(args, filter.Category)
+	}
+	if filter.Language != "" {
+		conditions = append(conditions, "language = ?")
+		args = append(args, filter.Language)
+	}
+	if filter.Edited {
+		conditions = append(conditions, "EXISTS(SELECT 1 FROM title_history WHERE title_history.news_id = news.id)")
+	}
+	if filter.Unread {
+		conditions = append(conditions, "NOT "+itemStateColumn("read", filter.userID))
+	}
+	if filter.Starred {
+		conditions = append(conditions, itemStateColumn("starred", filter.userID))
+	}
+	if filter.Hidden {
+		conditions = append(conditions, itemStateColumn("hidden", filter.userID))
+	} else {
+		conditions = append(conditions, "NOT "+itemStateColumn("hidden", filter.userID))
+	}
+	// a user without subscriptions gets the items of all sources
+	conditions = append(conditions, "(NOT EXISTS(SELECT 1 FROM subscriptions WHERE user_id = ?) OR source IN (SELECT source FROM subscriptions WHERE user_id = ?))")
+	args = append(args, filter.userID, filter.userID)
+	if filter.Since > 0 {
+		conditions = append(conditions, "seq > ?")
+		args = append(args, filter.Since)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "COALESCE(published, timestamp) >= ?")
+		args = append(args, filter.From.UTC().Format(sqliteTimeLayout))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "COALESCE(published, timestamp) <= ?")
+		args = append(args, filter.To.UTC().Format(sqliteTimeLayout))
+	}
+	if len(filter.clusters) > 0 {
+		conditions = append(conditions, clusterColumn+" IN (?"+strings.Repeat(", ?", len(filter.clusters)-1)+")")
+		for _, cluster := range filter.clusters {
+			args = append(args, cluster)
+		}
+	}
+	if len(conditions) == 0 {
+		return from, args
+	}
+	return from + " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// newsColumns returns the columns of the news table and the item state of the
+// user read by scanNewsItem
+func newsColumns(userID int64) string {
+	return "id, link, title, source, category, language, summary, image, metadata, rule_version, published, timestamp, last_updated, seq, " +
+		itemStateColumn("read", userID) + ", " + itemStateColumn("starred", userID) + ", " + itemStateColumn("hidden", userID)
+}
+
+// scanNewsItem reads the columns of newsColumns, the extra destinations get
+// the columns selected after them
+func scanNewsItem(rows *sql.Rows, extra ...interface{}) (*NewsItem, error) {
+	var item NewsItem
+	var source, category, language, image, metadata, ruleVersion sql.NullString
+	var summary []byte
+	var published sql.NullTime
+	dest := []interface{}{&item.ID, &item.Link, &item.Title, &source, &category, &language, &summary, &image, &metadata, &ruleVersion, &published, &item.Timestamp, &item.LastUpdated, &item.Seq,
+		&item.Read, &item.Starred, &item.Hidden}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	item.Source = source.String
+	item.Category = category.String
+	item.Language = language.String
+	summaryText, err := storage.Decompress(summary)
 	if err != nil {
-		return fmt.Errorf("Insert failed for link='%s', title='%s': %v", item.Link, item.Title, err)
+		return nil, fmt.Errorf("invalid summary of %s: %v", item.Link, err)
 	}
-	return nil
+	item.Summary = summaryText
+	item.Image = image.String
+	item.RuleVersion = ruleVersion.String
+	item.StableID = stableID(item.Link)
+	if published.Valid {
+		item.Published = &published.Time
+	}
+	if metadata.Valid && metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &item.Metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata of %s: %v", item.Link, err)
+		}
+	}
+	return &item, nil
 }
 
-func (app *NewsApp) runBrowser() {
-	url := "http://localhost:" + strconv.FormatUint(uint64(app.port), 10)
-	if runtime.GOOS == "windows" {
-		if err := exec.Command("cmd", "/c", "start", url).Start(); err != nil {
-			log.Printf("Unable to run browser: %v\n", err)
+// stableID returns an id of the item that does not depend on the database
+func stableID(link string) string {
+	sum := sha1.Sum([]byte(link))
+	return hex.EncodeToString(sum[:10])
+}
+
+// metadataPath returns a JSON path addressing a metadata key, the key must not
+// contain a double quote
+func metadataPath(key string) string {
+	return `$."` + key + `"`
+}
+
+// insertNewsItem stores a new item. When updateOnChange is set and the link is
+// already stored with another title, the title and last_updated are updated
+// and the previous title is kept in title_history.
+func (app *NewsApp) insertNewsItem(ctx context.Context, batch *newsBatch, item *NewsItem, updateOnChange bool) (insertResult, error) {
+	if app.config.CompactRetention > 0 {
+		seen, err := batch.isLinkSeen(ctx, item.Link)
+		if err != nil {
+			return 0, err
+		}
+		if seen {
+			return itemDuplicate, nil
+		}
+	}
+	var metadata sql.NullString
+	if len(item.Metadata) > 0 {
+		data, err := json.Marshal(item.Metadata)
+		if err != nil {
+			return 0, err
+		}
+		metadata = sql.NullString{String: string(data), Valid: true}
+	}
+	var published sql.NullString
+	if item.Published != nil {
+		published = sql.NullString{String: item.Published.UTC().Format(sqliteTimeLayout), Valid: true}
+	}
+	var timestamp sql.NullString
+	if !item.Timestamp.IsZero() {
+		timestamp = sql.NullString{String: item.Timestamp.UTC().Format(sqliteTimeLayout), Valid: true}
+	}
+	content, err := app.contentValue(item.Content)
+	if err != nil {
+		return 0, err
+	}
+	summary, err := app.summaryValue(item.Summary)
+	if err != nil {
+		return 0, err
+	}
+	var language sql.NullString
+	if item.Language != "" {
+		language = sql.NullString{String: item.Language, Valid: true}
+	}
+	sum, clustered := titleHash(item.Title)
+	var hash sql.NullInt64
+	if clustered {
+		hash = sql.NullInt64{Int64: int64(sum), Valid: true}
+	}
+	// a stored link is ignored rather than failing, most items of a page are stored already
+	inserted, err := batch.insert.ExecContext(ctx, item.Link, item.Title, metadata, item.RuleVersion, published, timestamp, item.Source, summary, item.Image, item.Category, content,
+		hash, language)
+	if err != nil {
+		return 0, fmt.Errorf("Insert failed for link='%s', title='%s': %v", item.Link, item.Title, err)
+	}
+	if count, err := inserted.RowsAffected(); err != nil {
+		return 0, err
+	} else if count == 0 {
+		if !updateOnChange {
+			return itemDuplicate, nil
+		}
+		if _, err := batch.history.ExecContext(ctx, item.Title, item.Link); err != nil {
+			return 0, fmt.Errorf("unable to record the title history of link='%s': %v", item.Link, err)
+		}
+		result, err := batch.update.ExecContext(ctx, item.Title, item.Link, hash)
+		if err != nil {
+			return 0, fmt.Errorf("Update failed for link='%s', title='%s': %v", item.Link, item.Title, err)
 		}
+		if count, _ := result.RowsAffected(); count > 0 {
+			return itemUpdated, nil
+		}
+		return itemDuplicate, nil
+	}
+	id, err := inserted.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if clustered {
+		if err := batch.joinCluster(ctx, id, sum); err != nil {
+			return 0, fmt.Errorf("unable to find the cluster of link='%s': %v", item.Link, err)
+		}
+	}
+	if err := app.queueAlerts(ctx, batch, id, item); err != nil {
+		return 0, fmt.Errorf("unable to queue alerts of link='%s': %v", item.Link, err)
 	}
+	return itemInserted, nil
 }
 
-func NewNewsApp() *NewsApp {
-	return &NewsApp{}
+func isUniqueError(err error) bool {
+	if sqliteErr, ok := err.(sqlite3.Error); ok {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
 }
 
-func (app *NewsApp) Start(port uint) error {
+// isHeadless reports whether there is no desktop to open a browser on: an
+// X11 or Wayland system without a display or a session over SSH
+func isHeadless() bool {
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return true
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return false
+	}
+	return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+}
+
+func (app *NewsApp) runBrowser() {
+	host := app.config.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if app.tlsEnabled() {
+		scheme = "https"
+	}
+	url := scheme + "://" + net.JoinHostPort(host, strconv.FormatUint(uint64(app.port), 10))
+	if isHeadless() {
+		slog.Info("no display to open a browser on", "url", url)
+		return
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		cmd = exec.Command("xdg-open", url)
+	default:
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		slog.Warn("unable to run browser", "err", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+func (app *NewsApp) compileBlocklist() error {
+	blocklist, err := newKeywordMatcher(app.config.ExcludeKeywords, app.config.ExcludeWholeWords)
+	if err != nil {
+		return err
+	}
+	app.blocklist = blocklist
+	return nil
+}
+
+func NewNewsApp(config Config) *NewsApp {
+	return &NewsApp{config: config, ctx: context.Background(), pool: newFetchPool(), renders: make(chan struct{}, config.RenderConcurrency), client: &http.Client{},
+		alerts: alertSet{wake: make(chan struct{}, 1)}, scheduler: ruleScheduler{wake: make(chan struct{}, 1)}}
+}
+
+// open loads the blocklist and the parsing rules and opens the database
+func (app *NewsApp) open() error {
+	if err := app.compileBlocklist(); err != nil {
+		return err
+	}
 	if err := app.readParsingRules(); err != nil {
 		return err
 	}
-	data, _ := json.MarshalIndent(app.parsingRules, "", "  ")
-	log.Printf("parsing rules: %s\n", string(data))
+	data, _ := json.Marshal(app.parsingRules)
+	slog.Info("parsing rules loaded", "file", app.config.RulesFile, "rules", len(app.parsingRules))
+	slog.Debug("parsing rules", "rules", string(data))
 	if err := app.openDatabase(); err != nil {
 		return err
 	}
+	if err := app.loadAlerts(); err != nil {
+		return err
+	}
+	if err := app.loadUsers(); err != nil {
+		return err
+	}
+	return app.loadSiteTitles()
+}
+
+// Start runs the application until SIGINT or SIGTERM is received
+func (app *NewsApp) Start(port uint) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	app.ctx = ctx
+	stopTracing, err := app.setupTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+	if err := app.open(); err != nil {
+		return err
+	}
 	app.port = port
+	files, err := app.staticFileSystem()
+	if err != nil {
+		return fmt.Errorf("error while loading the static files: %v", err)
+	}
+	if app.config.WaitFor != "" {
+		if err := waitForAddress(app.config.WaitFor, app.config.WaitForTimeout); err != nil {
+			return err
+		}
+	}
+	app.mu.Lock()
 	app.startUpdaters()
+	app.mu.Unlock()
+	app.startWorkers(ctx)
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		app.runScheduler(ctx)
+	}()
+	go app.reloadOnSignal()
+	if app.config.WatchRules > 0 {
+		go app.watchParsingRules(ctx, app.config.WatchRules)
+	}
+	if app.config.CompactRetention > 0 {
+		app.background.Add(1)
+		go func() {
+			defer app.background.Done()
+			app.compactPeriodically(ctx)
+		}()
+	}
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		app.deliverAlertsPeriodically(ctx)
+	}()
+	if app.config.TelegramBot {
+		app.background.Add(1)
+		go func() {
+			defer app.background.Done()
+			app.runTelegramBot(ctx)
+		}()
+	}
+	// the rules may get retention limits on reload, so the janitor always runs
+	app.background.Add(1)
+	go func() {
+		defer app.background.Done()
+		app.pruneNewsPeriodically(ctx)
+	}()
 	mux := http.NewServeMux()
-	mux.HandleFunc("/news/", app.searchHandler)
-	mux.Handle("/", http.FileServer(http.Dir("./public")))
-	time.AfterFunc(2*time.Second, app.runBrowser)
-	address := ":" + strconv.FormatUint(uint64(port), 10)
-	if err := http.ListenAndServe(address, mux); err != nil {
+	limiter := server.NewRateLimiter(app.config.RateLimit, app.config.RateBurst, app.config.TrustProxy)
+	cors := &server.CORS{Origins: app.config.AllowOrigins, Methods: app.config.AllowMethods, Headers: app.config.AllowHeaders}
+	api := func(handler http.HandlerFunc) http.Handler {
+		return limiter.Limit(cors.Handler(app.requireAuth(handler)))
+	}
+	handle := func(route string, handler http.Handler) {
+		if app.config.LogRequests {
+			handler = server.LogRequests(route, handler)
+		}
+		mux.Handle(route, traceRequests(route, app.instrument(route, handler)))
+	}
+	handle("/news/", server.Compress(api(app.searchHandler)))
+	handle("/news/search", server.Compress(api(app.bulkSearchHandler)))
+	handle("/news/stream", api(app.streamHandler))
+	handle("/news/export", server.Compress(api(app.newsExportHandler)))
+	handle("/atom.xml", api(app.feedHandler(atomSerializer{})))
+	handle("/feed.xml", api(app.feedHandler(atomSerializer{})))
+	handle("/rss.xml", api(app.feedHandler(rssSerializer{})))
+	handle("/feed.json", api(app.feedHandler(jsonFeedSerializer{})))
+	handle("/sources", api(app.sourcesHandler))
+	handle("/api/sources/status", api(app.sourcesHandler))
+	handle("/api/sources/", api(app.sourceHandler))
+	handle("/graphql", api(app.graphqlHandler))
+	handle("/images/", api(app.imageHandler))
+	handle("/html", api(app.htmlHandler))
+	handle("/health", http.HandlerFunc(app.healthHandler))
+	handle("/healthz", http.HandlerFunc(app.livenessHandler))
+	handle("/stats", api(app.statsHandler))
+	handle("/metrics", http.HandlerFunc(app.metricsHandler))
+	handle("/reload", api(app.requireAdmin(app.reloadHandler)))
+	handle("/api/rules", api(app.requireAdmin(app.rulesHandler)))
+	handle("/api/rules/test", api(app.requireAdmin(app.ruleTestHandler)))
+	handle("/api/rules/import", api(app.requireAdmin(app.rulesImportHandler)))
+	handle("/api/rules/export", api(app.requireAdmin(app.rulesExportHandler)))
+	handle("/api/alerts", api(app.requireAdmin(app.alertsHandler)))
+	handle("/api/users", api(app.requireAdmin(app.usersHandler)))
+	handle("/api/subscriptions", api(app.subscriptionsHandler))
+	handle("/api/login", limiter.Limit(cors.Handler(http.HandlerFunc(app.loginHandler))))
+	handle("/api/logout", limiter.Limit(cors.Handler(http.HandlerFunc(app.logoutHandler))))
+	handle("/export/stream", server.Compress(api(app.requireAdmin(app.exportStreamHandler))))
+	handle("/admin/reindex", api(app.requireAdmin(app.reindexHandler)))
+	handle("/api/backup", api(app.requireAdmin(app.backupHandler)))
+	static := http.FileServer(files)
+	if app.config.ProtectStatic {
+		static = app.requireAuth(static)
+	}
+	mux.Handle("/", static)
+	if !app.config.NoBrowser {
+		time.AfterFunc(2*time.Second, app.runBrowser)
+	}
+	app.server = &http.Server{
+		Addr:    net.JoinHostPort(app.config.Host, strconv.FormatUint(uint64(port), 10)),
+		Handler: mux,
+	}
+	served := make(chan error, 3)
+	if app.tlsEnabled() {
+		redirect, err := app.configureTLS(app.server)
+		if err != nil {
+			stop()
+			app.shutdown()
+			return err
+		}
+		if app.config.HTTPRedirectPort > 0 {
+			app.redirect = &http.Server{
+				Addr:    net.JoinHostPort(app.config.Host, strconv.FormatUint(uint64(app.config.HTTPRedirectPort), 10)),
+				Handler: redirect,
+			}
+			go func() { served <- app.redirect.ListenAndServe() }()
+		}
+		go func() { served <- app.server.ListenAndServeTLS("", "") }()
+	} else {
+		go func() { served <- app.server.ListenAndServe() }()
+	}
+	if app.config.GRPCPort > 0 {
+		listener, err := net.Listen("tcp", net.JoinHostPort(app.config.Host, strconv.FormatUint(uint64(app.config.GRPCPort), 10)))
+		if err != nil {
+			stop()
+			app.shutdown()
+			return fmt.Errorf("unable to listen for gRPC: %v", err)
+		}
+		app.grpc = app.newGRPCServer()
+		go func() { served <- app.grpc.Serve(listener) }()
+	}
+	select {
+	case err := <-served:
+		stop()
+		app.shutdown()
 		return err
+	case <-ctx.Done():
 	}
-	return nil
+	slog.Info("shutting down")
+	return app.shutdown()
 }
 
 func extractEntity(parentNode *html.Node, rule *ExtractRule) string {
-	var result string
-	node := htmlquery.FindOne(parentNode, rule.XPathExpr)
-	if node != nil {
-		if rule.Attribute != "" {
-			result = htmlquery.SelectAttr(node, rule.Attribute)
-		} else {
-			result = htmlquery.InnerText(node)
-		}
-	}
+	result := extractValue(parentNode, rule)
 	if result == "" {
-		data, _ := json.MarshalIndent(rule, "", "")
-		log.Printf("The rule %s might be not working because returns empty result", data)
+		data, _ := json.Marshal(rule)
+		slog.Debug("the rule might be not working because it returns an empty result", "rule", string(data))
 	}
 	return result
 }
 
+// documentBase returns the URL relative links of the page resolve against,
+// the href of its base element or else the page URL
+func documentBase(doc *html.Node, pageURL string) string {
+	node := htmlquery.FindOne(doc, "//base[@href]")
+	if node == nil {
+		return pageURL
+	}
+	href := strings.TrimSpace(htmlquery.SelectAttr(node, "href"))
+	if href == "" {
+		return pageURL
+	}
+	base, err := convertToAbsURL(pageURL, href)
+	if err != nil {
+		return pageURL
+	}
+	return base
+}
+
+// absoluteImageURL resolves an extracted image URL against the page, an empty
+// value stays empty
+func absoluteImageURL(baseURL, imageURL string) (string, error) {
+	imageURL = strings.TrimSpace(imageURL)
+	if imageURL == "" {
+		return "", nil
+	}
+	absURL, err := convertToAbsURL(baseURL, imageURL)
+	if err != nil {
+		return "", fmt.Errorf("error converting image url %s to absolute url using base url %s: %v", imageURL, baseURL, err)
+	}
+	return absURL, nil
+}
+
+// extractValue returns the first non-empty result of the rule and its
+// alternatives after their transforms
+func extractValue(parentNode *html.Node, rule *ExtractRule) string {
+	if result := extractSingleValue(parentNode, rule); result != "" {
+		return rule.transform(result)
+	}
+	for i := range rule.Alternatives {
+		if result := extractValue(parentNode, &rule.Alternatives[i]); result != "" {
+			return rule.transform(result)
+		}
+	}
+	return ""
+}
+
+func extractSingleValue(parentNode *html.Node, rule *ExtractRule) string {
+	// the empty title rule of a rule with pageMetadata extracts nothing
+	if rule.expr() == "" {
+		return ""
+	}
+	node := findOne(parentNode, rule.expr())
+	if node == nil {
+		return ""
+	}
+	if rule.Attribute != "" {
+		return htmlquery.SelectAttr(node, rule.Attribute)
+	}
+	return htmlquery.InnerText(node)
+}
+
 func convertToAbsURL(baseURL string, linkURL string) (string, error) {
 	url, err := url.Parse(linkURL)
 	if err != nil {
@@ -251,10 +1886,3 @@ func convertToAbsURL(baseURL string, linkURL string) (string, error) {
 	}
 	return linkURL, nil
 }
-
-func main() {
-	app := NewNewsApp()
-	if err := app.Start(8383); err != nil {
-		log.Fatal(err)
-	}
-}
@@ -0,0 +1,408 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/mattn/go-sqlite3"
+)
+
+// newTestApp returns an application with a new database in a temporary
+// directory
+func newTestApp(t *testing.T) *NewsApp {
+	t.Helper()
+	app := NewNewsApp(Config{DatabaseFile: filepath.Join(t.TempDir(), "news.db")})
+	if err := app.openDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.db.Close() })
+	return app
+}
+
+// storeTestNews stores count items of the rule with the links /news/0 and on
+func storeTestNews(t *testing.T, app *NewsApp, rule *ParsingRule, count int) ingestStats {
+	t.Helper()
+	items := make([]NewsItem, count)
+	for i := range items {
+		items[i] = NewsItem{Link: fmt.Sprintf("%snews/%d", rule.URL, i), Title: fmt.Sprintf("Story number %d", i), Source: rule.Source()}
+	}
+	var stats ingestStats
+	if err := app.storeNews(rule, items, &stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestBulkSearchHandler(t *testing.T) {
+	app := newTestApp(t)
+	storeTestNews(t, app, &ParsingRule{URL: "https://example.com/"}, 250)
+	tests := []struct {
+		name    string
+		queries string
+		status  int
+		counts  []int
+		message string
+	}{
+		{"default and capped limits", `[{}, {"limit": 1000}, {"limit": 5}]`, http.StatusOK, []int{defaultSearchLimit, maxSearchLimit, 5}, ""},
+		{"negative limit", `[{"limit": -1}]`, http.StatusBadRequest, nil, "invalid query 1"},
+		{"negative offset", `[{"offset": -1}]`, http.StatusBadRequest, nil, "invalid query 1"},
+		{"unknown orderBy", `[{}, {"orderBy": "title"}]`, http.StatusBadRequest, nil, `invalid query 2: unknown orderBy "title"`},
+		{"negative since", `[{"since": -1}, {}]`, http.StatusBadRequest, nil, "invalid query 1: since"},
+		{"from after to", `[{"from": "2024-02-01T00:00:00Z", "to": "2024-01-01T00:00:00Z"}]`, http.StatusBadRequest, nil, "invalid query 1: from must not be after to"},
+		{"too many queries", "[" + strings.Repeat("{},", maxBulkQueries) + "{}]", http.StatusBadRequest, nil, ""},
+		{"not an array", `{}`, http.StatusBadRequest, nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.bulkSearchHandler(w, httptest.NewRequest(http.MethodPost, "/news/search", strings.NewReader(test.queries)))
+			if w.Code != test.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), test.message) {
+				t.Errorf("got %q, want a message containing %q", w.Body, test.message)
+			}
+			if test.counts == nil {
+				return
+			}
+			var results [][]NewsItem
+			if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(test.counts) {
+				t.Fatalf("got %d results, want %d", len(results), len(test.counts))
+			}
+			for i, items := range results {
+				if len(items) != test.counts[i] {
+					t.Errorf("query %d: got %d items, want %d", i+1, len(items), test.counts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStoreNewsSkipsStoredLinks(t *testing.T) {
+	tests := []struct {
+		name           string
+		updateOnChange bool
+		second         string
+		want           ingestStats
+		title          string
+	}{
+		{"same title", false, "First title", ingestStats{duplicates: 1}, "First title"},
+		{"changed title", false, "Second title", ingestStats{duplicates: 1}, "First title"},
+		{"changed title with updateOnChange", true, "Second title", ingestStats{updated: 1}, "Second title"},
+		{"same title with updateOnChange", true, "First title", ingestStats{duplicates: 1}, "First title"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t)
+			rule := &ParsingRule{URL: "https://example.com/", UpdateOnChange: test.updateOnChange}
+			for i, title := range []string{"First title", test.second} {
+				var stats ingestStats
+				items := []NewsItem{{Link: "https://example.com/a", Title: title}}
+				if err := app.storeNews(rule, items, &stats); err != nil {
+					t.Fatal(err)
+				}
+				want := ingestStats{inserted: 1}
+				if i > 0 {
+					want = test.want
+				}
+				if stats.inserted != want.inserted || stats.updated != want.updated || stats.duplicates != want.duplicates || stats.errors != 0 {
+					t.Errorf("store %d: got %+v, want %+v", i+1, stats, want)
+				}
+			}
+			var count int
+			var title string
+			if err := app.db.QueryRow("SELECT COUNT(*), MAX(title) FROM news").Scan(&count, &title); err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 || title != test.title {
+				t.Errorf("got %d rows with title %q, want 1 with %q", count, title, test.title)
+			}
+		})
+	}
+}
+
+func TestUpdateNewsContinuesAfterFailingSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/up/":
+			fmt.Fprint(w, testPage)
+		case "/down/":
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, "<html><body><p>no news here</p></body></html>")
+		}
+	}))
+	defer server.Close()
+
+	noRetries := uint(0)
+	tests := []struct {
+		path   string
+		stored int
+		failed bool
+	}{
+		{"/down/", 0, true},
+		{"/missing/", 0, false},
+		{"/up/", 2, false},
+	}
+	app := newTestApp(t)
+	for _, test := range tests {
+		rule := &ParsingRule{
+			URL:                server.URL + test.path,
+			Interval:           30,
+			MaxRetries:         &noRetries,
+			NewsNodesXPathExpr: `//div[@class="news"]`,
+			LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+			TitleRule:          ExtractRule{XPathExpr: "a"},
+		}
+		if err := PrepareParsingRules([]*ParsingRule{rule}); err != nil {
+			t.Fatal(err)
+		}
+		var stats ingestStats
+		app.tryUpdateNews(context.Background(), rule, &stats)
+		if stats.inserted != test.stored {
+			t.Errorf("%s: stored %d items, want %d", test.path, stats.inserted, test.stored)
+		}
+		status := app.statuses.get(rule.URL)
+		if failed := status.LastError != ""; failed != test.failed {
+			t.Errorf("%s: got last error %q", test.path, status.LastError)
+		}
+	}
+	var count int
+	if err := app.db.QueryRow("SELECT COUNT(*) FROM news").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d stored items, want 2", count)
+	}
+}
+
+func TestDocumentBase(t *testing.T) {
+	const pageURL = "https://example.com/news/index.html"
+	tests := []struct {
+		head string
+		link string
+		want string
+	}{
+		{"", "story/1", "https://example.com/news/story/1"},
+		{`<base href="https://cdn.example.com/">`, "story/1", "https://cdn.example.com/story/1"},
+		{`<base href="https://cdn.example.com/">`, "/story/1", "https://cdn.example.com/story/1"},
+		{`<base href="/archive/">`, "story/1", "https://example.com/archive/story/1"},
+		{`<base href=" ">`, "story/1", "https://example.com/news/story/1"},
+		{`<base target="_blank">`, "story/1", "https://example.com/news/story/1"},
+		{`<base href="https://cdn.example.com/">`, "https://example.org/story/1", "https://example.org/story/1"},
+	}
+	for _, test := range tests {
+		doc, err := htmlquery.Parse(strings.NewReader("<html><head>" + test.head + "</head><body></body></html>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := convertToAbsURL(documentBase(doc, pageURL), test.link)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.head, test.link, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s %s: got %s, want %s", test.head, test.link, got, test.want)
+		}
+	}
+}
+
+func TestDatabaseQueriesCanceled(t *testing.T) {
+	app := newTestApp(t)
+	rule := &ParsingRule{URL: "https://example.com/"}
+	storeTestNews(t, app, rule, 3)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	tests := []struct {
+		name   string
+		query  func(ctx context.Context) error
+		ctx    context.Context
+		err    error
+		status int
+	}{
+		{"getNews canceled", func(ctx context.Context) error {
+			_, err := app.getNews(ctx, NewsFilter{})
+			return err
+		}, canceled, context.Canceled, http.StatusInternalServerError},
+		{"getNews past its deadline", func(ctx context.Context) error {
+			_, err := app.getNews(ctx, NewsFilter{})
+			return err
+		}, expired, context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{"countNews canceled", func(ctx context.Context) error {
+			_, err := app.countNews(ctx, NewsFilter{})
+			return err
+		}, canceled, context.Canceled, http.StatusInternalServerError},
+		{"storeNews canceled", func(ctx context.Context) error {
+			app.ctx = ctx
+			defer func() { app.ctx = context.Background() }()
+			items := []NewsItem{{Link: "https://example.com/news/new", Title: "New story", Source: rule.Source()}}
+			return app.storeNews(rule, items, new(ingestStats))
+		}, canceled, context.Canceled, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		err := test.query(test.ctx)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if status := errorStatus(err); status != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, status, test.status)
+		}
+	}
+	var count int
+	if err := app.db.QueryRow("SELECT COUNT(*) FROM news").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("got %d stored items, want 3", count)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/news/", nil).WithContext(canceled)
+	w := httptest.NewRecorder()
+	app.searchHandler(w, r)
+	if w.Code == http.StatusOK {
+		t.Errorf("searchHandler answered a canceled request: %s", w.Body)
+	}
+}
+
+func TestExtractValueAlternatives(t *testing.T) {
+	doc, err := htmlquery.Parse(strings.NewReader(`<div><h3>Title</h3><a href="/story">Link text</a></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := htmlquery.FindOne(doc, "//div")
+	tests := []struct {
+		name string
+		rule ExtractRule
+		want string
+	}{
+		{"expression", ExtractRule{XPathExpr: "h3"}, "Title"},
+		{"first alternative", ExtractRule{XPathExpr: "h2", Alternatives: []ExtractRule{{XPathExpr: "h3"}, {XPathExpr: "a"}}}, "Title"},
+		{"later alternative", ExtractRule{XPathExpr: "h2", Alternatives: []ExtractRule{{XPathExpr: "h1"}, {XPathExpr: "a", Attribute: "href"}}}, "/story"},
+		{"only alternatives", ExtractRule{Alternatives: []ExtractRule{{XPathExpr: "h2"}, {XPathExpr: "a"}}}, "Link text"},
+		{"nothing found", ExtractRule{Alternatives: []ExtractRule{{XPathExpr: "h2"}}}, ""},
+	}
+	for _, test := range tests {
+		if got := extractValue(node, &test.rule); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func BenchmarkStoreNews(b *testing.B) {
+	const count = 500
+	rule := &ParsingRule{URL: "https://example.com/"}
+	app := NewNewsApp(Config{DatabaseFile: filepath.Join(b.TempDir(), "news.db")})
+	if err := app.openDatabase(); err != nil {
+		b.Fatal(err)
+	}
+	defer app.db.Close()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		items := make([]NewsItem, count)
+		for i := range items {
+			items[i] = NewsItem{Link: fmt.Sprintf("%snews/%d/%d", rule.URL, n, i), Title: fmt.Sprintf("Story number %d", i), Source: rule.Source()}
+		}
+		var stats ingestStats
+		b.StartTimer()
+		if err := app.storeNews(rule, items, &stats); err != nil {
+			b.Fatal(err)
+		}
+		if stats.inserted != count {
+			b.Fatalf("stored %d items, want %d", stats.inserted, count)
+		}
+	}
+}
+
+func TestRetryOnBusy(t *testing.T) {
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+	other := errors.New("no such table")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		fails int
+		err   error
+		reads int
+	}{
+		{"no error", context.Background(), 0, nil, 1},
+		{"busy once", context.Background(), 1, nil, 2},
+		{"busy and canceled", canceled, 1, context.Canceled, 1},
+		{"other error", canceled, 0, other, 1},
+	}
+	for _, test := range tests {
+		reads := 0
+		err := retryOnBusy(test.ctx, func() error {
+			reads++
+			if reads <= test.fails {
+				return busy
+			}
+			if test.err == other {
+				return other
+			}
+			return nil
+		})
+		if !errors.Is(err, test.err) || reads != test.reads {
+			t.Errorf("%s: got %v after %d reads, want %v after %d", test.name, err, reads, test.err, test.reads)
+		}
+	}
+}
+
+func TestMetadataFilter(t *testing.T) {
+	app := newTestApp(t)
+	rule := &ParsingRule{URL: "https://example.com/"}
+	items := []NewsItem{
+		{Link: rule.URL + "news/1", Title: "First", Source: rule.Source(), Metadata: map[string]string{"author": "Alice", "dc.creator": "Alice"}},
+		{Link: rule.URL + "news/2", Title: "Second", Source: rule.Source(), Metadata: map[string]string{"author": "Bob", "read time": "5"}},
+	}
+	if err := app.storeNews(rule, items, new(ingestStats)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key    string
+		value  string
+		status int
+		count  int
+	}{
+		{"author", "Alice", http.StatusOK, 1},
+		{"author", "Carol", http.StatusOK, 0},
+		{"dc.creator", "Alice", http.StatusOK, 1},
+		{"read time", "5", http.StatusOK, 1},
+		{`au"thor`, "Alice", http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		target := "/news/?" + url.Values{"metaKey": {test.key}, "metaValue": {test.value}}.Encode()
+		w := httptest.NewRecorder()
+		app.searchHandler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != test.status {
+			t.Errorf("%s=%s: got status %d, want %d: %s", test.key, test.value, w.Code, test.status, w.Body)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		var page NewsPage
+		if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) != test.count {
+			t.Errorf("%s=%s: got %d items, want %d", test.key, test.value, len(page.Items), test.count)
+		}
+	}
+}
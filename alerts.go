@@ -0,0 +1,399 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	alertChannelWebhook  = "webhook"
+	alertChannelEmail    = "email"
+	alertChannelTelegram = "telegram"
+)
+
+const (
+	alertPollInterval = time.Minute
+	// alertBatchSize is the maximal number of items of one notification
+	alertBatchSize    = 20
+	maxAlertAttempts  = 5
+	alertRetryBackoff = time.Minute
+)
+
+// Alert notifies the channel of new items whose titles contain Contains,
+// ignoring case, or match the regular expression Pattern. Target is the URL
+// of a webhook, an email address or a Telegram chat id.
+type Alert struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	Contains string    `json:"contains,omitempty"`
+	Pattern  string    `json:"pattern,omitempty"`
+	Channel  string    `json:"channel"`
+	Target   string    `json:"target"`
+	Created  time.Time `json:"created"`
+	pattern  *regexp.Regexp
+}
+
+// prepare checks the alert and compiles its pattern, a channel needs its
+// settings such as -smtpAddr to be configured
+func (alert *Alert) prepare(config *Config) error {
+	if alert.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if alert.Contains == "" && alert.Pattern == "" {
+		return fmt.Errorf("contains or pattern is required")
+	}
+	alert.pattern = nil
+	if alert.Pattern != "" {
+		pattern, err := regexp.Compile(alert.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		alert.pattern = pattern
+	}
+	switch alert.Channel {
+	case alertChannelWebhook:
+		if u, err := url.Parse(alert.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("the target of a webhook must be an absolute http or https url")
+		}
+	case alertChannelEmail:
+		if !strings.Contains(alert.Target, "@") {
+			return fmt.Errorf("the target of an email alert must be an email address")
+		}
+		if config.SMTPAddr == "" || config.SMTPFrom == "" {
+			return fmt.Errorf("email alerts need -smtpAddr and -smtpFrom")
+		}
+	case alertChannelTelegram:
+		if alert.Target == "" {
+			return fmt.Errorf("the target of a telegram alert must be a chat id")
+		}
+		if config.TelegramToken == "" {
+			return fmt.Errorf("telegram alerts need -telegramToken")
+		}
+	default:
+		return fmt.Errorf("unknown channel %q, expected webhook, email or telegram", alert.Channel)
+	}
+	return nil
+}
+
+func (alert *Alert) matches(title string) bool {
+	if alert.Contains != "" && strings.Contains(foldCase(title), foldCase(alert.Contains)) {
+		return true
+	}
+	return alert.pattern != nil && alert.pattern.MatchString(title)
+}
+
+// alertSet holds the alerts matched against every inserted item
+type alertSet struct {
+	mu     sync.RWMutex
+	alerts []*Alert
+	// wake starts a delivery before the next poll
+	wake chan struct{}
+}
+
+func (s *alertSet) set(alerts []*Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = alerts
+}
+
+func (s *alertSet) list() []*Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.alerts
+}
+
+func (s *alertSet) get(id int64) *Alert {
+	for _, alert := range s.list() {
+		if alert.ID == id {
+			return alert
+		}
+	}
+	return nil
+}
+
+func (s *alertSet) matching(title string) []*Alert {
+	var matching []*Alert
+	for _, alert := range s.list() {
+		if alert.matches(title) {
+			matching = append(matching, alert)
+		}
+	}
+	return matching
+}
+
+// notify starts a delivery without waiting for it
+func (s *alertSet) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loadAlerts reads the alerts from the database, an alert that became invalid
+// e.g. because a channel setting was removed is kept but logged
+func (app *NewsApp) loadAlerts() error {
+	rows, err := app.db.Query("SELECT id, name, COALESCE(contains, ''), COALESCE(pattern, ''), channel, target, created FROM alerts ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	alerts := make([]*Alert, 0)
+	for rows.Next() {
+		alert := new(Alert)
+		if err := rows.Scan(&alert.ID, &alert.Name, &alert.Contains, &alert.Pattern, &alert.Channel, &alert.Target, &alert.Created); err != nil {
+			return err
+		}
+		if err := alert.prepare(&app.config); err != nil {
+			slog.Warn("alert cannot be delivered", "alert", alert.Name, "err", err)
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	app.alerts.set(alerts)
+	return nil
+}
+
+// queueAlerts queues the notifications of a new item in the transaction of
+// its insert. In quiet hours nothing is queued unless -quietDigest holds the
+// notifications until the hours end.
+func (app *NewsApp) queueAlerts(ctx context.Context, batch *newsBatch, id int64, item *NewsItem) error {
+	if app.config.QuietHours.active(time.Now()) && !app.config.QuietDigest {
+		return nil
+	}
+	for _, alert := range app.alerts.matching(item.Title) {
+		if _, err := batch.queueAlert.ExecContext(ctx, alert.ID, id); err != nil {
+			return err
+		}
+		batch.alerts++
+	}
+	return nil
+}
+
+func (app *NewsApp) deliverAlertsPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(alertPollInterval)
+	defer ticker.Stop()
+	for {
+		app.deliverAlerts(ctx)
+		select {
+		case <-ticker.C:
+		case <-app.alerts.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type alertDelivery struct {
+	id       int64
+	alertID  int64
+	newsID   int64
+	attempts int
+}
+
+// deliverAlerts sends the due notifications outside quiet hours, the items of
+// one alert are sent together. Failed notifications are retried with a
+// growing backoff up to maxAlertAttempts times.
+func (app *NewsApp) deliverAlerts(ctx context.Context) {
+	if app.config.QuietHours.active(time.Now()) {
+		return
+	}
+	deliveries, items, err := app.dueAlertDeliveries(ctx)
+	if err != nil {
+		slog.Error("unable to read alert deliveries", "err", err)
+		return
+	}
+	groups := make(map[int64][]alertDelivery)
+	var order []int64
+	for _, delivery := range deliveries {
+		alert := app.alerts.get(delivery.alertID)
+		if alert == nil || items[delivery.newsID] == nil {
+			// the alert was deleted or the item pruned meanwhile
+			app.finishAlertDeliveries(ctx, []alertDelivery{delivery})
+			continue
+		}
+		if _, ok := groups[alert.ID]; !ok {
+			order = append(order, alert.ID)
+		}
+		groups[alert.ID] = append(groups[alert.ID], delivery)
+	}
+	for _, alertID := range order {
+		alert := app.alerts.get(alertID)
+		group := groups[alertID]
+		for len(group) > 0 {
+			chunk := group
+			if len(chunk) > alertBatchSize {
+				chunk = chunk[:alertBatchSize]
+			}
+			group = group[len(chunk):]
+			chunkItems := make([]NewsItem, len(chunk))
+			for i, delivery := range chunk {
+				chunkItems[i] = *items[delivery.newsID]
+			}
+			if err := app.sendAlert(ctx, alert, chunkItems); err != nil {
+				slog.Warn("unable to deliver alert", "alert", alert.Name, "channel", alert.Channel, "items", len(chunk), "err", err)
+				app.retryAlertDeliveries(ctx, chunk, err)
+				continue
+			}
+			slog.Info("alert delivered", "alert", alert.Name, "channel", alert.Channel, "items", len(chunk))
+			app.finishAlertDeliveries(ctx, chunk)
+		}
+	}
+}
+
+// dueAlertDeliveries returns the deliveries to send now and their items by id
+func (app *NewsApp) dueAlertDeliveries(ctx context.Context) ([]alertDelivery, map[int64]*NewsItem, error) {
+	rows, err := app.db.QueryContext(ctx, `SELECT id, alert_id, news_id, attempts FROM alert_deliveries
+		WHERE next_attempt <= CURRENT_TIMESTAMP ORDER BY id LIMIT ?`, exportBatchSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var deliveries []alertDelivery
+	var ids []string
+	for rows.Next() {
+		var delivery alertDelivery
+		if err := rows.Scan(&delivery.id, &delivery.alertID, &delivery.newsID, &delivery.attempts); err != nil {
+			return nil, nil, err
+		}
+		deliveries = append(deliveries, delivery)
+		ids = append(ids, strconv.FormatInt(delivery.newsID, 10))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+	items := make(map[int64]*NewsItem)
+	if len(ids) == 0 {
+		return deliveries, items, nil
+	}
+	// the ids are numbers read from the database
+	itemRows, err := app.db.QueryContext(ctx, "SELECT "+newsColumns(0)+" FROM news WHERE id IN ("+strings.Join(ids, ", ")+")")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		item, err := scanNewsItem(itemRows)
+		if err != nil {
+			return nil, nil, err
+		}
+		items[item.ID] = item
+	}
+	return deliveries, items, itemRows.Err()
+}
+
+func (app *NewsApp) finishAlertDeliveries(ctx context.Context, deliveries []alertDelivery) {
+	for _, delivery := range deliveries {
+		if _, err := app.db.ExecContext(ctx, "DELETE FROM alert_deliveries WHERE id = ?", delivery.id); err != nil {
+			slog.Error("unable to remove alert delivery", "id", delivery.id, "err", err)
+		}
+	}
+}
+
+func (app *NewsApp) retryAlertDeliveries(ctx context.Context, deliveries []alertDelivery, failure error) {
+	for _, delivery := range deliveries {
+		attempts := delivery.attempts + 1
+		if attempts >= maxAlertAttempts {
+			slog.Error("giving up alert delivery", "id", delivery.id, "attempts", attempts, "err", failure)
+			app.finishAlertDeliveries(ctx, []alertDelivery{delivery})
+			continue
+		}
+		next := time.Now().Add(alertRetryBackoff << (attempts - 1))
+		_, err := app.db.ExecContext(ctx, "UPDATE alert_deliveries SET attempts = ?, next_attempt = ?, last_error = ? WHERE id = ?",
+			attempts, next.UTC().Format(sqliteTimeLayout), failure.Error(), delivery.id)
+		if err != nil {
+			slog.Error("unable to reschedule alert delivery", "id", delivery.id, "err", err)
+		}
+	}
+}
+
+// alertsHandler manages the alerts. GET lists them, POST adds the alert of the
+// body and DELETE removes the one with the id parameter together with its
+// pending notifications.
+func (app *NewsApp) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeRulesJSON(w, http.StatusOK, app.alerts.list())
+	case http.MethodPost:
+		alert := new(Alert)
+		if err := json.NewDecoder(r.Body).Decode(alert); err != nil {
+			http.Error(w, fmt.Sprintf("error while reading the alert: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := alert.prepare(&app.config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := app.addAlert(r.Context(), alert); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeRulesJSON(w, http.StatusCreated, app.alerts.get(alert.ID))
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id must be the number of an alert", http.StatusBadRequest)
+			return
+		}
+		alert := app.alerts.get(id)
+		if alert == nil {
+			http.Error(w, fmt.Sprintf("no alert with id %d", id), http.StatusNotFound)
+			return
+		}
+		if err := app.deleteAlert(r.Context(), id); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeRulesJSON(w, http.StatusOK, alert)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// addAlert stores a prepared alert and sets its id
+func (app *NewsApp) addAlert(ctx context.Context, alert *Alert) error {
+	result, err := app.db.ExecContext(ctx, "INSERT INTO alerts(name, contains, pattern, channel, target) VALUES(?, ?, ?, ?, ?)",
+		alert.Name, nullString(alert.Contains), nullString(alert.Pattern), alert.Channel, alert.Target)
+	if err != nil {
+		return err
+	}
+	if alert.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	return app.loadAlerts()
+}
+
+func (app *NewsApp) deleteAlert(ctx context.Context, id int64) error {
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM alert_deliveries WHERE alert_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM alerts WHERE id = ?", id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return app.loadAlerts()
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,149 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+// userKey holds the user of a request, unconditionalKey marks the contexts
+// of requests sent without validators
+const (
+	userKey contextKey = iota
+	unconditionalKey
+)
+
+var (
+	errInvalidToken  = errors.New("invalid or expired token")
+	errInvalidAPIKey = errors.New("invalid API key or token")
+)
+
+// readOnlyUser is the user of requests authenticated by a -readKey or sent
+// without credentials with -publicRead, it reads as user 0 and may change
+// nothing
+var readOnlyUser = &User{Name: "reader"}
+
+// authRequired reports whether requests need credentials
+func (app *NewsApp) authRequired() bool {
+	return app.config.APIKey != "" || len(app.config.ReadAPIKeys) > 0 || app.hasUsers.Load()
+}
+
+// authenticate checks the token of a user session or else the API key, which
+// may also be sent as a bearer token. It returns the user of the session,
+// nil for the API key of an administrator or when no credentials are
+// configured, and readOnlyUser for a read key or -publicRead.
+func (app *NewsApp) authenticate(ctx context.Context, token, key string) (*User, error) {
+	invalid := errInvalidAPIKey
+	if token != "" {
+		user, err := app.sessionUser(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			return user, nil
+		}
+		key, invalid = token, errInvalidToken
+	}
+	if !app.authRequired() {
+		if token != "" {
+			return nil, errInvalidToken
+		}
+		return nil, nil
+	}
+	if key == "" && app.config.PublicRead {
+		return readOnlyUser, nil
+	}
+	if keyMatches(key, app.config.APIKey) {
+		return nil, nil
+	}
+	for _, readKey := range app.config.ReadAPIKeys {
+		if keyMatches(key, readKey) {
+			return readOnlyUser, nil
+		}
+	}
+	return nil, invalid
+}
+
+func keyMatches(key, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(key), []byte(want)) == 1
+}
+
+// isReadOnly reports whether the request may only read
+func isReadOnly(r *http.Request) bool {
+	return requestUser(r) == readOnlyUser
+}
+
+// requireAuth accepts requests with the token of a user session or the API
+// key. When neither a key nor users are configured the handler is not
+// protected.
+func (app *NewsApp) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			key = r.URL.Query().Get("key")
+		}
+		user, err := app.authenticate(r.Context(), requestToken(r), key)
+		if err == errInvalidToken || err == errInvalidAPIKey {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), userKey, user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin rejects the requests of users who are not administrators
+func (app *NewsApp) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user := requestUser(r); user == readOnlyUser {
+			http.Error(w, "administrators only", http.StatusUnauthorized)
+			return
+		} else if user != nil && !user.Admin {
+			http.Error(w, "administrators only", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestToken returns the bearer token of the Authorization header or the
+// token parameter used by feed readers
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
+// requestUser returns the user of the session, nil for requests authenticated
+// by the API key or without authentication
+func requestUser(r *http.Request) *User {
+	return contextUser(r.Context())
+}
+
+// contextUser returns the user authenticated for the context
+func contextUser(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey).(*User)
+	return user
+}
+
+// requestUserID returns the id of the user of the session, 0 is the reader
+// without an account
+func requestUserID(r *http.Request) int64 {
+	if user := requestUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
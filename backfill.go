@@ -0,0 +1,131 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// defaultMaxPages is the number of pages walked by the first update of a
+// rule with a nextPageRule and without maxPages
+const defaultMaxPages = 10
+
+// isBackfilled reports whether the initial fetch of a source was stored
+func (app *NewsApp) isBackfilled(url string) (bool, error) {
+	var backfilled bool
+	err := app.db.QueryRow("SELECT backfilled FROM sources WHERE url = ?", url).Scan(&backfilled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return backfilled, err
+}
+
+func (app *NewsApp) markBackfilled(url string) error {
+	_, err := app.db.Exec(`INSERT INTO sources(url, title, backfilled) VALUES(?, '', 1)
+		ON CONFLICT(url) DO UPDATE SET backfilled = 1`, url)
+	return err
+}
+
+// staggerTimestamps gives the items of the initial fetch of a source distinct
+// timestamps, so they do not sort as one block. The publication date is used
+// when known, otherwise the items get descending timestamps in page order.
+func staggerTimestamps(items []NewsItem, spacing time.Duration) {
+	now := time.Now().UTC()
+	for i := range items {
+		if items[i].Published != nil {
+			items[i].Timestamp = items[i].Published.UTC()
+		} else {
+			items[i].Timestamp = now.Add(-time.Duration(i) * spacing)
+		}
+	}
+}
+
+// orderForInsert reverses the items, so the bottommost item of the page comes
+// first and the topmost one is inserted last with the highest sequence number.
+// When every item has a publication date or a timestamp the reversed items are
+// then stably sorted by it, so items with equal times stay in reverse page
+// order and the topmost of them still gets the highest sequence number.
+func orderForInsert(items []NewsItem) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	for _, item := range items {
+		if itemTime(&item).IsZero() {
+			return
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return itemTime(&items[i]).Before(itemTime(&items[j]))
+	})
+}
+
+// itemTime returns the publication date of the item or its timestamp
+func itemTime(item *NewsItem) time.Time {
+	if item.Published != nil {
+		return *item.Published
+	}
+	return item.Timestamp
+}
+
+func (rule *ParsingRule) maxPages() uint {
+	if rule.MaxPages == 0 {
+		return defaultMaxPages
+	}
+	return rule.MaxPages
+}
+
+// nextPageURL returns the absolute link of the nextPageRule of the page, it is
+// empty when the page has none
+func nextPageURL(doc *html.Node, rule *ParsingRule, pageURL string) string {
+	link := strings.TrimSpace(extractValue(doc, rule.NextPageRule))
+	if link == "" {
+		return ""
+	}
+	next, err := convertToAbsURL(documentBase(doc, pageURL), link)
+	if err != nil {
+		slog.Warn("invalid next page link", "source", rule.URL, "link", link, "err", err)
+		return ""
+	}
+	return next
+}
+
+// loadOlderNews follows the next page links starting at stats.nextPage up to
+// the maxPages of the rule, counting the first page, and returns the items
+// of the older pages. A page failing to load ends the walk with the items
+// loaded so far.
+func (app *NewsApp) loadOlderNews(ctx context.Context, rule *ParsingRule, stats *ingestStats) []NewsItem {
+	var items []NewsItem
+	visited := map[string]bool{rule.URL: true}
+	next := stats.nextPage
+	for page := uint(2); page <= rule.maxPages() && next != "" && !visited[next]; page++ {
+		visited[next] = true
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			slog.Warn("unable to backfill page", "source", rule.URL, "page", next, "err", err)
+			break
+		}
+		doc, err := app.fetchPage(req, rule)
+		if err != nil {
+			slog.Warn("unable to backfill page", "source", rule.URL, "page", next, "err", err)
+			break
+		}
+		extracted, err := app.extractNews(rule, doc, stats)
+		if err == nil {
+			extracted, err = app.completeNews(ctx, rule, extracted, stats)
+		}
+		if err != nil {
+			slog.Warn("unable to extract backfilled page", "source", rule.URL, "page", next, "err", err)
+			break
+		}
+		slog.Info("backfilled page", "source", rule.URL, "page", next, "items", len(extracted))
+		items = append(items, extracted...)
+		next = nextPageURL(doc, rule, next)
+	}
+	return items
+}
@@ -0,0 +1,66 @@
+package aggregator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderForInsert(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		published := base.Add(time.Duration(minutes) * time.Minute)
+		return &published
+	}
+	tests := []struct {
+		name      string
+		published []*time.Time
+		// inserted are the page positions in insert order
+		inserted []int
+	}{
+		{"without times", []*time.Time{nil, nil, nil}, []int{2, 1, 0}},
+		{"some without times", []*time.Time{at(1), nil, at(3)}, []int{2, 1, 0}},
+		{"distinct times", []*time.Time{at(1), at(3), at(2)}, []int{0, 2, 1}},
+		{"equal times", []*time.Time{at(1), at(1), at(1)}, []int{2, 1, 0}},
+		{"equal and distinct times", []*time.Time{at(2), at(1), at(2), at(1)}, []int{3, 1, 2, 0}},
+	}
+	rule := &ParsingRule{URL: "https://example.com/"}
+	for _, test := range tests {
+		app := newTestApp(t)
+		items := make([]NewsItem, len(test.published))
+		for i, published := range test.published {
+			items[i] = NewsItem{Link: rule.URL + "news/" + string(rune('a'+i)), Title: "Story", Published: published, Source: rule.Source()}
+		}
+		page := append([]NewsItem(nil), items...)
+		orderForInsert(items)
+		inserted := make([]int, len(items))
+		for i, item := range items {
+			for position := range page {
+				if page[position].Link == item.Link {
+					inserted[i] = position
+				}
+			}
+		}
+		if !reflect.DeepEqual(inserted, test.inserted) {
+			t.Errorf("%s: inserted page positions %v, want %v", test.name, inserted, test.inserted)
+			continue
+		}
+		if err := app.storeNews(rule, items, new(ingestStats)); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := app.getNews(context.Background(), NewsFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != len(items) {
+			t.Fatalf("%s: got %d stored items, want %d", test.name, len(stored), len(items))
+		}
+		// the newest sequence number comes first
+		for i, item := range stored {
+			if want := items[len(items)-1-i].Link; item.Link != want {
+				t.Errorf("%s: item %d by seq is %s, want %s", test.name, i, item.Link, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cleonty/news-aggregator/storage"
+)
+
+// Backup writes a consistent copy of the database to the file, the updaters
+// of a server using the database may keep running
+func (app *NewsApp) Backup(filename string) error {
+	if filename == "" {
+		return fmt.Errorf("usage: backup <file>")
+	}
+	if err := app.openDatabase(); err != nil {
+		return err
+	}
+	defer app.db.Close()
+	return app.backupTo(app.ctx, filename)
+}
+
+func (app *NewsApp) backupTo(ctx context.Context, filename string) error {
+	defer app.metrics.observeQuery("backup", time.Now())
+	return storage.BackupFile(ctx, app.db, filename)
+}
+
+// backupHandler sends a consistent copy of the database taken while the
+// updaters keep running
+func (app *NewsApp) backupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir, err := os.MkdirTemp("", "news-backup")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "news.db")
+	if err := app.backupTo(r.Context(), filename); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="news-%s.db"`, time.Now().UTC().Format("20060102-150405")))
+	if info, err := file.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	io.Copy(w, file)
+}
@@ -0,0 +1,74 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+)
+
+// newsBatch stores the items of one update in a single transaction, so a
+// source returning many items costs one commit instead of one per item
+type newsBatch struct {
+	tx         *sql.Tx
+	insert     *sql.Stmt
+	update     *sql.Stmt
+	history    *sql.Stmt
+	seen       *sql.Stmt
+	cluster    *sql.Stmt
+	setCluster *sql.Stmt
+	queueAlert *sql.Stmt
+	// alerts counts the queued alert notifications
+	alerts int
+}
+
+func (app *NewsApp) beginNewsBatch(ctx context.Context) (*newsBatch, error) {
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	batch := &newsBatch{tx: tx}
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		// the sequence number is computed in the same statement so concurrent inserts can not get the same one
+		{&batch.insert, `INSERT OR IGNORE INTO news(link, title, metadata, rule_version, published, seq, timestamp, last_updated, source, summary, image, category, content, title_hash, language)
+		values(?, ?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM news), COALESCE(?6, CURRENT_TIMESTAMP), COALESCE(?6, CURRENT_TIMESTAMP), ?7, ?8, ?9, ?10, ?11, ?12, ?13)`},
+		// the history gets the stored title only when it is about to change
+		{&batch.history, "INSERT INTO title_history(news_id, title) SELECT id, title FROM news WHERE link = ?2 AND title <> ?1"},
+		{&batch.update, "UPDATE news SET title = ?1, title_hash = ?3, last_updated = CURRENT_TIMESTAMP WHERE link = ?2 AND title <> ?1"},
+		{&batch.seen, "SELECT hash FROM seen_links WHERE hash = ?"},
+		{&batch.cluster, "SELECT COALESCE(cluster_id, id), title_hash FROM news WHERE title_hash IS NOT NULL AND timestamp >= ? AND id <> ? ORDER BY seq DESC LIMIT ?"},
+		{&batch.setCluster, "UPDATE news SET cluster_id = ? WHERE id = ?"},
+		{&batch.queueAlert, "INSERT INTO alert_deliveries(alert_id, news_id) VALUES(?, ?)"},
+	}
+	for _, statement := range statements {
+		if *statement.stmt, err = tx.PrepareContext(ctx, statement.query); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return batch, nil
+}
+
+// isLinkSeen reports whether the link belongs to an item removed by compaction
+func (batch *newsBatch) isLinkSeen(ctx context.Context, link string) (bool, error) {
+	var hash int64
+	err := batch.seen.QueryRowContext(ctx, linkHash(link)).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// commit stores the items inserted so far, the statements are closed with the
+// transaction
+func (batch *newsBatch) commit() error {
+	return batch.tx.Commit()
+}
+
+func (batch *newsBatch) rollback() {
+	batch.tx.Rollback()
+}
@@ -2,7 +2,8 @@ import { Component, OnInit } from '@angular/core';
 import { HttpClient, HttpHeaders } from '@angular/common/http';
 import { Observable, Subject, of } from 'rxjs';
 import { NewsItem } from './news-item';
-import { debounceTime, distinctUntilChanged, switchMap,  } from 'rxjs/operators';
+import { NewsPage } from './news-page';
+import { debounceTime, distinctUntilChanged, map, switchMap,  } from 'rxjs/operators';
 
 @Component({
   selector: 'app-root',
@@ -30,6 +31,6 @@ export class AppComponent implements OnInit {
   }
 
   getNewsList(query: string): Observable<NewsItem[]> {
-    return (query.length > 0) ? this.http.get<NewsItem[]>(`${this.newsURL}?q=${query}`) : of(null);
+    return (query.length > 0) ? this.http.get<NewsPage>(`${this.newsURL}?q=${query}`).pipe(map((page: NewsPage) => page.items)) : of(null);
   }
 }
@@ -0,0 +1,8 @@
+import { NewsItem } from './news-item';
+
+export interface NewsPage {
+  total: number;
+  limit: number;
+  offset: number;
+  items: NewsItem[];
+}
@@ -0,0 +1,172 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// clusterDistance is the largest number of differing SimHash bits of
+	// titles of the same story
+	clusterDistance = 3
+	// clusterWindow and clusterCandidates limit the items a new item is
+	// compared with to the recent ones
+	clusterWindow     = 48 * time.Hour
+	clusterCandidates = 1000
+	// clusterMinWords is the number of words a title needs to be clustered,
+	// shorter titles are too alike to tell stories apart
+	clusterMinWords = 3
+)
+
+// clusterColumn is the cluster of a news row
+const clusterColumn = "COALESCE(news.cluster_id, news.id)"
+
+// titleWords returns the lowercased words of the title without punctuation
+func titleWords(title string) []string {
+	return strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// titleHash returns the SimHash of the words and word pairs of the title, so
+// titles differing in a word or two get hashes differing in a few bits. The
+// second result is false for titles too short to be clustered.
+func titleHash(title string) (uint64, bool) {
+	words := titleWords(title)
+	if len(words) < clusterMinWords {
+		return 0, false
+	}
+	var weights [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for i, word := range words {
+		add(word)
+		if i > 0 {
+			add(words[i-1] + " " + word)
+		}
+	}
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash, true
+}
+
+// findCluster returns the cluster of the most recent item other than id with
+// a title close to the hash, it is not valid when no recent item is close enough
+func (batch *newsBatch) findCluster(ctx context.Context, id int64, hash uint64) (sql.NullInt64, error) {
+	since := time.Now().Add(-clusterWindow).UTC().Format(sqliteTimeLayout)
+	rows, err := batch.cluster.QueryContext(ctx, since, id, clusterCandidates)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cluster, candidate int64
+		if err := rows.Scan(&cluster, &candidate); err != nil {
+			return sql.NullInt64{}, err
+		}
+		if bits.OnesCount64(hash^uint64(candidate)) <= clusterDistance {
+			return sql.NullInt64{Int64: cluster, Valid: true}, nil
+		}
+	}
+	return sql.NullInt64{}, rows.Err()
+}
+
+// joinCluster adds the inserted item to the cluster of a close title, it is
+// left heading its own cluster when there is none. Only new items are
+// compared, so the links already stored cost no query.
+func (batch *newsBatch) joinCluster(ctx context.Context, id int64, hash uint64) error {
+	cluster, err := batch.findCluster(ctx, id, hash)
+	if err != nil || !cluster.Valid {
+		return err
+	}
+	_, err = batch.setCluster.ExecContext(ctx, cluster.Int64, id)
+	return err
+}
+
+// groupNews reads one item per cluster of the matching items, the first seen
+// one, with the size and the member links of its cluster
+func (app *NewsApp) groupNews(ctx context.Context, filter NewsFilter, order string) ([]NewsItem, error) {
+	from, args := app.newsSelection(filter)
+	// SQLite takes the bare columns of each group from the row of MIN(seq)
+	statement := "SELECT " + newsColumns(filter.userID) + ", COUNT(*), MIN(seq), " + clusterColumn + from +
+		" GROUP BY " + clusterColumn + " ORDER BY " + order
+	if filter.Limit > 0 {
+		statement += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	rows, err := app.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]NewsItem, 0)
+	var clusters []int64
+	for rows.Next() {
+		var first, cluster int64
+		var size int
+		item, err := scanNewsItem(rows, &size, &first, &cluster)
+		if err != nil {
+			return nil, err
+		}
+		item.ClusterSize = size
+		items = append(items, *item)
+		clusters = append(clusters, cluster)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(clusters) == 0 {
+		return items, nil
+	}
+	links, err := app.clusterLinks(ctx, filter, clusters)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].ClusterLinks = links[clusters[i]]
+	}
+	return items, nil
+}
+
+// clusterLinks returns the links of the matching items of the clusters in the
+// order they were seen
+func (app *NewsApp) clusterLinks(ctx context.Context, filter NewsFilter, clusters []int64) (map[int64][]string, error) {
+	filter.clusters = clusters
+	from, args := app.newsSelection(filter)
+	rows, err := app.db.QueryContext(ctx, "SELECT "+clusterColumn+", link"+from+" ORDER BY seq", args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the links of clusters: %v", err)
+	}
+	defer rows.Close()
+	links := make(map[int64][]string, len(clusters))
+	for rows.Next() {
+		var cluster int64
+		var link string
+		if err := rows.Scan(&cluster, &link); err != nil {
+			return nil, err
+		}
+		links[cluster] = append(links[cluster], link)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	aggregator "github.com/cleonty/news-aggregator"
+)
+
+// command is a mode of the binary selected by the first argument, the flags
+// follow it
+type command struct {
+	description string
+	run         func(app *aggregator.NewsApp, port uint) error
+}
+
+var commands = map[string]command{
+	"serve": {"poll the sources and serve the API and the web client (the default)", func(app *aggregator.NewsApp, port uint) error {
+		return app.Start(port)
+	}},
+	"fetch-once": {"update every source one time and exit, fails when a source fails", func(app *aggregator.NewsApp, port uint) error {
+		return app.FetchOnce()
+	}},
+	"validate-rules": {"check the rules file including its XPath expressions and exit", func(app *aggregator.NewsApp, port uint) error {
+		return app.ValidateRules(os.Stdout)
+	}},
+	"export": {"write all stored items to the standard output as NDJSON", func(app *aggregator.NewsApp, port uint) error {
+		return app.Export(os.Stdout)
+	}},
+	"backup": {"write a consistent copy of the database to the file given as the argument, also while a server uses it", func(app *aggregator.NewsApp, port uint) error {
+		return app.Backup(flag.Arg(0))
+	}},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [command] [flags]\n\ncommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-16s%s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(out, "\nflags:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// stringList is a flag value collecting every occurrence of a flag
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// commaList splits a comma-separated flag value, blank elements are dropped
+func commaList(value string) []string {
+	var list []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
+
+// envPrefix starts the names of environment variables setting flags, e.g.
+// NEWS_RETENTION_DAYS sets -retentionDays
+const envPrefix = "NEWS_"
+
+// envName returns the environment variable of a flag
+func envName(flagName string) string {
+	var name strings.Builder
+	name.WriteString(envPrefix)
+	var previous rune
+	for _, r := range flagName {
+		switch {
+		case r == '-':
+			name.WriteRune('_')
+		case unicode.IsUpper(r) && unicode.IsLower(previous):
+			name.WriteRune('_')
+			name.WriteRune(r)
+		default:
+			name.WriteRune(unicode.ToUpper(r))
+		}
+		previous = r
+	}
+	return name.String()
+}
+
+// applyConfigSources sets the flags not given on the command line from the
+// environment and then from the file of the -config flag, if any. The command
+// line takes precedence over the environment and the environment over the file.
+func applyConfigSources(flags *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || explicit[f.Name] || err != nil {
+			return
+		}
+		if err = f.Value.Set(value); err != nil {
+			err = fmt.Errorf("invalid %s: %v", envName(f.Name), err)
+			return
+		}
+		explicit[f.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+	configFile := flags.Lookup("config").Value.String()
+	if configFile == "" {
+		return nil
+	}
+	return applyConfigFile(flags, configFile, explicit)
+}
+
+// applyConfigFile sets flags from a JSON object of flag names and values, a
+// list sets a repeatable flag several times
+func applyConfigFile(flags *flag.FlagSet, filename string, explicit map[string]bool) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("error while reading config %s: %v", filename, err)
+	}
+	for name, value := range values {
+		f := flags.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("unknown setting %q in config %s", name, filename)
+		}
+		if explicit[name] {
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for _, element := range list {
+			if err := f.Value.Set(fmt.Sprint(element)); err != nil {
+				return fmt.Errorf("invalid %q in config %s: %v", name, filename, err)
+			}
+		}
+	}
+	return nil
+}
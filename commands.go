@@ -0,0 +1,91 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// FetchOnce runs one update of every source, at most MaxConcurrentFetches at
+// once, and returns an error when any of them failed
+func (app *NewsApp) FetchOnce() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	app.ctx = ctx
+	stopTracing, err := app.setupTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+	if err := app.open(); err != nil {
+		return err
+	}
+	defer app.db.Close()
+	workers, stopWorkers := context.WithCancel(ctx)
+	app.startWorkers(workers)
+	var wg sync.WaitGroup
+	for _, rule := range app.parsingRules {
+		if !rule.enabled() {
+			continue
+		}
+		wg.Add(1)
+		if !app.pool.submit(fetchJob{ctx: ctx, rule: rule, done: wg.Done}) {
+			wg.Done()
+		}
+	}
+	wg.Wait()
+	stopWorkers()
+	app.background.Wait()
+	app.deliverAlerts(ctx)
+	failed := 0
+	for _, rule := range app.parsingRules {
+		if status := app.statuses.report(rule.URL, 0); status.LastErrorTime != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sources failed", failed, len(app.parsingRules))
+	}
+	return nil
+}
+
+// ValidateRules loads the rules file the way the server does, which checks
+// the rules and compiles their expressions
+func (app *NewsApp) ValidateRules(out io.Writer) error {
+	rules, err := loadParsingRules(app.config.RulesFile)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: %d valid rules\n", app.config.RulesFile, len(rules))
+	return nil
+}
+
+// Export writes all items in id order as NDJSON like /export/stream
+func (app *NewsApp) Export(out io.Writer) error {
+	if err := app.openDatabase(); err != nil {
+		return err
+	}
+	defer app.db.Close()
+	encoder := json.NewEncoder(out)
+	var sinceID int64
+	for {
+		items, err := app.exportBatch(app.ctx, sinceID)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+			sinceID = item.ID
+		}
+		if len(items) < exportBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const compactBatchSize = 500
+
+// linkHash returns a short hash of a link kept in the seen_links table
+func linkHash(link string) int64 {
+	sum := sha1.Sum([]byte(link))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+func (app *NewsApp) compactPeriodically(ctx context.Context) {
+	interval := app.config.CompactRetention / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		count, err := app.compactNews(app.config.CompactRetention)
+		if err != nil {
+			slog.Error("unable to compact news", "err", err)
+		} else if count > 0 {
+			slog.Info("compacted news", "items", count)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// compactNews replaces items older than the retention with hashes of their
+// links so that the links are still recognized as duplicates, starred items
+// are kept
+func (app *NewsApp) compactNews(retention time.Duration) (int, error) {
+	cutoff := fmt.Sprintf("-%d seconds", int64(retention/time.Second))
+	total := 0
+	for {
+		count, err := app.compactNewsBatch(cutoff)
+		if err != nil {
+			return total, err
+		}
+		total += count
+		if count < compactBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (app *NewsApp) compactNewsBatch(cutoff string) (int, error) {
+	tx, err := app.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query("SELECT id, link FROM news WHERE timestamp < datetime('now', ?) AND NOT "+starredByAnyone+" LIMIT ?", cutoff, compactBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	var links []string
+	for rows.Next() {
+		var id int64
+		var link string
+		if err := rows.Scan(&id, &link); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		links = append(links, link)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO seen_links(hash) VALUES(?)", linkHash(links[i])); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("DELETE FROM news WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,82 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// errNotModified is returned for a rule page that did not change since the
+// previous update
+var errNotModified = errors.New("not modified")
+
+// pageValidators remembers the ETag and Last-Modified headers of the rule
+// pages, so unchanged pages are answered with 304 instead of the whole page
+type pageValidators struct {
+	mu    sync.Mutex
+	pages map[string]pageValidator
+}
+
+type pageValidator struct {
+	etag         string
+	lastModified string
+}
+
+// validatorKey includes the version of the rule, a changed rule downloads
+// the page again to extract it with the new rule
+func validatorKey(rule *ParsingRule) string {
+	return rule.Version() + " " + rule.URL
+}
+
+// isConditional tells whether the request is the plain GET of the rule page,
+// only those are sent with validators
+func isConditional(req *http.Request, rule *ParsingRule) bool {
+	return req.Method == http.MethodGet && rule.Body == "" && req.URL.String() == rule.URL &&
+		req.Context().Value(unconditionalKey) == nil
+}
+
+// withoutValidators makes the requests with the context neither use nor
+// replace the validators of the updates
+func withoutValidators(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unconditionalKey, true)
+}
+
+// apply sets the conditional headers from the previous response of the page
+func (v *pageValidators) apply(req *http.Request, rule *ParsingRule) {
+	v.mu.Lock()
+	validator, ok := v.pages[validatorKey(rule)]
+	v.mu.Unlock()
+	if !ok {
+		return
+	}
+	if validator.etag != "" {
+		req.Header.Set("If-None-Match", validator.etag)
+	}
+	if validator.lastModified != "" {
+		req.Header.Set("If-Modified-Since", validator.lastModified)
+	}
+}
+
+// store remembers the validators of a successful response of the page
+func (v *pageValidators) store(resp *http.Response, rule *ParsingRule) {
+	validator := pageValidator{resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if validator == (pageValidator{}) {
+		delete(v.pages, validatorKey(rule))
+		return
+	}
+	if v.pages == nil {
+		v.pages = make(map[string]pageValidator)
+	}
+	v.pages[validatorKey(rule)] = validator
+}
+
+// forget drops the validators of the page, so its next update downloads it
+// even when it did not change, e.g. after its items could not be stored
+func (v *pageValidators) forget(rule *ParsingRule) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.pages, validatorKey(rule))
+}
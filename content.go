@@ -0,0 +1,230 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/cleonty/news-aggregator/storage"
+	"golang.org/x/net/html"
+)
+
+// minContentLength is the length of text a node needs to be taken for the
+// article body by the text density search
+const minContentLength = 200
+
+// skippedContentElements never hold the body of an article
+var skippedContentElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "nav": true, "aside": true,
+	"footer": true, "header": true, "form": true, "iframe": true, "svg": true,
+}
+
+// blockElements separate paragraphs of the extracted text
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "blockquote": true, "pre": true,
+	"section": true, "article": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "tr": true, "figcaption": true,
+}
+
+// extractContent returns the article body of an item page, found by the
+// content rule or, without one, by the text density of the page
+func extractContent(doc *html.Node, rule *ParsingRule) string {
+	if rule.ContentRule == nil {
+		return readableContent(doc)
+	}
+	return extractContentRule(doc, rule.ContentRule)
+}
+
+func extractContentRule(doc *html.Node, rule *ExtractRule) string {
+	if node := findOne(doc, rule.expr()); node != nil {
+		var text string
+		if rule.Attribute != "" {
+			text = strings.TrimSpace(htmlquery.SelectAttr(node, rule.Attribute))
+		} else {
+			text = articleText(node)
+		}
+		if text != "" {
+			return text
+		}
+	}
+	for i := range rule.Alternatives {
+		if text := extractContentRule(doc, &rule.Alternatives[i]); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// readableContent finds the body of an article the way readability tools do:
+// the longest article element or else the element whose paragraphs hold the
+// most text
+func readableContent(doc *html.Node) string {
+	var best string
+	for _, node := range find(doc, "//article") {
+		if text := articleText(node); len(text) > len(best) {
+			best = text
+		}
+	}
+	if len(best) >= minContentLength {
+		return best
+	}
+	var bestNode *html.Node
+	bestScore := 0
+	for _, node := range find(doc, "//*[p]") {
+		score := 0
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.ElementNode && child.Data == "p" {
+				score += len(collapseSpace(htmlquery.InnerText(child)))
+			}
+		}
+		if score > bestScore {
+			bestNode, bestScore = node, score
+		}
+	}
+	if bestScore < minContentLength {
+		return best
+	}
+	return articleText(bestNode)
+}
+
+// articleText returns the text of a node with paragraphs separated by blank
+// lines, skipping scripts, navigation and similar elements
+func articleText(node *html.Node) string {
+	var paragraphs []string
+	var current strings.Builder
+	flush := func() {
+		if text := collapseSpace(current.String()); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+		current.Reset()
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			current.WriteString(n.Data)
+			current.WriteByte(' ')
+			return
+		case html.ElementNode:
+			if skippedContentElements[n.Data] {
+				return
+			}
+		}
+		block := n.Type == html.ElementNode && blockElements[n.Data]
+		if block {
+			flush()
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			flush()
+		}
+	}
+	walk(node)
+	flush()
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// contentValue returns the value stored in the content column, gzipped when
+// compression is enabled and NULL for an empty body
+func (app *NewsApp) contentValue(content string) (interface{}, error) {
+	if content == "" {
+		return nil, nil
+	}
+	if !app.config.CompressContent {
+		return content, nil
+	}
+	return storage.Compress(content)
+}
+
+// summaryValue returns the value stored in the summary column, gzipped when
+// compression is enabled and that makes it shorter
+func (app *NewsApp) summaryValue(summary string) (interface{}, error) {
+	if !app.config.CompressSummary || summary == "" {
+		return summary, nil
+	}
+	compressed, err := storage.Compress(summary)
+	if err != nil || len(compressed) >= len(summary) {
+		return summary, err
+	}
+	return compressed, nil
+}
+
+// getNewsItem returns the item with the id including its content, nil when
+// there is no such item
+func (app *NewsApp) getNewsItem(ctx context.Context, id int64, userID int64) (*NewsItem, error) {
+	rows, err := app.db.QueryContext(ctx, "SELECT "+newsColumns(userID)+" FROM news WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	item, err := scanNewsItem(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+	var content []byte
+	err = app.db.QueryRowContext(ctx, "SELECT content FROM news WHERE id = ?", id).Scan(&content)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if item.Content, err = storage.Decompress(content); err != nil {
+		return nil, fmt.Errorf("unable to decode content of item %d: %v", id, err)
+	}
+	if item.TitleHistory, err = app.titleHistory(ctx, id); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// titleHistory returns the previous titles of the item, newest first
+func (app *NewsApp) titleHistory(ctx context.Context, id int64) ([]TitleChange, error) {
+	rows, err := app.db.QueryContext(ctx, "SELECT title, changed FROM title_history WHERE news_id = ? ORDER BY id DESC", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var history []TitleChange
+	for rows.Next() {
+		var change TitleChange
+		if err := rows.Scan(&change.Title, &change.Changed); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// itemHandler serves /news/{id}, the item with its content
+func (app *NewsApp) itemHandler(w http.ResponseWriter, r *http.Request, value string) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		http.Error(w, "the item id must be a number", http.StatusBadRequest)
+		return
+	}
+	item, err := app.getNewsItem(r.Context(), id, requestUserID(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if item == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(item); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
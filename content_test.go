@@ -0,0 +1,67 @@
+package aggregator
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompressedColumns(t *testing.T) {
+	long := "Zeppelin " + strings.Repeat("a summary long enough to be shorter when it is compressed. ", 5)
+	tests := []struct {
+		name            string
+		compressSummary bool
+		compressContent bool
+		summary         string
+		gzippedSummary  bool
+	}{
+		{"plain", false, false, long, false},
+		{"compressed", true, true, long, true},
+		{"short summary stays plain", true, false, "Zebra", false},
+		{"empty summary", true, false, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.config.CompressSummary = test.compressSummary
+			app.config.CompressContent = test.compressContent
+			rule := &ParsingRule{URL: "https://example.com/"}
+			items := []NewsItem{{Link: "https://example.com/a", Title: "Compressed columns", Summary: test.summary, Content: long}}
+			var stats ingestStats
+			if err := app.storeNews(rule, items, &stats); err != nil {
+				t.Fatal(err)
+			}
+			var stored []byte
+			if err := app.db.QueryRow("SELECT summary FROM news").Scan(&stored); err != nil {
+				t.Fatal(err)
+			}
+			if gzipped := len(stored) > 1 && stored[0] == 0x1f && stored[1] == 0x8b; gzipped != test.gzippedSummary {
+				t.Errorf("the stored summary is gzipped: %v, want %v", gzipped, test.gzippedSummary)
+			}
+			found, err := app.getNews(context.Background(), NewsFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != 1 || found[0].Summary != test.summary {
+				t.Fatalf("got items %+v", found)
+			}
+			item, err := app.getNewsItem(context.Background(), found[0].ID, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Summary != test.summary || item.Content != long {
+				t.Errorf("got summary %q and content %q", item.Summary, item.Content)
+			}
+			if !app.fts || test.summary == "" {
+				return
+			}
+			matches, err := app.getNews(context.Background(), NewsFilter{Query: strings.Fields(test.summary)[0]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matches) != 1 {
+				t.Errorf("the full-text search found %d items in the summary", len(matches))
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package aggregator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// compileSelectors translates the CSS selectors of the rule to XPath
+func (rule *ParsingRule) compileSelectors() error {
+	var err error
+	if rule.NewsNodesSelector != "" {
+		if rule.newsNodesSelectorExpr, err = cssToXPath(rule.NewsNodesSelector); err != nil {
+			return err
+		}
+	}
+	for _, extract := range []*ExtractRule{&rule.LinkRule, &rule.TitleRule, rule.SummaryRule, rule.ImageRule, rule.DateRule, rule.ContentRule} {
+		if err := extract.compileSelectors(); err != nil {
+			return err
+		}
+	}
+	// the compiled rules go to new maps, the maps of the rule may be shared
+	// with a copy of it
+	for _, rules := range []*map[string]ExtractRule{&rule.MetadataRules, &rule.DetailRules} {
+		if *rules == nil {
+			continue
+		}
+		compiled := make(map[string]ExtractRule, len(*rules))
+		for name, extract := range *rules {
+			if err := extract.compileSelectors(); err != nil {
+				return err
+			}
+			compiled[name] = extract
+		}
+		*rules = compiled
+	}
+	return nil
+}
+
+// compileSelectors translates the selectors of the rule and its alternatives,
+// a nil rule has none
+func (rule *ExtractRule) compileSelectors() error {
+	if rule == nil {
+		return nil
+	}
+	if rule.Selector != "" {
+		expr, err := cssToXPath(rule.Selector)
+		if err != nil {
+			return err
+		}
+		rule.selectorExpr = expr
+	}
+	rule.Alternatives = append([]ExtractRule(nil), rule.Alternatives...)
+	for i := range rule.Alternatives {
+		if err := rule.Alternatives[i].compileSelectors(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cssToXPath translates a CSS selector to an XPath expression selecting the
+// same nodes below the context node, so selectors are evaluated like the
+// expressions of the rules. Supported are type, universal, id, class and
+// attribute selectors, the combinators " ", ">", "+" and "~", selector
+// lists and the pseudo-classes :first-child, :last-child, :only-child,
+// :nth-child(n|odd|even), :first-of-type, :last-of-type, :not(...) and
+// :contains("text"). A selector may start with ">" to select children of the
+// context node.
+func cssToXPath(selector string) (string, error) {
+	p := &cssParser{input: []rune(selector)}
+	var alternatives []string
+	for {
+		expr, err := p.complex()
+		if err != nil {
+			return "", fmt.Errorf("selector %q: %v", selector, err)
+		}
+		alternatives = append(alternatives, expr)
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		if p.peek() != ',' {
+			return "", fmt.Errorf("selector %q: unexpected %q at %d", selector, p.peek(), p.pos)
+		}
+		p.pos++
+	}
+	return strings.Join(alternatives, " | "), nil
+}
+
+type cssParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *cssParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *cssParser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// skipSpace skips white space and reports whether there was any
+func (p *cssParser) skipSpace() bool {
+	start := p.pos
+	for !p.done() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// complex parses compound selectors joined by combinators
+func (p *cssParser) complex() (string, error) {
+	p.skipSpace()
+	axis := ".//"
+	if p.peek() == '>' {
+		p.pos++
+		p.skipSpace()
+		axis = "./"
+	}
+	var expr strings.Builder
+	for {
+		step, err := p.compound(axis)
+		if err != nil {
+			return "", err
+		}
+		expr.WriteString(step)
+		space := p.skipSpace()
+		switch p.peek() {
+		case '>':
+			axis = "/"
+		case '+':
+			axis = "/following-sibling::*[1]/self::"
+		case '~':
+			axis = "/following-sibling::"
+		case ',', 0:
+			return expr.String(), nil
+		default:
+			if !space {
+				return "", fmt.Errorf("unexpected %q at %d", p.peek(), p.pos)
+			}
+			axis = "//"
+			continue
+		}
+		p.pos++
+		p.skipSpace()
+	}
+}
+
+// compound parses a type selector followed by conditions
+func (p *cssParser) compound(axis string) (string, error) {
+	name, conditions, err := p.conditions()
+	if err != nil {
+		return "", err
+	}
+	if name == "" && len(conditions) == 0 {
+		if p.done() {
+			return "", fmt.Errorf("selector ends unexpectedly")
+		}
+		return "", fmt.Errorf("unexpected %q at %d", p.peek(), p.pos)
+	}
+	if name == "" {
+		name = "*"
+	}
+	return axis + name + strings.Join(conditions, ""), nil
+}
+
+// conditions parses the element name, "" when absent, and the predicates of
+// a compound selector
+func (p *cssParser) conditions() (string, []string, error) {
+	var name string
+	if p.peek() == '*' {
+		p.pos++
+		name = "*"
+	} else if isCSSNameRune(p.peek()) {
+		name = strings.ToLower(p.ident())
+	}
+	var conditions []string
+	for !p.done() {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			id := p.ident()
+			if id == "" {
+				return "", nil, fmt.Errorf("empty id at %d", p.pos)
+			}
+			conditions = append(conditions, "[@id="+xpathLiteral(id)+"]")
+		case '.':
+			p.pos++
+			class := p.ident()
+			if class == "" {
+				return "", nil, fmt.Errorf("empty class at %d", p.pos)
+			}
+			conditions = append(conditions, "["+containsWord("@class", class)+"]")
+		case '[':
+			p.pos++
+			condition, err := p.attribute()
+			if err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, "["+condition+"]")
+		case ':':
+			p.pos++
+			condition, err := p.pseudo(name)
+			if err != nil {
+				return "", nil, err
+			}
+			conditions = append(conditions, "["+condition+"]")
+		default:
+			return name, conditions, nil
+		}
+	}
+	return name, conditions, nil
+}
+
+func isCSSNameRune(r rune) bool {
+	return r == '-' || r == '_' || r == '\\' || unicode.IsLetter(r) || unicode.IsDigit(r) || r > 0x7f
+}
+
+// ident parses a name, backslash escapes their next character
+func (p *cssParser) ident() string {
+	var name strings.Builder
+	for !p.done() && isCSSNameRune(p.peek()) {
+		if p.peek() == '\\' && p.pos+1 < len(p.input) {
+			p.pos++
+		}
+		name.WriteRune(p.peek())
+		p.pos++
+	}
+	return name.String()
+}
+
+// value parses a quoted string or a name
+func (p *cssParser) value() (string, error) {
+	quote := p.peek()
+	if quote != '"' && quote != '\'' {
+		return p.ident(), nil
+	}
+	p.pos++
+	var value strings.Builder
+	for !p.done() && p.peek() != quote {
+		if p.peek() == '\\' && p.pos+1 < len(p.input) {
+			p.pos++
+		}
+		value.WriteRune(p.peek())
+		p.pos++
+	}
+	if p.done() {
+		return "", fmt.Errorf("unterminated string")
+	}
+	p.pos++
+	return value.String(), nil
+}
+
+// attribute parses [name], [name=value] and the other operators up to the
+// closing bracket
+func (p *cssParser) attribute() (string, error) {
+	p.skipSpace()
+	name := strings.ToLower(p.ident())
+	if name == "" {
+		return "", fmt.Errorf("empty attribute name at %d", p.pos)
+	}
+	attr := "@" + name
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return attr, nil
+	}
+	var operator string
+	if p.peek() == '=' {
+		operator = "="
+		p.pos++
+	} else if p.pos+1 < len(p.input) && p.input[p.pos+1] == '=' && strings.ContainsRune("~^$*|", p.peek()) {
+		operator = string(p.peek()) + "="
+		p.pos += 2
+	} else {
+		return "", fmt.Errorf("unexpected %q in attribute selector at %d", p.peek(), p.pos)
+	}
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return "", err
+	}
+	p.skipSpace()
+	if p.peek() != ']' {
+		return "", fmt.Errorf("expected ] at %d", p.pos)
+	}
+	p.pos++
+	literal := xpathLiteral(value)
+	switch operator {
+	case "~=":
+		return containsWord(attr, value), nil
+	case "^=":
+		return fmt.Sprintf("starts-with(%s, %s)", attr, literal), nil
+	case "$=":
+		return fmt.Sprintf("substring(%s, string-length(%s) - string-length(%s) + 1) = %s", attr, attr, literal, literal), nil
+	case "*=":
+		return fmt.Sprintf("contains(%s, %s)", attr, literal), nil
+	case "|=":
+		return fmt.Sprintf("(%s = %s or starts-with(%s, %s))", attr, literal, attr, xpathLiteral(value+"-")), nil
+	}
+	return attr + " = " + literal, nil
+}
+
+// pseudo parses a pseudo-class of an element with the name
+func (p *cssParser) pseudo(name string) (string, error) {
+	pseudo := strings.ToLower(p.ident())
+	var argument string
+	if p.peek() == '(' {
+		p.pos++
+		start, depth := p.pos, 1
+		for ; !p.done(); p.pos++ {
+			if p.peek() == '(' {
+				depth++
+			} else if p.peek() == ')' {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		if p.done() {
+			return "", fmt.Errorf("unterminated :%s(", pseudo)
+		}
+		argument = strings.TrimSpace(string(p.input[start:p.pos]))
+		p.pos++
+	}
+	sibling := "*"
+	if name != "" {
+		sibling = name
+	}
+	switch pseudo {
+	case "first-child":
+		return "not(preceding-sibling::*)", nil
+	case "last-child":
+		return "not(following-sibling::*)", nil
+	case "only-child":
+		return "not(preceding-sibling::*) and not(following-sibling::*)", nil
+	case "first-of-type":
+		return "not(preceding-sibling::" + sibling + ")", nil
+	case "last-of-type":
+		return "not(following-sibling::" + sibling + ")", nil
+	case "nth-child":
+		switch strings.ToLower(argument) {
+		case "odd":
+			return "count(preceding-sibling::*) mod 2 = 0", nil
+		case "even":
+			return "count(preceding-sibling::*) mod 2 = 1", nil
+		}
+		n, err := strconv.Atoi(argument)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf(":nth-child supports a position, odd or even, got %q", argument)
+		}
+		return fmt.Sprintf("count(preceding-sibling::*) = %d", n-1), nil
+	case "not":
+		inner := &cssParser{input: []rune(argument)}
+		innerName, conditions, err := inner.conditions()
+		if err != nil {
+			return "", fmt.Errorf(":not(%s): %v", argument, err)
+		}
+		if !inner.done() || (innerName == "" && len(conditions) == 0) {
+			return "", fmt.Errorf(":not supports one compound selector, got %q", argument)
+		}
+		if innerName == "" {
+			innerName = "*"
+		}
+		return "not(self::" + innerName + strings.Join(conditions, "") + ")", nil
+	case "contains":
+		text, err := (&cssParser{input: []rune(argument)}).value()
+		if err != nil {
+			return "", fmt.Errorf(":contains(%s): %v", argument, err)
+		}
+		return "contains(., " + xpathLiteral(text) + ")", nil
+	}
+	return "", fmt.Errorf("unsupported pseudo-class :%s", pseudo)
+}
+
+// containsWord tests whether a space separated attribute contains the word
+func containsWord(attr, word string) string {
+	return fmt.Sprintf("contains(concat(' ', normalize-space(%s), ' '), %s)", attr, xpathLiteral(" "+word+" "))
+}
+
+// xpathLiteral quotes the value as an XPath string, which has no escapes
+func xpathLiteral(value string) string {
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	if !strings.Contains(value, `"`) {
+		return `"` + value + `"`
+	}
+	parts := strings.Split(value, "'")
+	return "concat('" + strings.Join(parts, `', "'", '`) + "')"
+}
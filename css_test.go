@@ -0,0 +1,24 @@
+package aggregator
+
+import "testing"
+
+func TestCompileSelectorsKeepsSharedRules(t *testing.T) {
+	live := &ParsingRule{
+		DetailRules: map[string]ExtractRule{
+			"author": {Selector: ".author", Alternatives: []ExtractRule{{Selector: ".byline"}}},
+		},
+		SummaryRule: &ExtractRule{XPathExpr: "p"},
+	}
+	copied := *live
+	if err := copied.compileSelectors(); err != nil {
+		t.Fatal(err)
+	}
+	compiled := copied.DetailRules["author"]
+	if compiled.expr() == "" || compiled.Alternatives[0].expr() == "" {
+		t.Fatalf("the selectors of the copy are not compiled: %+v", compiled)
+	}
+	shared := live.DetailRules["author"]
+	if shared.selectorExpr != "" || shared.Alternatives[0].selectorExpr != "" {
+		t.Errorf("compiling the copy changed the shared detail rules: %+v", shared)
+	}
+}
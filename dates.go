@@ -0,0 +1,78 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sqliteTimeLayout is the layout of CURRENT_TIMESTAMP values
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+var defaultDateLayouts = DateLayouts{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// DateLayouts is a list of time layouts tried in order. In rules it can be
+// specified either as a single string or as an array of strings.
+type DateLayouts []string
+
+// UnmarshalJSON accepts both a string and an array of strings
+func (layouts *DateLayouts) UnmarshalJSON(data []byte) error {
+	var layout string
+	if err := json.Unmarshal(data, &layout); err == nil {
+		*layouts = DateLayouts{layout}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("date format must be a string or an array of strings: %v", err)
+	}
+	*layouts = list
+	return nil
+}
+
+// dateStats counts how the dates of one fetch were parsed
+type dateStats struct {
+	matched     map[string]int
+	unparseable int
+}
+
+func newDateStats() *dateStats {
+	return &dateStats{matched: make(map[string]int)}
+}
+
+// parse tries the layouts in order and returns nil when none of them matches
+func (stats *dateStats) parse(value string, layouts DateLayouts) *time.Time {
+	value = strings.TrimSpace(value)
+	if len(layouts) == 0 {
+		layouts = defaultDateLayouts
+	}
+	if value != "" {
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				stats.matched[layout]++
+				return &t
+			}
+		}
+	}
+	stats.unparseable++
+	return nil
+}
+
+func (stats *dateStats) log(source string) {
+	var matched []string
+	for layout, count := range stats.matched {
+		matched = append(matched, fmt.Sprintf("%q: %d", layout, count))
+	}
+	sort.Strings(matched)
+	slog.Info("parsed dates", "source", source, "layouts", "{"+strings.Join(matched, ", ")+"}", "unparseable", stats.unparseable)
+}
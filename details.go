@@ -0,0 +1,124 @@
+package aggregator
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// fetchDetails fetches the pages of the items that are not stored yet and
+// stores fields extracted by the detail rules in their metadata and the
+// article body in their content. With pageMetadata the empty fields of the
+// items are taken from the page too. Up to
+// rule.DetailConcurrency pages are fetched at once. A failed page leaves its
+// item without the detail fields.
+func (app *NewsApp) fetchDetails(ctx context.Context, rule *ParsingRule, items []NewsItem, stats *ingestStats) {
+	concurrency := rule.DetailConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	detailed := len(rule.DetailRules) > 0 || rule.FetchContent
+	for i := range items {
+		if !detailed && !missingPageFields(&items[i]) {
+			continue
+		}
+		if stored, err := app.isStored(items[i].Link); err != nil || stored {
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(item *NewsItem) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			fields, content, meta, err := app.extractDetails(ctx, rule, item.Link)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				stats.detailErrors++
+				slog.Warn("unable to fetch details", "source", rule.URL, "link", item.Link, "err", err)
+				return
+			}
+			item.Content = content
+			if rule.PageMetadata {
+				fillFromPage(item, meta)
+			}
+			if len(fields) > 0 && item.Metadata == nil {
+				item.Metadata = make(map[string]string)
+			}
+			for name, value := range fields {
+				item.Metadata[name] = value
+			}
+		}(&items[i])
+	}
+	wg.Wait()
+}
+
+// filterPageTitled drops the items of the links in untitled that got no
+// title from their pages and filters the others, which were kept unfiltered
+// without a title
+func (app *NewsApp) filterPageTitled(rule *ParsingRule, items []NewsItem, untitled map[string]bool, stats *ingestStats) ([]NewsItem, error) {
+	var result []NewsItem
+	for _, item := range items {
+		if !untitled[item.Link] {
+			result = append(result, item)
+			continue
+		}
+		if item.Title == "" {
+			// a stored item keeps the title it got when its page was read
+			if stored, err := app.isStored(item.Link); err == nil && stored {
+				stats.duplicates++
+			} else {
+				stats.skippedEmpty++
+			}
+			continue
+		}
+		transformed, keep, err := app.filterItem(&item, rule)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			stats.skippedFiltered++
+			continue
+		}
+		result = append(result, *transformed)
+	}
+	return result, nil
+}
+
+// isStored reports whether an item of the link is stored, nothing is stored
+// without a database
+func (app *NewsApp) isStored(link string) (bool, error) {
+	if app.db == nil {
+		return false, nil
+	}
+	var count int
+	err := app.db.QueryRow("SELECT COUNT(*) FROM news WHERE link = ?", link).Scan(&count)
+	return count > 0, err
+}
+
+func (app *NewsApp) extractDetails(ctx context.Context, rule *ParsingRule, link string) (fields map[string]string, content string, meta pageMetadata, err error) {
+	defer recoverXPathPanic(rule, &err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", meta, err
+	}
+	doc, err := app.fetchPage(req, rule)
+	if err != nil {
+		return nil, "", meta, err
+	}
+	fields = make(map[string]string)
+	for name, detailRule := range rule.DetailRules {
+		fields[name] = extractEntity(doc, &detailRule)
+	}
+	if rule.FetchContent {
+		content = extractContent(doc, rule)
+	}
+	if rule.PageMetadata {
+		meta = extractPageMetadata(doc)
+	}
+	return fields, content, meta, nil
+}
@@ -0,0 +1,42 @@
+// Package aggregator fetches the sources of parsing rules and extracts their
+// news, NewsApp stores them with the storage package and serves them over
+// HTTP with the middleware of the server package
+package aggregator
+
+import (
+	"context"
+	"io"
+)
+
+// LoadParsingRules reads a rules file and prepares its rules for FetchNews
+// and ExtractNews
+func LoadParsingRules(filename string) ([]*ParsingRule, error) {
+	return loadParsingRules(filename)
+}
+
+// PrepareParsingRules validates rules built by the caller and compiles their
+// keywords, selectors and schedules, it must be called before they are used
+func PrepareParsingRules(rules []*ParsingRule) error {
+	return prepareParsingRules(rules)
+}
+
+// FetchNews requests the source of the rule, with its detail pages when the
+// rule has them, and returns the extracted items without storing them, so
+// it needs no database
+func (app *NewsApp) FetchNews(ctx context.Context, rule *ParsingRule) ([]NewsItem, error) {
+	if err := app.compileBlocklist(); err != nil {
+		return nil, err
+	}
+	var stats ingestStats
+	return app.loadNewsList(ctx, rule, &stats)
+}
+
+// ExtractNews extracts the items of a document of the rule, a page, a feed,
+// a sitemap or a JSON document, without any network requests
+func (app *NewsApp) ExtractNews(rule *ParsingRule, document io.Reader) ([]NewsItem, error) {
+	if err := app.compileBlocklist(); err != nil {
+		return nil, err
+	}
+	var stats ingestStats
+	return app.extractDocument(rule, document, &stats)
+}
@@ -0,0 +1,67 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPage = `<html><head><title>Test site</title></head><body>
+<div class="news"><a href="/first">First news of the day</a></div>
+<div class="news"><a href="/second">Second news of the day</a></div>
+</body></html>`
+
+func TestFetchNewsWithoutDatabase(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, testPage)
+		case "/first", "/second":
+			body := strings.Repeat("A sentence long enough to be taken for the article. ", 10)
+			fmt.Fprintf(w, "<html><body><article><p>Body of %s. %s</p></article></body></html>", r.URL.Path, body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		content bool
+	}{
+		{"page", false},
+		{"page with details", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule := &ParsingRule{
+				URL:                server.URL + "/",
+				Interval:           30,
+				NewsNodesXPathExpr: `//div[@class="news"]`,
+				LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+				TitleRule:          ExtractRule{XPathExpr: "a"},
+				FetchContent:       test.content,
+			}
+			if err := PrepareParsingRules([]*ParsingRule{rule}); err != nil {
+				t.Fatal(err)
+			}
+			app := NewNewsApp(Config{})
+			items, err := app.FetchNews(context.Background(), rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 2 {
+				t.Fatalf("got %d items, want 2", len(items))
+			}
+			if items[0].Link != server.URL+"/first" || items[0].Title != "First news of the day" {
+				t.Errorf("got item %q %q", items[0].Link, items[0].Title)
+			}
+			if test.content && !strings.Contains(items[0].Content, "Body of /first") {
+				t.Errorf("got content %q", items[0].Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const exportBatchSize = 500
+
+// exportStreamHandler writes all items in id order as NDJSON. The export is
+// read in batches so it can be resumed from the last received id with since_id.
+func (app *NewsApp) exportStreamHandler(w http.ResponseWriter, r *http.Request) {
+	var sinceID int64
+	if value := r.URL.Query().Get("since_id"); value != "" {
+		var err error
+		if sinceID, err = strconv.ParseInt(value, 10, 64); err != nil || sinceID < 0 {
+			http.Error(w, "since_id must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for {
+		var items []*NewsItem
+		err := retryOnBusy(r.Context(), func() error {
+			var err error
+			items, err = app.exportBatch(r.Context(), sinceID)
+			return err
+		})
+		if err != nil {
+			// the status is already sent, the client notices the missing tail
+			slog.Error("export failed", "after_id", sinceID, "err", err)
+			return
+		}
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return
+			}
+			sinceID = item.ID
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(items) < exportBatchSize {
+			return
+		}
+	}
+}
+
+func (app *NewsApp) exportBatch(ctx context.Context, sinceID int64) ([]*NewsItem, error) {
+	rows, err := app.db.QueryContext(ctx, "SELECT "+newsColumns(0)+" FROM news WHERE id > ? ORDER BY id LIMIT ?", sinceID, exportBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*NewsItem
+	for rows.Next() {
+		item, err := scanNewsItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// newsExportHandler streams all items matching the filter of /news/ as
+// ndjson (the default) or csv, oldest first. The items are read in batches
+// after the seq of the previous batch, so items stored meanwhile are neither
+// repeated nor skipped.
+func (app *NewsApp) newsExportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := newsFilterFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var write func(item *NewsItem) error
+	var flush func() error
+	format := r.Form.Get("format")
+	switch format {
+	case "", "ndjson":
+		format = "ndjson"
+		encoder := json.NewEncoder(w)
+		write = func(item *NewsItem) error { return encoder.Encode(item) }
+		flush = func() error { return nil }
+		w.Header().Set("Content-type", "application/x-ndjson")
+	case "csv":
+		writer := csv.NewWriter(w)
+		write = func(item *NewsItem) error { return writer.Write(csvRecord(item)) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		w.Header().Set("Content-type", "text/csv; charset=utf-8")
+		writer.Write(csvHeader)
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q, expected ndjson or csv", format), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"news.%s\"", format))
+	flusher, _ := w.(http.Flusher)
+	for {
+		var items []*NewsItem
+		err := retryOnBusy(r.Context(), func() error {
+			var err error
+			items, err = app.exportFiltered(r.Context(), filter)
+			return err
+		})
+		if err != nil {
+			// the status is already sent, the client notices the missing tail
+			slog.Error("export failed", "after_seq", filter.Since, "err", err)
+			return
+		}
+		for _, item := range items {
+			if err := write(item); err != nil {
+				return
+			}
+			filter.Since = item.Seq
+		}
+		if err := flush(); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(items) < exportBatchSize {
+			return
+		}
+	}
+}
+
+// exportFiltered returns the next batch of items of the filter after its seq
+func (app *NewsApp) exportFiltered(ctx context.Context, filter NewsFilter) ([]*NewsItem, error) {
+	from, args := app.newsSelection(filter)
+	rows, err := app.db.QueryContext(ctx, "SELECT "+newsColumns(filter.userID)+from+" ORDER BY seq LIMIT ?", append(args, exportBatchSize)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*NewsItem
+	for rows.Next() {
+		item, err := scanNewsItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
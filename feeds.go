@@ -0,0 +1,286 @@
+package aggregator
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFeedLimit = 50
+	maxFeedLimit     = 500
+)
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Link      atomLink `xml:"link"`
+	Updated   string   `xml:"updated"`
+	Published string   `xml:"published,omitempty"`
+	Summary   string   `xml:"summary,omitempty"`
+	// Category is omitted when the item has none
+	Category *atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// feedFilterFromForm reads the filter of a feed request, the limit defaults
+// to defaultFeedLimit
+func feedFilterFromForm(r *http.Request) (NewsFilter, error) {
+	filter, err := newsFilterFromForm(r)
+	if err != nil {
+		return filter, err
+	}
+	filter.Limit = defaultFeedLimit
+	if value := r.Form.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxFeedLimit {
+			return filter, fmt.Errorf("limit must be a number between 1 and %d", maxFeedLimit)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// requestURL reconstructs the absolute URL of the request
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// feedHandler serves the latest items matching the query in the format of
+// the serializer
+func (app *NewsApp) feedHandler(serializer Serializer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := feedFilterFromForm(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		items, err := app.getNews(r.Context(), filter)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		var buf bytes.Buffer
+		if err := serializer.Serialize(&buf, r, NewsPage{Items: items}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-type", serializer.ContentType())
+		buf.WriteTo(w)
+	}
+}
+
+type atomSerializer struct{}
+
+func (atomSerializer) ContentType() string {
+	return "application/atom+xml; charset=utf-8"
+}
+
+func (atomSerializer) Serialize(w io.Writer, r *http.Request, page NewsPage) error {
+	self := requestURL(r)
+	feed := atomFeed{
+		ID:     self,
+		Title:  "News Aggregator",
+		Links:  []atomLink{{Href: self, Rel: "self"}},
+		Author: "News Aggregator",
+	}
+	var updated time.Time
+	for _, item := range page.Items {
+		entry := atomEntry{
+			ID:      item.Link,
+			Title:   item.Title,
+			Link:    atomLink{Href: item.Link},
+			Updated: item.Timestamp.UTC().Format(time.RFC3339),
+			Summary: item.Summary,
+		}
+		if item.Category != "" {
+			entry.Category = &atomCategory{Term: item.Category}
+		}
+		if item.Published != nil {
+			entry.Published = item.Published.UTC().Format(time.RFC3339)
+		}
+		if item.Timestamp.After(updated) {
+			updated = item.Timestamp
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+type rssItemOutput struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description,omitempty"`
+	PubDate     string `xml:"pubDate,omitempty"`
+	Category    string `xml:"category,omitempty"`
+}
+
+type rssOutput struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title       string          `xml:"title"`
+		Link        string          `xml:"link"`
+		Description string          `xml:"description"`
+		Items       []rssItemOutput `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssSerializer struct{}
+
+func (rssSerializer) ContentType() string {
+	return "application/rss+xml; charset=utf-8"
+}
+
+// Serialize writes an RSS 2.0 document, the publication date of an item is
+// the parsed one or else when the item was first seen
+func (rssSerializer) Serialize(w io.Writer, r *http.Request, page NewsPage) error {
+	feed := rssOutput{Version: "2.0"}
+	feed.Channel.Title = "News Aggregator"
+	feed.Channel.Link = requestURL(r)
+	feed.Channel.Description = "News collected by News Aggregator"
+	for _, item := range page.Items {
+		published := item.Timestamp
+		if item.Published != nil {
+			published = *item.Published
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssItemOutput{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        item.Link,
+			Description: item.Summary,
+			PubDate:     published.UTC().Format(time.RFC1123Z),
+			Category:    item.Category,
+		})
+	}
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedSerializer struct{}
+
+func (jsonFeedSerializer) ContentType() string {
+	return "application/feed+json"
+}
+
+// Serialize writes a JSON Feed 1.1 document. The spec requires a content for
+// every item, the summary is used or else the title, and the author comes from
+// the author metadata when a rule extracts it.
+func (jsonFeedSerializer) Serialize(w io.Writer, r *http.Request, page NewsPage) error {
+	self := requestURL(r)
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       "News Aggregator",
+		HomePageURL: strings.TrimSuffix(self, r.URL.RequestURI()) + "/",
+		FeedURL:     self,
+		Items:       make([]jsonFeedItem, 0, len(page.Items)),
+	}
+	for _, item := range page.Items {
+		published := item.Timestamp
+		if item.Published != nil {
+			published = *item.Published
+		}
+		entry := jsonFeedItem{
+			ID:            item.StableID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentText:   item.Summary,
+			Summary:       item.Summary,
+			Image:         item.Image,
+			DatePublished: published.UTC().Format(time.RFC3339),
+		}
+		if entry.ID == "" {
+			entry.ID = item.Link
+		}
+		if entry.ContentText == "" {
+			entry.ContentText = item.Title
+		}
+		if item.LastUpdated.After(item.Timestamp) {
+			entry.DateModified = item.LastUpdated.UTC().Format(time.RFC3339)
+		}
+		if author := item.Metadata["author"]; author != "" {
+			entry.Authors = []jsonFeedAuthor{{author}}
+		}
+		if item.Category != "" {
+			entry.Tags = []string{item.Category}
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+	data, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,50 @@
+package aggregator
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeedHandler(t *testing.T) {
+	app := newTestApp(t)
+	storeTestNews(t, app, &ParsingRule{URL: "https://example.com/"}, 5)
+	storeTestNews(t, app, &ParsingRule{URL: "https://example.org/"}, 3)
+	tests := []struct {
+		serializer Serializer
+		target     string
+		status     int
+		root       string
+		count      int
+	}{
+		{atomSerializer{}, "/feed.xml", http.StatusOK, "feed", 8},
+		{atomSerializer{}, "/feed.xml?limit=2", http.StatusOK, "feed", 2},
+		{atomSerializer{}, "/feed.xml?source=example.org", http.StatusOK, "feed", 3},
+		{rssSerializer{}, "/rss.xml?source=example.com", http.StatusOK, "rss", 5},
+		{rssSerializer{}, "/rss.xml?limit=0", http.StatusBadRequest, "", 0},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		app.feedHandler(test.serializer)(w, httptest.NewRequest(http.MethodGet, test.target, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d: %s", test.target, w.Code, test.status, w.Body)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		var doc struct {
+			XMLName xml.Name
+			Entries []struct{} `xml:"entry"`
+			Items   []struct{} `xml:"channel>item"`
+		}
+		if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+			t.Errorf("%s: %v", test.target, err)
+			continue
+		}
+		if count := len(doc.Entries) + len(doc.Items); doc.XMLName.Local != test.root || count != test.count {
+			t.Errorf("%s: got <%s> with %d items, want <%s> with %d", test.target, doc.XMLName.Local, count, test.root, test.count)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html/charset"
+)
+
+// Rule types, the page of an html rule is scraped with the XPath rules while
+// an rss rule reads RSS 2.0, RSS 1.0 and Atom feeds and a sitemap rule the
+// pages listed in a sitemap
+const (
+	ruleTypeHTML    = "html"
+	ruleTypeRSS     = "rss"
+	ruleTypeSitemap = "sitemap"
+)
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	Enclosures  []struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	// Thumbnail is media:thumbnail of Media RSS
+	Thumbnail struct {
+		URL string `xml:"url,attr"`
+	} `xml:"thumbnail"`
+	// Date is dc:date of RSS 1.0
+	Date string `xml:"date"`
+}
+
+type atomSourceLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// feedDocument is any of the supported feeds, which fields are filled depends
+// on the root element
+type feedDocument struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	// Items are the items of RSS 1.0, they are siblings of the channel
+	Items   []rssItem `xml:"item"`
+	Title   string    `xml:"title"`
+	Entries []struct {
+		Title     string           `xml:"title"`
+		Links     []atomSourceLink `xml:"link"`
+		Summary   string           `xml:"summary"`
+		Published string           `xml:"published"`
+		Updated   string           `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// feedEntry is an item of a feed before it becomes a NewsItem
+type feedEntry struct {
+	title     string
+	link      string
+	summary   string
+	image     string
+	published string
+	// metadata are the fields of the metadata rules of a json rule
+	metadata map[string]string
+}
+
+// parseFeed reads the title and the entries of a feed
+func parseFeed(r io.Reader) (string, []feedEntry, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Entity = xml.HTMLEntity
+	var doc feedDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("invalid feed: %v", err)
+	}
+	var entries []feedEntry
+	switch doc.XMLName.Local {
+	case "rss", "RDF":
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			link := item.Link
+			if link == "" {
+				link = item.GUID
+			}
+			published := item.PubDate
+			if published == "" {
+				published = item.Date
+			}
+			image := item.Thumbnail.URL
+			for _, enclosure := range item.Enclosures {
+				if image == "" && strings.HasPrefix(enclosure.Type, "image/") {
+					image = enclosure.URL
+				}
+			}
+			entries = append(entries, feedEntry{title: item.Title, link: link, summary: item.Description, image: image, published: published})
+		}
+		return strings.TrimSpace(doc.Channel.Title), entries, nil
+	case "feed":
+		for _, entry := range doc.Entries {
+			var link, image string
+			for _, l := range entry.Links {
+				if link == "" && (l.Rel == "" || l.Rel == "alternate") {
+					link = l.Href
+				}
+				if image == "" && l.Rel == "enclosure" && strings.HasPrefix(l.Type, "image/") {
+					image = l.Href
+				}
+			}
+			published := entry.Published
+			if published == "" {
+				published = entry.Updated
+			}
+			entries = append(entries, feedEntry{title: entry.Title, link: link, summary: entry.Summary, image: image, published: published})
+		}
+		return strings.TrimSpace(doc.Title), entries, nil
+	}
+	return "", nil, fmt.Errorf("unsupported feed root element <%s>", doc.XMLName.Local)
+}
+
+// feedText returns the text of an escaped HTML fragment, descriptions of
+// feeds often contain markup
+func feedText(fragment string) string {
+	if !strings.Contains(fragment, "<") {
+		return strings.TrimSpace(fragment)
+	}
+	doc, err := htmlquery.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return strings.TrimSpace(fragment)
+	}
+	return strings.TrimSpace(htmlquery.InnerText(doc))
+}
+
+// loadFeedNews requests the feed of the rule and extracts its items
+func (app *NewsApp) loadFeedNews(ctx context.Context, rule *ParsingRule, stats *ingestStats) ([]NewsItem, error) {
+	req, err := newRuleRequest(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := app.fetch(req, rule)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	title, entries, err := parseFeed(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	app.updateSiteTitle(rule.URL, title)
+	start := time.Now()
+	defer func() { stats.parseTime = time.Since(start) }()
+	return app.extractFeedNews(rule, entries, stats)
+}
+
+// extractFeedNews turns feed entries into items like extractNews does with
+// the nodes of a page
+func (app *NewsApp) extractFeedNews(rule *ParsingRule, entries []feedEntry, stats *ingestStats) ([]NewsItem, error) {
+	version := rule.Version()
+	source := rule.Source()
+	dates := newDateStats()
+	var items []NewsItem
+	for _, entry := range entries {
+		stats.matched++
+		link, title := strings.TrimSpace(entry.link), collapseSpace(entry.title)
+		if link == "" || (title == "" && !rule.PageMetadata) {
+			stats.skippedEmpty++
+			continue
+		}
+		link, err := convertToAbsURL(rule.URL, link)
+		if err != nil {
+			return nil, fmt.Errorf("error converting link url %s to absolute url using base url %s: %v", link, rule.URL, err)
+		}
+		link, err = app.normalizeURL(link)
+		if err != nil {
+			return nil, fmt.Errorf("error normalizing link url %s: %v", link, err)
+		}
+		item := NewsItem{
+			Link:        link,
+			Title:       title,
+			Source:      source,
+			Category:    rule.Category,
+			Summary:     feedText(entry.summary),
+			Metadata:    entry.metadata,
+			RuleVersion: version,
+		}
+		if item.Image, err = absoluteImageURL(rule.URL, entry.image); err != nil {
+			return nil, err
+		}
+		if entry.published != "" {
+			item.Published = dates.parse(entry.published, rule.DateFormat)
+		}
+		if title == "" {
+			// filtered by the title from the page
+			items = append(items, item)
+			continue
+		}
+		transformed, keep, err := app.filterItem(&item, rule)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			stats.skippedFiltered++
+			continue
+		}
+		items = append(items, *transformed)
+	}
+	dates.log(rule.URL)
+	return items, nil
+}
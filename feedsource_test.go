@@ -0,0 +1,117 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name  string
+		feed  string
+		title string
+		want  []feedEntry
+	}{
+		{
+			"rss",
+			`<rss version="2.0"><channel><title>News</title>
+<item><title>First</title><link>https://example.com/1</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+<item><title>Second</title><guid>https://example.com/2</guid><enclosure url="https://example.com/2.jpg" type="image/jpeg"/></item>
+</channel></rss>`,
+			"News",
+			[]feedEntry{
+				{title: "First", link: "https://example.com/1", published: "Mon, 02 Jan 2006 15:04:05 GMT"},
+				{title: "Second", link: "https://example.com/2", image: "https://example.com/2.jpg"},
+			},
+		},
+		{
+			"rss 1.0",
+			`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>News</title></channel>
+<item><title>First</title><link>https://example.com/1</link><dc:date>2006-01-02T15:04:05Z</dc:date></item>
+</rdf:RDF>`,
+			"News",
+			[]feedEntry{{title: "First", link: "https://example.com/1", published: "2006-01-02T15:04:05Z"}},
+		},
+		{
+			"atom",
+			`<feed xmlns="http://www.w3.org/2005/Atom"><title>News</title>
+<entry><title>First</title><link rel="self" href="https://example.com/1.xml"/><link href="https://example.com/1"/><summary>Text</summary><updated>2006-01-02T15:04:05Z</updated></entry>
+</feed>`,
+			"News",
+			[]feedEntry{{title: "First", link: "https://example.com/1", summary: "Text", published: "2006-01-02T15:04:05Z"}},
+		},
+	}
+	for _, test := range tests {
+		title, entries, err := parseFeed(strings.NewReader(test.feed))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if title != test.title || !reflect.DeepEqual(entries, test.want) {
+			t.Errorf("%s: got %q %+v, want %q %+v", test.name, title, entries, test.title, test.want)
+		}
+	}
+	if _, _, err := parseFeed(strings.NewReader("<html></html>")); err == nil {
+		t.Error("parseFeed accepted an html page")
+	}
+}
+
+func TestLoadNewsListFromFeeds(t *testing.T) {
+	feeds := map[string]string{
+		"/rss.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>News</title>
+<item><title>First news</title><link>/first</link><pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate></item>
+<item><title> </title><link>/empty</link></item>
+</channel></rss>`,
+		"/atom.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>News</title>
+<entry><title>First news</title><link href="/first"/><published>2006-01-02T15:04:05Z</published></entry>
+</feed>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feed, ok := feeds[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, feed)
+	}))
+	defer server.Close()
+
+	published := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		path    string
+		skipped int
+	}{
+		{"/rss.xml", 1},
+		{"/atom.xml", 0},
+	}
+	for _, test := range tests {
+		path := test.path
+		rule := &ParsingRule{URL: server.URL + path, Type: ruleTypeRSS, Interval: 30}
+		if err := PrepareParsingRules([]*ParsingRule{rule}); err != nil {
+			t.Fatal(err)
+		}
+		var stats ingestStats
+		items, err := NewNewsApp(Config{}).loadNewsList(context.Background(), rule, &stats)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if len(items) != 1 || stats.skippedEmpty != test.skipped {
+			t.Errorf("%s: got %d items skipping %d, want 1 skipping %d", path, len(items), stats.skippedEmpty, test.skipped)
+			continue
+		}
+		item := items[0]
+		if item.Link != server.URL+"/first" || item.Title != "First news" || item.Published == nil || !item.Published.Equal(published) {
+			t.Errorf("%s: got item %q %q %v", path, item.Link, item.Title, item.Published)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package aggregator
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const defaultBodyContentType = "application/json"
+
+const (
+	defaultFetchTimeout = 15 * time.Second
+	// defaultUserAgent looks like a browser because some sites reject the Go client
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+const (
+	defaultMaxRetries = 3
+	fetchRetryBackoff = time.Second
+)
+
+// maxRetries returns how many times a failed request of the rule is retried
+func (rule *ParsingRule) maxRetries() uint {
+	if rule.MaxRetries == nil {
+		return defaultMaxRetries
+	}
+	return *rule.MaxRetries
+}
+
+// fetchTimeout returns the timeout of requests of the rule, -fetchTimeout
+// when the rule does not set one
+func (app *NewsApp) fetchTimeout(rule *ParsingRule) time.Duration {
+	if rule.TimeoutSeconds == 0 {
+		return app.config.FetchTimeout
+	}
+	return time.Duration(rule.TimeoutSeconds) * time.Second
+}
+
+func (rule *ParsingRule) userAgent() string {
+	if rule.UserAgent == "" {
+		return defaultUserAgent
+	}
+	return rule.UserAgent
+}
+
+// authorize adds the headers, cookies and basic authentication of the rule to
+// a request for its host, other hosts such as those of detail pages on a CDN
+// do not get the credentials
+func (rule *ParsingRule) authorize(req *http.Request) {
+	if u, err := url.Parse(rule.URL); err != nil || !strings.EqualFold(u.Host, req.URL.Host) {
+		return
+	}
+	for name, value := range rule.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(rule.Cookies) > 0 {
+		// a retried request is authorized again
+		req.Header.Del("Cookie")
+		for _, name := range sortedKeys(rule.Cookies) {
+			req.AddCookie(&http.Cookie{Name: name, Value: rule.Cookies[name]})
+		}
+	}
+	if rule.BasicAuth != nil {
+		req.SetBasicAuth(rule.BasicAuth.Username, rule.BasicAuth.Password)
+	}
+}
+
+// fetchDocument requests the page of the rule and parses it, or renders it
+// when the rule asks for it
+func (app *NewsApp) fetchDocument(ctx context.Context, rule *ParsingRule) (*html.Node, error) {
+	if rule.Render == renderChromium {
+		return app.renderPage(ctx, rule)
+	}
+	req, err := newRuleRequest(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	return app.fetchPage(req, rule)
+}
+
+// newRuleRequest builds the request of the rule page canceled with ctx
+func newRuleRequest(ctx context.Context, rule *ParsingRule) (*http.Request, error) {
+	method := rule.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), rule.URL, strings.NewReader(rule.Body))
+	if err != nil {
+		return nil, err
+	}
+	if rule.Body != "" {
+		contentType := rule.ContentType
+		if contentType == "" {
+			contentType = defaultBodyContentType
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// fetchPage sends the request with the settings of the rule and parses the
+// HTML response decoded to UTF-8 from the charset of the Content-Type header
+// or of the meta tags
+func (app *NewsApp) fetchPage(req *http.Request, rule *ParsingRule) (*html.Node, error) {
+	resp, err := app.fetch(req, rule)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	doc, err := parseHTML(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %v", req.URL, err)
+	}
+	return doc, nil
+}
+
+// parseHTML transcodes a page to UTF-8 from the charset of contentType or,
+// when it has none, of the meta tags or a guess from the content, then parses it
+func parseHTML(r io.Reader, contentType string) (*html.Node, error) {
+	body, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return nil, err
+	}
+	return htmlquery.Parse(body)
+}
+
+// fetch sends the request after the delay of the rule since the previous
+// request to the host, responses other than 2xx are errors. Network errors
+// and 5xx responses are retried up to maxRetries times with a growing backoff
+// until the context of the request is canceled.
+func (app *NewsApp) fetch(req *http.Request, rule *ParsingRule) (_ *http.Response, err error) {
+	ctx, span := tracer.Start(req.Context(), "fetch", trace.WithSpanKind(trace.SpanKindClient), ruleAttributes(rule),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(req.Method), semconv.URLFull(req.URL.String())))
+	defer func() {
+		if err == errNotModified {
+			endSpan(span, nil)
+			return
+		}
+		endSpan(span, err)
+	}()
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	backoff := fetchRetryBackoff
+	for attempt := uint(0); ; attempt++ {
+		resp, retry, err := app.fetchOnce(req, rule)
+		if err == nil || !retry || attempt >= rule.maxRetries() {
+			span.SetAttributes(attribute.Int("http.attempts", int(attempt)+1))
+			if resp != nil {
+				span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			}
+			return resp, err
+		}
+		slog.Warn("fetch failed, retrying", "url", req.URL.String(), "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// fetchOnce sends the request once, retry tells whether the error may be
+// transient. The rule page is requested conditionally and errNotModified is
+// returned when it did not change.
+func (app *NewsApp) fetchOnce(req *http.Request, rule *ParsingRule) (resp *http.Response, retry bool, err error) {
+	req.Header.Set("User-Agent", rule.userAgent())
+	rule.authorize(req)
+	conditional := isConditional(req, rule)
+	if conditional {
+		app.validators.apply(req, rule)
+	}
+	client, err := app.ruleClient(rule)
+	if err != nil {
+		return nil, false, err
+	}
+	crawlDelay, err := app.checkRobots(req.Context(), req.URL, rule)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := app.hosts.wait(req.Context(), req.URL.Host, max(app.requestDelay(rule), crawlDelay)); err != nil {
+		return nil, false, err
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		resp.Body.Close()
+		return nil, false, errNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, resp.StatusCode >= 500, fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	// the transport decompresses only when it asked for gzip itself, not
+	// when the request sets Accept-Encoding
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, false, fmt.Errorf("%s %s: invalid gzip body: %v", req.Method, req.URL, err)
+		}
+		resp.Body = gzipBody{reader, resp.Body}
+	}
+	if conditional {
+		app.validators.store(resp, rule)
+	}
+	return resp, false, nil
+}
+
+// gzipBody closes both the decompressing reader and the response body
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
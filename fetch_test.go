@@ -0,0 +1,126 @@
+package aggregator
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetchRetries(t *testing.T) {
+	one := uint(1)
+	tests := []struct {
+		name       string
+		failures   int32
+		status     int
+		maxRetries *uint
+		requests   int32
+		ok         bool
+	}{
+		{"5xx then success", 2, http.StatusServiceUnavailable, nil, 3, true},
+		{"5xx beyond the retries", 2, http.StatusInternalServerError, &one, 2, false},
+		{"4xx is not retried", 2, http.StatusNotFound, nil, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					http.NotFound(w, r)
+					return
+				}
+				if requests.Add(1) <= test.failures {
+					http.Error(w, "failure", test.status)
+					return
+				}
+				fmt.Fprint(w, testPage)
+			}))
+			defer server.Close()
+			rule := &ParsingRule{
+				URL:                server.URL + "/",
+				Interval:           30,
+				MaxRetries:         test.maxRetries,
+				NewsNodesXPathExpr: `//div[@class="news"]`,
+				LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+				TitleRule:          ExtractRule{XPathExpr: "a"},
+			}
+			if err := PrepareParsingRules([]*ParsingRule{rule}); err != nil {
+				t.Fatal(err)
+			}
+			var stats ingestStats
+			items, err := NewNewsApp(Config{}).loadNewsList(context.Background(), rule, &stats)
+			if (err == nil) != test.ok {
+				t.Errorf("got error %v", err)
+			}
+			if test.ok && len(items) != 2 {
+				t.Errorf("got %d items, want 2", len(items))
+			}
+			if got := requests.Load(); got != test.requests {
+				t.Errorf("got %d requests, want %d", got, test.requests)
+			}
+		})
+	}
+}
+
+func TestFetchPageDecoding(t *testing.T) {
+	// Новости дня in Windows-1251
+	const title = "\xcd\xee\xe2\xee\xf1\xf2\xe8 \xe4\xed\xff"
+	page := func(meta string) []byte {
+		return []byte(`<html><head>` + meta + `</head><body><div class="news"><a href="/first">` + title + `</a></div></body></html>`)
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		gzip        bool
+		headers     map[string]string
+	}{
+		{"content type charset", "text/html; charset=windows-1251", page(""), false, nil},
+		{"meta charset", "text/html", page(`<meta charset="windows-1251">`), false, nil},
+		{"meta http-equiv", "text/html", page(`<meta http-equiv="Content-Type" content="text/html; charset=windows-1251">`), false, nil},
+		{"gzip asked by the transport", "text/html; charset=windows-1251", page(""), true, nil},
+		{"gzip asked by the rule", "text/html; charset=windows-1251", page(""), true, map[string]string{"Accept-Encoding": "gzip"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", test.contentType)
+				if !test.gzip {
+					w.Write(test.body)
+					return
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				writer := gzip.NewWriter(w)
+				writer.Write(test.body)
+				writer.Close()
+			}))
+			defer server.Close()
+			rule := &ParsingRule{
+				URL:                server.URL + "/",
+				Interval:           30,
+				Headers:            test.headers,
+				NewsNodesXPathExpr: `//div[@class="news"]`,
+				LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+				TitleRule:          ExtractRule{XPathExpr: "a"},
+			}
+			if err := PrepareParsingRules([]*ParsingRule{rule}); err != nil {
+				t.Fatal(err)
+			}
+			var stats ingestStats
+			items, err := NewNewsApp(Config{}).loadNewsList(context.Background(), rule, &stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 1 || items[0].Title != "Новости дня" {
+				t.Errorf("got items %+v", items)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package aggregator
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// types of the field transforms
+const (
+	fieldTransformRegex        = "regex"
+	fieldTransformReplace      = "replace"
+	fieldTransformTrim         = "trim"
+	fieldTransformStripPrefix  = "stripPrefix"
+	fieldTransformStripSuffix  = "stripSuffix"
+	fieldTransformHTMLUnescape = "htmlUnescape"
+	fieldTransformQueryParam   = "queryParam"
+	fieldTransformMaxLength    = "maxLength"
+)
+
+// FieldTransform changes the value extracted by a rule:
+//   - regex keeps the first group of Pattern, or the whole match without
+//     groups, and leaves values not matching unchanged
+//   - replace replaces the matches of Pattern by Replacement, which may refer
+//     to the groups as $1
+//   - trim removes the whitespace around the value
+//   - stripPrefix and stripSuffix remove Value from the start or the end,
+//     ignoring case
+//   - htmlUnescape decodes entities such as &amp; and &#39;
+//   - queryParam takes the decoded query parameter Value of a link, e.g. the
+//     target of a redirect, and leaves links without it unchanged
+//   - maxLength cuts the value to Length characters
+type FieldTransform struct {
+	Type        string `json:"type"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Length      int    `json:"length,omitempty"`
+
+	regexp *regexp.Regexp
+}
+
+// check returns the problem of the transform, empty when it is valid
+func (t *FieldTransform) check() string {
+	switch t.Type {
+	case fieldTransformRegex, fieldTransformReplace:
+		if t.Pattern == "" {
+			return t.Type + " needs a pattern"
+		}
+		if _, err := regexp.Compile(t.Pattern); err != nil {
+			return fmt.Sprintf("pattern %q does not compile: %v", t.Pattern, err)
+		}
+	case fieldTransformStripPrefix, fieldTransformStripSuffix, fieldTransformQueryParam:
+		if t.Value == "" {
+			return t.Type + " needs a value"
+		}
+	case fieldTransformMaxLength:
+		if t.Length <= 0 {
+			return "maxLength needs a positive length"
+		}
+	case fieldTransformTrim, fieldTransformHTMLUnescape:
+	default:
+		return fmt.Sprintf("unknown transform type %q", t.Type)
+	}
+	return ""
+}
+
+func (t *FieldTransform) apply(value string) string {
+	switch t.Type {
+	case fieldTransformRegex:
+		match := t.regexp.FindStringSubmatch(value)
+		if match == nil {
+			return value
+		}
+		if len(match) > 1 {
+			return match[1]
+		}
+		return match[0]
+	case fieldTransformReplace:
+		return t.regexp.ReplaceAllString(value, t.Replacement)
+	case fieldTransformTrim:
+		return strings.TrimSpace(value)
+	case fieldTransformStripPrefix:
+		if len(value) >= len(t.Value) && strings.EqualFold(value[:len(t.Value)], t.Value) {
+			return value[len(t.Value):]
+		}
+	case fieldTransformStripSuffix:
+		if len(value) >= len(t.Value) && strings.EqualFold(value[len(value)-len(t.Value):], t.Value) {
+			return value[:len(value)-len(t.Value)]
+		}
+	case fieldTransformHTMLUnescape:
+		return html.UnescapeString(value)
+	case fieldTransformQueryParam:
+		if u, err := url.Parse(strings.TrimSpace(value)); err == nil {
+			if param := u.Query().Get(t.Value); param != "" {
+				return param
+			}
+		}
+	case fieldTransformMaxLength:
+		if utf8.RuneCountInString(value) > t.Length {
+			return string([]rune(value)[:t.Length])
+		}
+	}
+	return value
+}
+
+// transform runs the transforms of the rule on a value it extracted
+func (rule *ExtractRule) transform(value string) string {
+	for i := range rule.Transforms {
+		value = rule.Transforms[i].apply(value)
+	}
+	return value
+}
+
+// compileTransforms compiles the patterns of the transforms of the rule and
+// its alternatives, a nil rule has none
+func (rule *ExtractRule) compileTransforms() error {
+	if rule == nil {
+		return nil
+	}
+	for i := range rule.Transforms {
+		t := &rule.Transforms[i]
+		if t.Type != fieldTransformRegex && t.Type != fieldTransformReplace {
+			continue
+		}
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return err
+		}
+		t.regexp = re
+	}
+	for i := range rule.Alternatives {
+		if err := rule.Alternatives[i].compileTransforms(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileTransforms compiles the transforms of every extract rule, the
+// transforms of the map entries share their arrays with the stored rules
+func (rule *ParsingRule) compileTransforms() error {
+	for _, extract := range []*ExtractRule{&rule.LinkRule, &rule.TitleRule, rule.SummaryRule, rule.ImageRule, rule.DateRule} {
+		if err := extract.compileTransforms(); err != nil {
+			return err
+		}
+	}
+	for _, rules := range []map[string]ExtractRule{rule.MetadataRules, rule.DetailRules} {
+		for _, extract := range rules {
+			if err := extract.compileTransforms(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateTransforms returns the problems of the transforms of the extract
+// rules, the content rule extracts markup and takes none
+func (rule *ParsingRule) validateTransforms() []string {
+	var problems []string
+	var check func(field string, extract *ExtractRule)
+	check = func(field string, extract *ExtractRule) {
+		for i := range extract.Transforms {
+			if problem := extract.Transforms[i].check(); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s.transforms[%d]: %s", field, i, problem))
+			}
+		}
+		for i := range extract.Alternatives {
+			check(fmt.Sprintf("%s.alternatives[%d]", field, i), &extract.Alternatives[i])
+		}
+	}
+	check("linkRule", &rule.LinkRule)
+	check("titleRule", &rule.TitleRule)
+	if rule.SummaryRule != nil {
+		check("summaryRule", rule.SummaryRule)
+	}
+	if rule.ImageRule != nil {
+		check("imageRule", rule.ImageRule)
+	}
+	if rule.DateRule != nil {
+		check("dateRule", rule.DateRule)
+	}
+	for _, name := range sortedRuleNames(rule.MetadataRules) {
+		extract := rule.MetadataRules[name]
+		check("metadataRules."+name, &extract)
+	}
+	for _, name := range sortedRuleNames(rule.DetailRules) {
+		extract := rule.DetailRules[name]
+		check("detailRules."+name, &extract)
+	}
+	if rule.ContentRule != nil && len(rule.ContentRule.Transforms) > 0 {
+		problems = append(problems, "contentRule does not support transforms")
+	}
+	return problems
+}
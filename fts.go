@@ -0,0 +1,109 @@
+package aggregator
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// The news_fts table indexes the titles and summaries of the items by their
+// ids and is kept in sync with the news table by triggers. It keeps its own
+// copy of the text, so a missing or stale entry can be replaced without the
+// index getting corrupted, and compressed summaries are indexed as text.
+var ftsStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS news_fts USING fts5(title, summary, tokenize = 'unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER IF NOT EXISTS news_fts_insert AFTER INSERT ON news BEGIN
+		INSERT INTO news_fts(rowid, title, summary) VALUES (new.id, new.title, decompress(new.summary));
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS news_fts_delete AFTER DELETE ON news BEGIN
+		DELETE FROM news_fts WHERE rowid = old.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS news_fts_update AFTER UPDATE OF title, summary ON news BEGIN
+		UPDATE news_fts SET title = new.title, summary = decompress(new.summary) WHERE rowid = new.id;
+	END`,
+}
+
+var ftsTriggers = []string{"news_fts_insert", "news_fts_delete", "news_fts_update"}
+
+// setupFullTextSearch creates the index when SQLite is built with FTS5, that
+// is with -tags sqlite_fts5, and otherwise leaves the search on substrings of
+// the titles. The index is rebuilt when its triggers were missing, because
+// items were then stored without being indexed.
+func (app *NewsApp) setupFullTextSearch() error {
+	var enabled bool
+	if err := app.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		slog.Warn("SQLite is built without FTS5, searching substrings of titles, build with -tags sqlite_fts5 for full-text search")
+		for _, trigger := range ftsTriggers {
+			if _, err := app.db.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var triggers int
+	err := app.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (?, ?, ?)",
+		ftsTriggers[0], ftsTriggers[1], ftsTriggers[2]).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	// the triggers are created again so databases get their current version
+	for _, trigger := range ftsTriggers {
+		if _, err := app.db.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+			return err
+		}
+	}
+	for _, statement := range ftsStatements {
+		if _, err := app.db.Exec(statement); err != nil {
+			return fmt.Errorf("unable to create the full-text index: %v", err)
+		}
+	}
+	app.fts = true
+	if triggers == len(ftsTriggers) {
+		return nil
+	}
+	slog.Info("building the full-text index")
+	count, err := app.reindexNews(app.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to build the full-text index: %v", err)
+	}
+	slog.Info("built the full-text index", "items", count)
+	return nil
+}
+
+// ftsQuery turns a search into an FTS5 query matching items containing every
+// word, or a word starting with it, and phrase of the search. The terms are
+// quoted so the syntax of FTS5 queries can not be used. A search of negated
+// terms only has no FTS5 query.
+func ftsQuery(query searchQuery) string {
+	if !query.positive() {
+		return ""
+	}
+	var clauses, excluded []string
+	for _, clause := range query {
+		terms := make([]string, 0, len(clause))
+		for _, term := range clause {
+			quoted := `"` + strings.Replace(term.text, `"`, `""`, -1) + `"`
+			if !term.phrase {
+				quoted += "*"
+			}
+			terms = append(terms, quoted)
+		}
+		switch {
+		case clause[0].negated:
+			excluded = append(excluded, terms[0])
+		case len(terms) == 1:
+			clauses = append(clauses, terms[0])
+		default:
+			clauses = append(clauses, "("+strings.Join(terms, " OR ")+")")
+		}
+	}
+	// FTS5 needs an explicit AND before a parenthesis
+	match := strings.Join(clauses, " AND ")
+	if len(excluded) > 0 {
+		match = "(" + match + ") NOT " + strings.Join(excluded, " NOT ")
+	}
+	return match
+}
@@ -0,0 +1,984 @@
+package aggregator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The /graphql endpoint answers queries of this schema, the fields of the
+// types are the JSON fields of the REST API:
+//
+//	type Query {
+//	  news(q, source, category, from, to, metaKey, metaValue, ruleVersion,
+//	       orderBy, unread, starred, hidden, since, limit, offset): NewsPage
+//	  item(id: ID!): NewsItem
+//	  sources: [Source]
+//	  source(id: ID!): Source
+//	  stats: Stats
+//	}
+//	type NewsPage { total limit offset items: [NewsItem] }
+//	type Source { id url name category ... stats: SourceStats }
+//
+// Queries may use variables, aliases, fragments and the @include and @skip
+// directives. Mutations, subscriptions and introspection are not supported.
+
+// gqlNewsArgs are the arguments of the news field, the query parameters of
+// /news/ of the same names
+var gqlNewsArgs = map[string]bool{"q": true, "source": true, "category": true, "from": true, "to": true,
+	"metaKey": true, "metaValue": true, "ruleVersion": true, "orderBy": true, "unread": true, "starred": true,
+	"hidden": true, "since": true, "limit": true, "offset": true}
+
+// gqlTypeNames are the names of the types reported by __typename whose Go
+// names differ
+var gqlTypeNames = map[reflect.Type]string{
+	reflect.TypeOf(SourceStatus{}): "Source",
+	reflect.TypeOf(gqlSource{}):    "Source",
+}
+
+// gqlSource is a source with its counters, which are collected only when
+// the query selects them
+type gqlSource struct {
+	SourceStatus
+	Stats *SourceStats `json:"stats"`
+}
+
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+type gqlResponse struct {
+	Data   interface{} `json:"data"`
+	Errors []gqlError  `json:"errors,omitempty"`
+}
+
+// graphqlHandler serves /graphql, queries are sent with POST as JSON or with GET
+// in the query, variables and operationName parameters
+func (app *NewsApp) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeGQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("invalid variables: %v", err)}}})
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeGQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("invalid request: %v", err)}}})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, err := parseGQL(req.Query)
+	if err != nil {
+		writeGQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		writeGQL(w, http.StatusBadRequest, gqlResponse{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	ex := &gqlExecutor{app: app, r: r, doc: doc, variables: make(map[string]interface{})}
+	for name, value := range op.defaults {
+		ex.variables[name] = value
+	}
+	for name, value := range req.Variables {
+		ex.variables[name] = value
+	}
+	data := ex.root(op.selections)
+	writeGQL(w, http.StatusOK, gqlResponse{Data: data, Errors: ex.errors})
+}
+
+func writeGQL(w http.ResponseWriter, status int, response gqlResponse) {
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// gqlObject is a result object keeping the order of the selected fields
+type gqlObject []gqlMember
+
+type gqlMember struct {
+	key   string
+	value interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(member.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(member.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type gqlExecutor struct {
+	app       *NewsApp
+	r         *http.Request
+	doc       *gqlDocument
+	variables map[string]interface{}
+	errors    []gqlError
+}
+
+func (ex *gqlExecutor) fail(path []interface{}, format string, args ...interface{}) {
+	ex.errors = append(ex.errors, gqlError{Message: fmt.Sprintf(format, args...), Path: append([]interface{}(nil), path...)})
+}
+
+// root resolves the fields of the query type, a failing field is null and
+// reported in the errors
+func (ex *gqlExecutor) root(selections []gqlSelection) gqlObject {
+	result := gqlObject{}
+	for _, field := range ex.collect(selections, "Query") {
+		path := []interface{}{field.key()}
+		if field.name == "__typename" {
+			result = append(result, gqlMember{field.key(), "Query"})
+			continue
+		}
+		args, err := ex.arguments(field)
+		if err != nil {
+			ex.fail(path, "%v", err)
+			result = append(result, gqlMember{field.key(), nil})
+			continue
+		}
+		value, err := ex.resolve(field, args)
+		if err != nil {
+			ex.fail(path, "%v", err)
+			result = append(result, gqlMember{field.key(), nil})
+			continue
+		}
+		result = append(result, gqlMember{field.key(), ex.project(reflect.ValueOf(value), field, path)})
+	}
+	return result
+}
+
+// resolve returns the value of a field of the query type
+func (ex *gqlExecutor) resolve(field *gqlField, args map[string]interface{}) (interface{}, error) {
+	ctx := ex.r.Context()
+	switch field.name {
+	case "news":
+		form := make(url.Values)
+		for name, value := range args {
+			if !gqlNewsArgs[name] {
+				return nil, fmt.Errorf("unknown argument %q of news", name)
+			}
+			if value != nil {
+				form.Set(name, gqlString(value))
+			}
+		}
+		req := ex.r.WithContext(ctx)
+		req.Form = form
+		filter, err := newsFilterFromForm(req)
+		if err != nil {
+			return nil, err
+		}
+		if filter.Limit, filter.Offset, err = paginationFromForm(req); err != nil {
+			return nil, err
+		}
+		items, err := ex.app.getNews(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		total, err := ex.app.countNews(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		return NewsPage{Total: total, Limit: filter.Limit, Offset: filter.Offset, Items: items}, nil
+	case "item":
+		if err := onlyArgs(field.name, args, "id"); err != nil {
+			return nil, err
+		}
+		id, err := strconv.ParseInt(gqlString(args["id"]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("item needs a numeric id")
+		}
+		item, err := ex.app.getNewsItem(ctx, id, requestUserID(ex.r))
+		if err != nil || item == nil {
+			return nil, err
+		}
+		return item, nil
+	case "sources", "source":
+		var id string
+		if field.name == "source" {
+			if err := onlyArgs(field.name, args, "id"); err != nil {
+				return nil, err
+			}
+			if id = gqlString(args["id"]); id == "" {
+				return nil, fmt.Errorf("source needs an id")
+			}
+		} else if err := onlyArgs(field.name, args); err != nil {
+			return nil, err
+		}
+		withStats := false
+		for _, selected := range ex.collect(field.selections, "Source") {
+			withStats = withStats || selected.name == "stats"
+		}
+		var sources []gqlSource
+		for _, status := range ex.app.sourceStatuses(true) {
+			if id != "" && status.ID != id {
+				continue
+			}
+			// the rules hold credentials and are left to /api/rules
+			rule := status.Rule
+			status.Rule = nil
+			source := gqlSource{SourceStatus: status}
+			if withStats {
+				stats, err := ex.app.sourceStats(ctx, rule)
+				if err != nil {
+					return nil, err
+				}
+				source.Stats = stats
+			}
+			sources = append(sources, source)
+		}
+		if field.name == "sources" {
+			return sources, nil
+		}
+		if len(sources) == 0 {
+			return nil, nil
+		}
+		return sources[0], nil
+	case "stats":
+		if err := onlyArgs(field.name, args); err != nil {
+			return nil, err
+		}
+		return ex.app.stats(), nil
+	case "__schema", "__type":
+		return nil, fmt.Errorf("introspection is not supported")
+	}
+	return nil, fmt.Errorf("cannot query field %q on type Query", field.name)
+}
+
+// onlyArgs returns an error for an argument of the field not in names
+func onlyArgs(field string, args map[string]interface{}, names ...string) error {
+	for arg := range args {
+		known := false
+		for _, name := range names {
+			known = known || arg == name
+		}
+		if !known {
+			return fmt.Errorf("unknown argument %q of %s", arg, field)
+		}
+	}
+	return nil
+}
+
+// gqlString formats an argument like a query parameter
+func gqlString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// project selects the fields of the query from a value, structs are read by
+// the names of their JSON fields
+func (ex *gqlExecutor) project(v reflect.Value, field *gqlField, path []interface{}) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = ex.project(v.Index(i), field, append(path, i))
+		}
+		return list
+	}
+	if v.Kind() != reflect.Struct || v.Type() == reflect.TypeOf(time.Time{}) {
+		if len(field.selections) > 0 {
+			ex.fail(path, "field %q is a scalar and has no selection", field.name)
+			return nil
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			ex.fail(path, "%v", err)
+			return nil
+		}
+		return json.RawMessage(data)
+	}
+	typeName := gqlTypeName(v.Type())
+	if len(field.selections) == 0 {
+		ex.fail(path, "field %q of type %s needs a selection", field.name, typeName)
+		return nil
+	}
+	fields := jsonFields(v.Type(), nil)
+	result := gqlObject{}
+	for _, selected := range ex.collect(field.selections, typeName) {
+		if selected.name == "__typename" {
+			result = append(result, gqlMember{selected.key(), typeName})
+			continue
+		}
+		index, ok := fields[selected.name]
+		if !ok {
+			ex.fail(append(path, selected.key()), "cannot query field %q on type %s", selected.name, typeName)
+			continue
+		}
+		if len(selected.args) > 0 {
+			ex.fail(append(path, selected.key()), "field %q takes no arguments", selected.name)
+			continue
+		}
+		value := ex.project(v.FieldByIndex(index), selected, append(path, selected.key()))
+		result = append(result, gqlMember{selected.key(), value})
+	}
+	return result
+}
+
+func gqlTypeName(t reflect.Type) string {
+	if name, ok := gqlTypeNames[t]; ok {
+		return name
+	}
+	return t.Name()
+}
+
+// jsonFields maps the JSON names of the fields of a struct to their indexes,
+// including the fields of embedded structs
+func jsonFields(t reflect.Type, prefix []int) map[string][]int {
+	fields := make(map[string][]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int(nil), prefix...), i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for embedded, embeddedIndex := range jsonFields(f.Type, index) {
+				if _, ok := fields[embedded]; !ok {
+					fields[embedded] = embeddedIndex
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = index
+	}
+	return fields
+}
+
+// collect returns the fields of the selections of an object of the type,
+// spreading its fragments and leaving out fields skipped by directives.
+// Fields of the same response key are merged.
+func (ex *gqlExecutor) collect(selections []gqlSelection, typeName string) []*gqlField {
+	var fields []*gqlField
+	byKey := make(map[string]*gqlField)
+	var walk func(selections []gqlSelection, seen map[string]bool)
+	walk = func(selections []gqlSelection, seen map[string]bool) {
+		for _, selection := range selections {
+			if !ex.included(selection.directives) {
+				continue
+			}
+			switch {
+			case selection.field != nil:
+				key := selection.field.key()
+				if existing, ok := byKey[key]; ok {
+					existing.selections = append(existing.selections, selection.field.selections...)
+					continue
+				}
+				field := *selection.field
+				field.selections = append([]gqlSelection(nil), field.selections...)
+				byKey[key] = &field
+				fields = append(fields, &field)
+			case selection.spread != "":
+				fragment, ok := ex.doc.fragments[selection.spread]
+				if !ok || seen[selection.spread] {
+					continue
+				}
+				if fragment.typeCondition == "" || fragment.typeCondition == typeName {
+					walk(fragment.selections, map[string]bool{selection.spread: true})
+				}
+			default:
+				if selection.typeCondition == "" || selection.typeCondition == typeName {
+					walk(selection.selections, seen)
+				}
+			}
+		}
+	}
+	walk(selections, map[string]bool{})
+	return fields
+}
+
+// included applies the @include and @skip directives
+func (ex *gqlExecutor) included(directives []gqlDirective) bool {
+	for _, directive := range directives {
+		value, _ := ex.value(directive.args["if"]).(bool)
+		if directive.name == "include" && !value || directive.name == "skip" && value {
+			return false
+		}
+	}
+	return true
+}
+
+// arguments evaluates the arguments of the field with the variables
+func (ex *gqlExecutor) arguments(field *gqlField) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(field.args))
+	for name, value := range field.args {
+		args[name] = ex.value(value)
+	}
+	return args, nil
+}
+
+func (ex *gqlExecutor) value(value interface{}) interface{} {
+	switch value := value.(type) {
+	case gqlVariable:
+		return ex.variables[string(value)]
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i := range value {
+			list[i] = ex.value(value[i])
+		}
+		return list
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(value))
+		for key := range value {
+			object[key] = ex.value(value[key])
+		}
+		return object
+	}
+	return value
+}
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlSelection
+}
+
+type gqlOperation struct {
+	name       string
+	defaults   map[string]interface{}
+	selections []gqlSelection
+}
+
+// gqlSelection is a field, a spread of the named fragment or an inline
+// fragment. Named fragments are stored as inline ones.
+type gqlSelection struct {
+	field         *gqlField
+	spread        string
+	typeCondition string
+	selections    []gqlSelection
+	directives    []gqlDirective
+}
+
+type gqlField struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	selections []gqlSelection
+}
+
+// key returns the name of the field in the response
+func (f *gqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type gqlDirective struct {
+	name string
+	args map[string]interface{}
+}
+
+// gqlVariable is a variable used as a value
+type gqlVariable string
+
+// operation returns the operation with the name, or the only one of the
+// document when the name is empty
+func (doc *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(doc.operations) != 1 {
+			return nil, fmt.Errorf("the document has %d operations, operationName is required", len(doc.operations))
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+type gqlToken struct {
+	kind  rune // 'n' name, 'i' int, 'f' float, 's' string, 'p' punctuator, 0 end
+	value string
+}
+
+// lexGQL splits a query into tokens, commas and comments are ignored
+func lexGQL(query string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c) || c == ',' || c == '\uFEFF':
+			i++
+		case c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case c == '.':
+			if i+2 >= len(runes) || runes[i+1] != '.' || runes[i+2] != '.' {
+				return nil, fmt.Errorf("unexpected . at %d", i)
+			}
+			tokens = append(tokens, gqlToken{'p', "..."})
+			i += 3
+		case strings.ContainsRune("!$():=@[]{}|", c):
+			tokens = append(tokens, gqlToken{'p', string(c)})
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'n', string(runes[start:i])})
+		case c == '-' || unicode.IsDigit(c):
+			start := i
+			i++
+			kind := 'i'
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".eE+-", runes[i])) {
+				if !unicode.IsDigit(runes[i]) {
+					kind = 'f'
+				}
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind, string(runes[start:i])})
+		case c == '"':
+			var text strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\n' {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if runes[i] != '\\' {
+					text.WriteRune(runes[i])
+					continue
+				}
+				i++
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				switch runes[i] {
+				case 'n':
+					text.WriteRune('\n')
+				case 't':
+					text.WriteRune('\t')
+				case 'r':
+					text.WriteRune('\r')
+				case 'b':
+					text.WriteRune('\b')
+				case 'f':
+					text.WriteRune('\f')
+				case 'u':
+					if i+4 >= len(runes) {
+						return nil, fmt.Errorf("invalid unicode escape")
+					}
+					code, err := strconv.ParseUint(string(runes[i+1:i+5]), 16, 32)
+					if err != nil {
+						return nil, fmt.Errorf("invalid unicode escape")
+					}
+					text.WriteRune(rune(code))
+					i += 4
+				default:
+					text.WriteRune(runes[i])
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i++
+			tokens = append(tokens, gqlToken{'s', text.String()})
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+}
+
+func (p *gqlParser) peek() gqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return gqlToken{}
+}
+
+func (p *gqlParser) next() gqlToken {
+	token := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return token
+}
+
+// is tells whether the next token is the punctuator
+func (p *gqlParser) is(punctuator string) bool {
+	token := p.peek()
+	return token.kind == 'p' && token.value == punctuator
+}
+
+func (p *gqlParser) expect(punctuator string) error {
+	if token := p.next(); token.kind != 'p' || token.value != punctuator {
+		return fmt.Errorf("expected %s, found %q", punctuator, token.value)
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	token := p.next()
+	if token.kind != 'n' {
+		return "", fmt.Errorf("expected a name, found %q", token.value)
+	}
+	return token.value, nil
+}
+
+// parseGQL parses an executable document of queries and fragments
+func parseGQL(query string) (*gqlDocument, error) {
+	tokens, err := lexGQL(query)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error: %v", err)
+	}
+	p := &gqlParser{tokens: tokens}
+	doc := &gqlDocument{fragments: make(map[string]*gqlSelection)}
+	for p.peek().kind != 0 {
+		if err := p.definition(doc); err != nil {
+			return nil, fmt.Errorf("syntax error: %v", err)
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("the document has no query")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) definition(doc *gqlDocument) error {
+	op := &gqlOperation{defaults: make(map[string]interface{})}
+	if p.is("{") {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return err
+		}
+		op.selections = selections
+		doc.operations = append(doc.operations, op)
+		return nil
+	}
+	keyword, err := p.name()
+	if err != nil {
+		return err
+	}
+	switch keyword {
+	case "fragment":
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if on, err := p.name(); err != nil || on != "on" {
+			return fmt.Errorf("expected on after fragment %s", name)
+		}
+		fragment := &gqlSelection{}
+		if fragment.typeCondition, err = p.name(); err != nil {
+			return err
+		}
+		if fragment.directives, err = p.directives(); err != nil {
+			return err
+		}
+		if fragment.selections, err = p.selectionSet(); err != nil {
+			return err
+		}
+		doc.fragments[name] = fragment
+		return nil
+	case "query":
+	case "mutation", "subscription":
+		return fmt.Errorf("%s operations are not supported", keyword)
+	default:
+		return fmt.Errorf("unexpected %q", keyword)
+	}
+	if p.peek().kind == 'n' {
+		op.name = p.next().value
+	}
+	if p.is("(") {
+		p.next()
+		for !p.is(")") {
+			if err := p.expect("$"); err != nil {
+				return err
+			}
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := p.expect(":"); err != nil {
+				return err
+			}
+			if err := p.typeRef(); err != nil {
+				return err
+			}
+			if p.is("=") {
+				p.next()
+				value, err := p.value()
+				if err != nil {
+					return err
+				}
+				op.defaults[name] = value
+			}
+		}
+		p.next()
+	}
+	if _, err := p.directives(); err != nil {
+		return err
+	}
+	if op.selections, err = p.selectionSet(); err != nil {
+		return err
+	}
+	doc.operations = append(doc.operations, op)
+	return nil
+}
+
+// typeRef skips the type of a variable, arguments are not type checked
+func (p *gqlParser) typeRef() error {
+	if p.is("[") {
+		p.next()
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.is("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []gqlSelection
+	for !p.is("}") {
+		if p.peek().kind == 0 {
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	var selection gqlSelection
+	var err error
+	if p.is("...") {
+		p.next()
+		if token := p.peek(); token.kind == 'n' && token.value != "on" {
+			selection.spread = p.next().value
+			selection.directives, err = p.directives()
+			return selection, err
+		}
+		if token := p.peek(); token.kind == 'n' {
+			p.next()
+			if selection.typeCondition, err = p.name(); err != nil {
+				return selection, err
+			}
+		}
+		if selection.directives, err = p.directives(); err != nil {
+			return selection, err
+		}
+		selection.selections, err = p.selectionSet()
+		return selection, err
+	}
+	field := &gqlField{}
+	if field.name, err = p.name(); err != nil {
+		return selection, err
+	}
+	if p.is(":") {
+		p.next()
+		field.alias = field.name
+		if field.name, err = p.name(); err != nil {
+			return selection, err
+		}
+	}
+	if p.is("(") {
+		if field.args, err = p.arguments(); err != nil {
+			return selection, err
+		}
+	}
+	if selection.directives, err = p.directives(); err != nil {
+		return selection, err
+	}
+	if p.is("{") {
+		if field.selections, err = p.selectionSet(); err != nil {
+			return selection, err
+		}
+	}
+	selection.field = field
+	return selection, nil
+}
+
+func (p *gqlParser) arguments() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{})
+	for !p.is(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *gqlParser) directives() ([]gqlDirective, error) {
+	var directives []gqlDirective
+	for p.is("@") {
+		p.next()
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if name != "include" && name != "skip" {
+			return nil, fmt.Errorf("unknown directive @%s", name)
+		}
+		directive := gqlDirective{name: name}
+		if p.is("(") {
+			if directive.args, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// value parses a literal or a variable, enum values are strings
+func (p *gqlParser) value() (interface{}, error) {
+	token := p.next()
+	switch token.kind {
+	case 'i':
+		return strconv.ParseInt(token.value, 10, 64)
+	case 'f':
+		return strconv.ParseFloat(token.value, 64)
+	case 's':
+		return token.value, nil
+	case 'n':
+		switch token.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return token.value, nil
+	case 'p':
+		switch token.value {
+		case "$":
+			name, err := p.name()
+			return gqlVariable(name), err
+		case "[":
+			list := []interface{}{}
+			for !p.is("]") {
+				if p.peek().kind == 0 {
+					return nil, fmt.Errorf("unterminated list")
+				}
+				value, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			object := make(map[string]interface{})
+			for !p.is("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if object[name], err = p.value(); err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			return object, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q", token.value)
+}
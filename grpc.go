@@ -0,0 +1,403 @@
+package aggregator
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative newspb/news.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/cleonty/news-aggregator/newspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer serves the services of newspb on -grpcPort next to the HTTP API
+type grpcServer struct {
+	newspb.UnimplementedNewsServiceServer
+	newspb.UnimplementedRulesServiceServer
+	app *NewsApp
+}
+
+// newGRPCServer creates the gRPC server, over TLS when the HTTP server is
+// served over TLS
+func (app *NewsApp) newGRPCServer() *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := app.grpcAuth(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := app.grpcAuth(stream.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &grpcStream{stream, ctx})
+		}),
+	}
+	if app.server.TLSConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(app.server.TLSConfig.Clone())))
+	}
+	server := grpc.NewServer(options...)
+	s := &grpcServer{app: app}
+	newspb.RegisterNewsServiceServer(server, s)
+	newspb.RegisterRulesServiceServer(server, s)
+	return server
+}
+
+// grpcStream is a stream with the context of its authenticated user
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcAuth authenticates a call like requireAuth, by the bearer token in the
+// authorization metadata or the API key in x-api-key. The rules service is
+// limited to administrators.
+func (app *NewsApp) grpcAuth(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token, key string
+	if values := md.Get("authorization"); len(values) > 0 {
+		if scheme, value, ok := strings.Cut(values[0], " "); ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(value)
+		}
+	}
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		key = values[0]
+	}
+	user, err := app.authenticate(ctx, token, key)
+	if err == errInvalidToken || err == errInvalidAPIKey {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if user == nil {
+		return ctx, nil
+	}
+	if !user.Admin && strings.HasPrefix(method, "/"+newspb.RulesService_ServiceDesc.ServiceName+"/") {
+		return nil, status.Error(codes.PermissionDenied, "administrators only")
+	}
+	return context.WithValue(ctx, userKey, user), nil
+}
+
+// grpcError converts an error of the database to a status, like errorStatus
+func grpcError(err error) error {
+	if err == errDatabaseBusy || errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// newsFilterFromProto reads the filter of a request, checked like the
+// parameters of /news/
+func newsFilterFromProto(ctx context.Context, f *newspb.NewsFilter) (NewsFilter, error) {
+	filter := NewsFilter{
+		Query:       f.GetQ(),
+		MetaKey:     f.GetMetaKey(),
+		MetaValue:   f.GetMetaValue(),
+		RuleVersion: f.GetRuleVersion(),
+		Source:      f.GetSource(),
+		Category:    f.GetCategory(),
+		Since:       f.GetSince(),
+		Unread:      f.GetUnread(),
+		Starred:     f.GetStarred(),
+		Hidden:      f.GetHidden(),
+	}
+	if user := contextUser(ctx); user != nil {
+		filter.userID = user.ID
+	}
+	for _, bound := range []struct {
+		value **time.Time
+		t     *timestamppb.Timestamp
+	}{{&filter.From, f.GetFrom()}, {&filter.To, f.GetTo()}} {
+		if bound.t != nil {
+			t := bound.t.AsTime()
+			*bound.value = &t
+		}
+	}
+	return filter, filter.validate()
+}
+
+func timestampProto(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func newsItemProto(item *NewsItem) *newspb.NewsItem {
+	return &newspb.NewsItem{
+		Id:          item.ID,
+		StableId:    item.StableID,
+		Link:        item.Link,
+		Title:       item.Title,
+		Source:      item.Source,
+		Category:    item.Category,
+		Summary:     item.Summary,
+		Image:       item.Image,
+		Metadata:    item.Metadata,
+		RuleVersion: item.RuleVersion,
+		Published:   timestampProto(item.Published),
+		Timestamp:   timestamppb.New(item.Timestamp),
+		LastUpdated: timestamppb.New(item.LastUpdated),
+		Seq:         item.Seq,
+		Content:     item.Content,
+		Read:        item.Read,
+		Starred:     item.Starred,
+		Hidden:      item.Hidden,
+	}
+}
+
+func (s *grpcServer) ListNews(ctx context.Context, req *newspb.ListNewsRequest) (*newspb.NewsPage, error) {
+	filter, err := newsFilterFromProto(ctx, req.GetFilter())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	filter.OrderBy = req.GetOrderBy()
+	if _, ok := newsOrders[filter.OrderBy]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown order_by %q", filter.OrderBy)
+	}
+	filter.Limit, filter.Offset = int(req.GetLimit()), int(req.GetOffset())
+	switch {
+	case filter.Limit < 0:
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	case filter.Limit == 0:
+		filter.Limit = defaultSearchLimit
+	case filter.Limit > maxSearchLimit:
+		filter.Limit = maxSearchLimit
+	}
+	if filter.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+	items, err := s.app.getNews(ctx, filter)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	total, err := s.app.countNews(ctx, filter)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	page := &newspb.NewsPage{Total: int32(total), Limit: int32(filter.Limit), Offset: int32(filter.Offset)}
+	for i := range items {
+		page.Items = append(page.Items, newsItemProto(&items[i]))
+	}
+	return page, nil
+}
+
+func (s *grpcServer) GetNewsItem(ctx context.Context, req *newspb.GetNewsItemRequest) (*newspb.NewsItem, error) {
+	var userID int64
+	if user := contextUser(ctx); user != nil {
+		userID = user.ID
+	}
+	item, err := s.app.getNewsItem(ctx, req.GetId(), userID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if item == nil {
+		return nil, status.Errorf(codes.NotFound, "no item with id %d", req.GetId())
+	}
+	return newsItemProto(item), nil
+}
+
+// StreamNewItems sends the new items like streamHandler, at most
+// maxSearchLimit of the newest items at once
+func (s *grpcServer) StreamNewItems(req *newspb.StreamNewItemsRequest, stream newspb.NewsService_StreamNewItemsServer) error {
+	ctx := stream.Context()
+	filter, err := newsFilterFromProto(ctx, req.GetFilter())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	filter.Limit = maxSearchLimit
+	if filter.Since == 0 {
+		if err := s.app.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(seq), 0) FROM news").Scan(&filter.Since); err != nil {
+			return grpcError(err)
+		}
+	}
+	updates := s.app.hub.subscribe()
+	defer s.app.hub.unsubscribe(updates)
+	for {
+		items, err := s.app.getNews(ctx, filter)
+		if err != nil {
+			return grpcError(err)
+		}
+		// the newest items come first
+		for i := len(items) - 1; i >= 0; i-- {
+			if err := stream.Send(newsItemProto(&items[i])); err != nil {
+				return err
+			}
+			filter.Since = items[i].Seq
+		}
+		select {
+		case <-updates:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.app.ctx.Done():
+			return status.Error(codes.Unavailable, "the application is shutting down")
+		}
+	}
+}
+
+func (s *grpcServer) ListSources(ctx context.Context, req *newspb.ListSourcesRequest) (*newspb.ListSourcesResponse, error) {
+	response := &newspb.ListSourcesResponse{}
+	for _, source := range s.app.sourceStatuses(false) {
+		response.Sources = append(response.Sources, &newspb.Source{
+			Id:                  source.ID,
+			Url:                 source.URL,
+			Name:                source.Name,
+			Category:            source.Category,
+			IntervalMinutes:     uint32(source.IntervalMinutes),
+			Schedule:            source.Schedule,
+			Enabled:             source.Enabled,
+			Healthy:             source.Healthy,
+			SiteTitle:           source.SiteTitle,
+			LastSuccess:         timestampProto(source.LastSuccess),
+			LastItems:           int32(source.LastItems),
+			LastInserted:        int32(source.LastInserted),
+			LastError:           source.LastError,
+			LastErrorTime:       timestampProto(source.LastErrorTime),
+			ConsecutiveFailures: int32(source.ConsecutiveFailures),
+			NextRun:             timestampProto(source.NextRun),
+		})
+	}
+	return response, nil
+}
+
+func (s *grpcServer) ListRules(ctx context.Context, req *newspb.ListRulesRequest) (*newspb.ListRulesResponse, error) {
+	s.app.mu.Lock()
+	rules := s.app.parsingRules
+	s.app.mu.Unlock()
+	response := &newspb.ListRulesResponse{}
+	for _, rule := range rules {
+		data, err := json.Marshal(rule)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		response.Rules = append(response.Rules, &newspb.Rule{Url: rule.URL, Json: string(data)})
+	}
+	return response, nil
+}
+
+// ruleIndex returns the index of the rule with the url, -1 when there is none
+func ruleIndex(rules []*ParsingRule, url string) int {
+	for i, rule := range rules {
+		if rule.URL == url {
+			return i
+		}
+	}
+	return -1
+}
+
+func ruleFromProto(rule *newspb.Rule) (*ParsingRule, error) {
+	parsed := new(ParsingRule)
+	if err := json.Unmarshal([]byte(rule.GetJson()), parsed); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "error while reading the rule: %v", err)
+	}
+	return parsed, nil
+}
+
+// changeRules applies a change to a copy of the rules, then saves and
+// switches to them like rulesHandler
+func (s *grpcServer) changeRules(change func(rules []*ParsingRule) ([]*ParsingRule, error)) (*newspb.RuleChanges, error) {
+	app := s.app
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	rules, err := change(append([]*ParsingRule(nil), app.parsingRules...))
+	if err != nil {
+		return nil, err
+	}
+	if err := app.prepareChangedRules(rules); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := writeParsingRules(app.config.RulesFile, rules); err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to save parsing rules: %v", err)
+	}
+	changes, err := app.replaceParsingRules(rules)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return ruleChangesProto(changes), nil
+}
+
+func ruleChangesProto(changes ruleChanges) *newspb.RuleChanges {
+	return &newspb.RuleChanges{Rules: int32(changes.Rules), Added: changes.Added, Removed: changes.Removed, Changed: changes.Changed}
+}
+
+func (s *grpcServer) AddRule(ctx context.Context, req *newspb.AddRuleRequest) (*newspb.RuleChanges, error) {
+	rule, err := ruleFromProto(req.GetRule())
+	if err != nil {
+		return nil, err
+	}
+	return s.changeRules(func(rules []*ParsingRule) ([]*ParsingRule, error) {
+		if ruleIndex(rules, rule.URL) >= 0 {
+			return nil, status.Errorf(codes.AlreadyExists, "a rule with url %q exists", rule.URL)
+		}
+		return append(rules, rule), nil
+	})
+}
+
+func (s *grpcServer) ReplaceRule(ctx context.Context, req *newspb.ReplaceRuleRequest) (*newspb.RuleChanges, error) {
+	rule, err := ruleFromProto(req.GetRule())
+	if err != nil {
+		return nil, err
+	}
+	return s.changeRules(func(rules []*ParsingRule) ([]*ParsingRule, error) {
+		index := ruleIndex(rules, req.GetUrl())
+		if index < 0 {
+			return nil, status.Errorf(codes.NotFound, "no rule with url %q", req.GetUrl())
+		}
+		rules[index] = rule
+		return rules, nil
+	})
+}
+
+func (s *grpcServer) DeleteRule(ctx context.Context, req *newspb.DeleteRuleRequest) (*newspb.RuleChanges, error) {
+	return s.changeRules(func(rules []*ParsingRule) ([]*ParsingRule, error) {
+		index := ruleIndex(rules, req.GetUrl())
+		if index < 0 {
+			return nil, status.Errorf(codes.NotFound, "no rule with url %q", req.GetUrl())
+		}
+		return append(rules[:index], rules[index+1:]...), nil
+	})
+}
+
+func (s *grpcServer) ReloadRules(ctx context.Context, req *newspb.ReloadRulesRequest) (*newspb.RuleChanges, error) {
+	changes, err := s.app.reloadParsingRules()
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return ruleChangesProto(changes), nil
+}
+
+// stopGRPC stops the gRPC server, waiting for the open calls until the
+// context is done
+func (app *NewsApp) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		app.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Warn("unable to finish open gRPC calls")
+		app.grpc.Stop()
+	}
+}
@@ -0,0 +1,35 @@
+package aggregator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cleonty/news-aggregator/newspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestChangeRulesKeepsLiveRules(t *testing.T) {
+	tests := []struct {
+		json string
+		code codes.Code
+	}{
+		{`{"url": "https://example.org/", "intervalMinutes": 30, "newsNodesExpr": "//li", "linkRule": {"expr": "a", "attr": "href"}, "titleRule": {"expr": "a"}}`, codes.OK},
+		{`{"url": "https://example.org/"}`, codes.InvalidArgument},
+		{`{"url": "https://example.com/", "intervalMinutes": 30}`, codes.AlreadyExists},
+	}
+	for _, test := range tests {
+		app, live := newRulesTestApp(t)
+		cron := live.cron
+		detailRules := reflect.ValueOf(live.DetailRules).Pointer()
+		server := &grpcServer{app: app}
+		_, err := server.AddRule(context.Background(), &newspb.AddRuleRequest{Rule: &newspb.Rule{Json: test.json}})
+		if code := status.Code(err); code != test.code {
+			t.Errorf("AddRule(%s): got %v, want %v: %v", test.json, code, test.code, err)
+		}
+		if live.cron != cron || reflect.ValueOf(live.DetailRules).Pointer() != detailRules {
+			t.Errorf("AddRule(%s): the live rule was compiled again", test.json)
+		}
+	}
+}
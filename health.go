@@ -0,0 +1,82 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// waitForAddress blocks until a TCP connection to the address succeeds
+func waitForAddress(address string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is not reachable after %v: %v", address, timeout, err)
+		}
+		slog.Info("waiting for address", "address", address, "err", err)
+		time.Sleep(time.Second)
+	}
+}
+
+const healthPingTimeout = 2 * time.Second
+
+// healthHandler reports ready once the database answers and every enabled
+// source has been fetched successfully
+func (app *NewsApp) healthHandler(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	rules := app.parsingRules
+	app.mu.Unlock()
+	pending := make([]string, 0)
+	for _, rule := range rules {
+		if rule.enabled() && app.statuses.report(rule.URL, app.config.MaxErrorAge).LastSuccess == nil {
+			pending = append(pending, rule.URL)
+		}
+	}
+	health := struct {
+		Status   string   `json:"status"`
+		Sources  int      `json:"sources"`
+		Pending  []string `json:"pending,omitempty"`
+		Database string   `json:"database,omitempty"`
+	}{Status: "ok", Sources: len(rules), Pending: pending}
+	status := http.StatusOK
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+	if err := app.db.PingContext(ctx); err != nil {
+		health.Status = "database unavailable"
+		health.Database = err.Error()
+		status = http.StatusServiceUnavailable
+	} else if len(pending) > 0 {
+		health.Status = "not ready"
+		status = http.StatusServiceUnavailable
+	}
+	data, err := json.Marshal(health)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s\n", data)
+}
+
+// livenessHandler serves /healthz, it only checks that the database answers
+// so a source not fetched yet does not get the process restarted
+func (app *NewsApp) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+	if err := app.db.PingContext(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("database unavailable: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
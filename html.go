@@ -0,0 +1,92 @@
+package aggregator
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const htmlPageSize = 50
+
+var newsPage = template.Must(template.New("news").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>News</title>
+</head>
+<body>
+<form action="/html" method="get">
+<input type="text" name="q" value="{{.Query}}">
+<input type="submit" value="Search">
+</form>
+<ul>
+{{range .Items}}<li>{{if .Image}}<img src="{{.Image}}" alt="" height="48"> {{end}}<a href="{{.Link}}">{{.Title}}</a> <small>{{.Timestamp.Format "2006-01-02 15:04"}}</small>{{if .Summary}}<br>{{.Summary}}{{end}}</li>
+{{else}}<li>No news found</li>
+{{end}}</ul>
+<p>
+{{if .PrevPage}}<a href="{{.PrevPage}}">&laquo; Newer</a>{{end}}
+{{if .NextPage}}<a href="{{.NextPage}}">Older &raquo;</a>{{end}}
+</p>
+</body>
+</html>
+`))
+
+type newsPageData struct {
+	Query    string
+	Items    []NewsItem
+	PrevPage string
+	NextPage string
+}
+
+// pageURL returns the URL of another page keeping the other query parameters
+func pageURL(r *http.Request, page int) string {
+	query := url.Values{}
+	for name, values := range r.Form {
+		query[name] = values
+	}
+	query.Set("page", strconv.Itoa(page))
+	return "/html?" + query.Encode()
+}
+
+// htmlHandler renders the news as a plain HTML page usable without JavaScript
+func (app *NewsApp) htmlHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page := 1
+	if value := r.Form.Get("page"); value != "" {
+		var err error
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			http.Error(w, "page must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	filter, err := newsFilterFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// one extra item tells whether there is a next page
+	filter.Limit = htmlPageSize + 1
+	filter.Offset = (page - 1) * htmlPageSize
+	items, err := app.getNews(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	data := newsPageData{Query: filter.Query, Items: items}
+	if len(items) > htmlPageSize {
+		data.Items = items[:htmlPageSize]
+		data.NextPage = pageURL(r, page+1)
+	}
+	if page > 1 {
+		data.PrevPage = pageURL(r, page-1)
+	}
+	w.Header().Set("Content-type", "text/html; charset=utf-8")
+	if err := newsPage.Execute(w, data); err != nil {
+		slog.Error("unable to render news page", "err", err)
+	}
+}
@@ -0,0 +1,108 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxImageSize limits the size of a cached image
+const maxImageSize = 5 << 20
+
+// imageFile returns the path of the cached copy of the image
+func (app *NewsApp) imageFile(imageURL string) string {
+	sum := sha1.Sum([]byte(imageURL))
+	return filepath.Join(app.config.ImageCache, hex.EncodeToString(sum[:10]))
+}
+
+// cacheImages downloads the images of the items to -imageCache, images
+// already cached are skipped and a failed download leaves the item with its
+// remote image only
+func (app *NewsApp) cacheImages(ctx context.Context, rule *ParsingRule, items []NewsItem) {
+	for _, item := range items {
+		if item.Image == "" || ctx.Err() != nil {
+			continue
+		}
+		path := app.imageFile(item.Image)
+		if fileExists(path) {
+			continue
+		}
+		if err := app.downloadImage(ctx, rule, item.Image, path); err != nil {
+			slog.Warn("unable to cache image", "source", rule.URL, "image", item.Image, "err", err)
+		}
+	}
+}
+
+func (app *NewsApp) downloadImage(ctx context.Context, rule *ParsingRule, imageURL, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := app.fetch(req, rule)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "image/") {
+		return fmt.Errorf("not an image: %q", contentType)
+	}
+	if err := os.MkdirAll(app.config.ImageCache, 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(app.config.ImageCache, ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	written, err := io.Copy(file, io.LimitReader(resp.Body, maxImageSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written > maxImageSize {
+		return fmt.Errorf("image is larger than %d bytes", maxImageSize)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// imageHandler serves /images/{id}, the cached image of the item or else a
+// redirect to the image on its site
+func (app *NewsApp) imageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/images/"), 10, 64)
+	if err != nil {
+		http.Error(w, "the item id must be a number", http.StatusBadRequest)
+		return
+	}
+	item, err := app.getNewsItem(r.Context(), id, requestUserID(r))
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if item == nil || item.Image == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if app.config.ImageCache != "" {
+		if path := app.imageFile(item.Image); fileExists(path) {
+			w.Header().Set("Cache-Control", "max-age=86400")
+			http.ServeFile(w, r, path)
+			return
+		}
+	}
+	http.Redirect(w, r, item.Image, http.StatusFound)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
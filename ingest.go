@@ -0,0 +1,63 @@
+package aggregator
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	ingestLogAll     = "all"
+	ingestLogChanges = "changes"
+	ingestLogNone    = "none"
+)
+
+type insertResult int
+
+const (
+	itemInserted insertResult = iota + 1
+	itemUpdated
+	itemDuplicate
+)
+
+// ingestStats are counters of a single updateNews cycle of a source
+type ingestStats struct {
+	matched         int
+	inserted        int
+	updated         int
+	duplicates      int
+	skippedEmpty    int
+	skippedFiltered int
+	errors          int
+	detailErrors    int
+	// parseTime is the time spent extracting the items from the page and
+	// duration the time of the whole update
+	parseTime time.Duration
+	duration  time.Duration
+	// nextPage is the link to older items found on the page by nextPageRule
+	nextPage string
+}
+
+func (stats *ingestStats) count(result insertResult) {
+	switch result {
+	case itemInserted:
+		stats.inserted++
+	case itemUpdated:
+		stats.updated++
+	case itemDuplicate:
+		stats.duplicates++
+	}
+}
+
+func (stats *ingestStats) log(source string, verbosity string) {
+	switch verbosity {
+	case ingestLogNone:
+		return
+	case ingestLogChanges:
+		if stats.inserted == 0 && stats.updated == 0 && stats.errors == 0 {
+			return
+		}
+	}
+	slog.Info("ingested", "source", source, "matched", stats.matched, "new", stats.inserted, "updated", stats.updated,
+		"duplicates", stats.duplicates, "skipped_empty", stats.skippedEmpty, "skipped_filtered", stats.skippedFiltered,
+		"errors", stats.errors, "detail_errors", stats.detailErrors, "parse_time", stats.parseTime, "duration", stats.duration)
+}
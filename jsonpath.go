@@ -0,0 +1,196 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonStep is one step of a JSONPath expression: a member, an index, a
+// wildcard or a recursive descent to members
+type jsonStep struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+// parseJSONPath parses the JSONPath subset of the json rules: $ or @ followed
+// by .name, ['name'], [n] with negative n counting from the end, [*], .* and
+// ..name. An expression without $ or @ is relative to the current node, so
+// "data.items[*]" equals "$.data.items[*]".
+func parseJSONPath(expr string) ([]jsonStep, error) {
+	rest := strings.TrimSpace(expr)
+	if rest == "" {
+		return nil, fmt.Errorf("empty JSONPath")
+	}
+	if rest[0] == '$' || rest[0] == '@' {
+		rest = rest[1:]
+	} else if rest[0] != '[' && rest[0] != '.' {
+		rest = "." + rest
+	}
+	var steps []jsonStep
+	for rest != "" {
+		var step jsonStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				bracket, remaining, err := parseJSONBracket(rest)
+				if err != nil {
+					return nil, fmt.Errorf("JSONPath %q: %v", expr, err)
+				}
+				bracket.recursive = true
+				steps, rest = append(steps, bracket), remaining
+				continue
+			}
+			step.name, rest = jsonName(rest)
+		case rest[0] == '.':
+			step.name, rest = jsonName(rest[1:])
+		case rest[0] == '[':
+			bracket, remaining, err := parseJSONBracket(rest)
+			if err != nil {
+				return nil, fmt.Errorf("JSONPath %q: %v", expr, err)
+			}
+			steps, rest = append(steps, bracket), remaining
+			continue
+		default:
+			return nil, fmt.Errorf("JSONPath %q: unexpected %q", expr, rest[0])
+		}
+		if step.name == "" {
+			return nil, fmt.Errorf("JSONPath %q: missing member name", expr)
+		}
+		if step.name == "*" {
+			step.name, step.wildcard = "", true
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// jsonName splits a member name off the rest of the expression
+func jsonName(rest string) (string, string) {
+	end := strings.IndexAny(rest, ".[")
+	if end < 0 {
+		return rest, ""
+	}
+	return rest[:end], rest[end:]
+}
+
+// parseJSONBracket parses [n], [*] or a quoted member name
+func parseJSONBracket(rest string) (jsonStep, string, error) {
+	end := strings.Index(rest, "]")
+	if end < 0 {
+		return jsonStep{}, "", fmt.Errorf("unterminated [")
+	}
+	inner, remaining := strings.TrimSpace(rest[1:end]), rest[end+1:]
+	switch {
+	case inner == "*":
+		return jsonStep{wildcard: true}, remaining, nil
+	case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		return jsonStep{name: inner[1 : len(inner)-1]}, remaining, nil
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return jsonStep{}, "", fmt.Errorf("unsupported [%s]", inner)
+	}
+	return jsonStep{index: index, isIndex: true}, remaining, nil
+}
+
+// evalJSONPath returns the values the steps select from the node, the members
+// of objects in the order of their names
+func evalJSONPath(node interface{}, steps []jsonStep) []interface{} {
+	current := []interface{}{node}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range current {
+			if step.recursive {
+				for _, descendant := range jsonDescendants(value, nil) {
+					next = append(next, step.apply(descendant)...)
+				}
+			} else {
+				next = append(next, step.apply(value)...)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+func (step jsonStep) apply(value interface{}) []interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			result := make([]interface{}, 0, len(value))
+			for _, name := range sortedMembers(value) {
+				result = append(result, value[name])
+			}
+			return result
+		}
+		if member, ok := value[step.name]; ok && !step.isIndex {
+			return []interface{}{member}
+		}
+	case []interface{}:
+		if step.wildcard {
+			return value
+		}
+		if step.isIndex {
+			index := step.index
+			if index < 0 {
+				index += len(value)
+			}
+			if index >= 0 && index < len(value) {
+				return []interface{}{value[index]}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonDescendants appends the value and all values nested in it
+func jsonDescendants(value interface{}, result []interface{}) []interface{} {
+	result = append(result, value)
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, name := range sortedMembers(value) {
+			result = jsonDescendants(value[name], result)
+		}
+	case []interface{}:
+		for _, element := range value {
+			result = jsonDescendants(element, result)
+		}
+	}
+	return result
+}
+
+func sortedMembers(object map[string]interface{}) []string {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonText returns a value as text, objects and arrays as JSON
+func jsonText(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
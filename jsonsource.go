@@ -0,0 +1,155 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xpath"
+)
+
+// ruleTypeJSON rules read a JSON document, newsNodesExpr and the expressions
+// of the extract rules are JSONPath instead of XPath
+const ruleTypeJSON = "json"
+
+// loadJSONNews requests the JSON document of the rule and extracts its items
+func (app *NewsApp) loadJSONNews(ctx context.Context, rule *ParsingRule, stats *ingestStats) ([]NewsItem, error) {
+	req, err := newRuleRequest(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := app.fetch(req, rule)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	doc, err := parseJSONDocument(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	defer func() { stats.parseTime = time.Since(start) }()
+	return app.extractJSONNews(rule, doc, stats)
+}
+
+func parseJSONDocument(r io.Reader) (interface{}, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON document: %v", err)
+	}
+	return doc, nil
+}
+
+// extractJSONNews turns the nodes selected by newsNodesExpr into items like
+// the entries of a feed
+func (app *NewsApp) extractJSONNews(rule *ParsingRule, doc interface{}, stats *ingestStats) ([]NewsItem, error) {
+	steps, err := parseJSONPath(rule.NewsNodesXPathExpr)
+	if err != nil {
+		return nil, err
+	}
+	var entries []feedEntry
+	for _, node := range evalJSONPath(doc, steps) {
+		entry := feedEntry{
+			link:  extractJSONValue(node, &rule.LinkRule),
+			title: extractJSONValue(node, &rule.TitleRule),
+		}
+		if rule.SummaryRule != nil {
+			entry.summary = extractJSONValue(node, rule.SummaryRule)
+		}
+		if rule.ImageRule != nil {
+			entry.image = extractJSONValue(node, rule.ImageRule)
+		}
+		if rule.DateRule != nil {
+			entry.published = extractJSONValue(node, rule.DateRule)
+		}
+		if len(rule.MetadataRules) > 0 {
+			entry.metadata = make(map[string]string)
+			for name, metadataRule := range rule.MetadataRules {
+				entry.metadata[name] = extractJSONValue(node, &metadataRule)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return app.extractFeedNews(rule, entries, stats)
+}
+
+// extractJSONValue returns the first value the expression of the rule or of
+// its alternatives selects, empty when none does
+func extractJSONValue(node interface{}, rule *ExtractRule) string {
+	if rule.XPathExpr != "" {
+		if steps, err := parseJSONPath(rule.XPathExpr); err == nil {
+			for _, value := range evalJSONPath(node, steps) {
+				if text := strings.TrimSpace(jsonText(value)); text != "" {
+					return rule.transform(text)
+				}
+			}
+		}
+	}
+	for i := range rule.Alternatives {
+		if value := extractJSONValue(node, &rule.Alternatives[i]); value != "" {
+			return rule.transform(value)
+		}
+	}
+	return ""
+}
+
+// validateJSONPaths parses the JSONPath expressions of a json rule, the
+// detail rules still apply XPath to the pages of the items
+func (rule *ParsingRule) validateJSONPaths() []string {
+	var problems []string
+	var checkRule func(field string, extract *ExtractRule, required bool)
+	checkRule = func(field string, extract *ExtractRule, required bool) {
+		if extract.Selector != "" {
+			problems = append(problems, field+".selector is not supported by json rules")
+		}
+		if extract.XPathExpr == "" {
+			if required {
+				problems = append(problems, field+".expr is empty")
+			}
+		} else if _, err := parseJSONPath(extract.XPathExpr); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.expr: %v", field, err))
+		}
+		for i := range extract.Alternatives {
+			checkRule(fmt.Sprintf("%s.alternatives[%d]", field, i), &extract.Alternatives[i], true)
+		}
+	}
+	if rule.NewsNodesSelector != "" || rule.Pairing != nil {
+		problems = append(problems, "newsNodesSelector and pairing are not supported by json rules")
+	}
+	if rule.NewsNodesXPathExpr == "" {
+		problems = append(problems, "newsNodesExpr is empty")
+	} else if _, err := parseJSONPath(rule.NewsNodesXPathExpr); err != nil {
+		problems = append(problems, fmt.Sprintf("newsNodesExpr: %v", err))
+	}
+	checkRule("linkRule", &rule.LinkRule, true)
+	checkRule("titleRule", &rule.TitleRule, !rule.PageMetadata || !rule.TitleRule.isEmpty())
+	if rule.SummaryRule != nil {
+		checkRule("summaryRule", rule.SummaryRule, true)
+	}
+	if rule.ImageRule != nil {
+		checkRule("imageRule", rule.ImageRule, true)
+	}
+	if rule.DateRule != nil {
+		checkRule("dateRule", rule.DateRule, true)
+	}
+	for _, field := range sortedRuleNames(rule.MetadataRules) {
+		extract := rule.MetadataRules[field]
+		checkRule("metadataRules."+field, &extract, true)
+	}
+	for _, field := range sortedRuleNames(rule.DetailRules) {
+		extract := rule.DetailRules[field]
+		if extract.Selector != "" {
+			if _, err := cssToXPath(extract.Selector); err != nil {
+				problems = append(problems, fmt.Sprintf("detailRules.%s.selector does not compile: %v", field, err))
+			}
+		} else if _, err := xpath.Compile(extract.XPathExpr); err != nil {
+			problems = append(problems, fmt.Sprintf("detailRules.%s.expr %q does not compile: %v", field, extract.XPathExpr, err))
+		}
+	}
+	return problems
+}
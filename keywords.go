@@ -0,0 +1,103 @@
+package aggregator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// keywordMatcher matches texts containing any of its keywords ignoring case
+type keywordMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+// newKeywordMatcher compiles the keywords. With wholeWords a keyword matches
+// only when it is not a part of a longer word.
+func newKeywordMatcher(keywords []string, wholeWords bool) (*keywordMatcher, error) {
+	m := &keywordMatcher{}
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" {
+			continue
+		}
+		expr := regexp.QuoteMeta(keyword)
+		if wholeWords {
+			// \b only knows ASCII letters so word boundaries are spelled out
+			expr = `(?:^|[^\p{L}\p{N}_])` + expr + `(?:$|[^\p{L}\p{N}_])`
+		}
+		pattern, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, pattern)
+	}
+	return m, nil
+}
+
+// newPatternMatcher compiles the patterns, a pattern written as /expr/ is a
+// regular expression and any other one a substring, both ignoring case
+func newPatternMatcher(patterns []string) (*keywordMatcher, error) {
+	m := &keywordMatcher{}
+	for _, pattern := range patterns {
+		expr := regexp.QuoteMeta(pattern)
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			expr = pattern[1 : len(pattern)-1]
+		} else if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		compiled, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q does not compile: %v", pattern, err)
+		}
+		m.patterns = append(m.patterns, compiled)
+	}
+	return m, nil
+}
+
+func (rule *ParsingRule) compileKeywords() error {
+	var err error
+	if rule.include, err = newKeywordMatcher(rule.IncludeKeywords, false); err != nil {
+		return err
+	}
+	if rule.exclude, err = newKeywordMatcher(rule.ExcludeKeywords, false); err != nil {
+		return err
+	}
+	if rule.includePatterns, err = newPatternMatcher(rule.IncludePatterns); err != nil {
+		return err
+	}
+	rule.excludePatterns, err = newPatternMatcher(rule.ExcludePatterns)
+	return err
+}
+
+// keepItem reports whether the item passes the keywords of the rule, which
+// are matched with its title, and the patterns, which are matched with its
+// title and summary
+func (rule *ParsingRule) keepItem(item *NewsItem) bool {
+	text := item.Title
+	if item.Summary != "" {
+		text += "\n" + item.Summary
+	}
+	if rule.exclude.matches(item.Title) || rule.excludePatterns.matches(text) {
+		return false
+	}
+	if !rule.include.empty() && !rule.include.matches(item.Title) {
+		return false
+	}
+	return rule.includePatterns.empty() || rule.includePatterns.matches(text)
+}
+
+func (m *keywordMatcher) empty() bool {
+	return m == nil || len(m.patterns) == 0
+}
+
+func (m *keywordMatcher) matches(text string) bool {
+	if m == nil {
+		return false
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package aggregator
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// languageMinLetters is the number of letters a text needs for its language
+// to be detected
+const languageMinLetters = 3
+
+// languagePattern matches the ISO 639-1 codes of the language hint of rules
+var languagePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+// scriptLanguages are the languages of the scripts used by a single one
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+}
+
+// latinStopWords are frequent words telling apart the languages written in
+// the Latin script
+var latinStopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "for", "on", "with", "as", "at", "by", "from", "after", "new", "how", "why", "what", "are", "was", "be", "it", "its", "this", "that", "has", "over", "will", "says"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "mit", "von", "den", "dem", "ein", "eine", "auf", "für", "sich", "auch", "wird", "nach", "bei", "zum", "zur"},
+	"fr": {"le", "la", "les", "des", "et", "est", "une", "du", "pour", "dans", "sur", "pas", "avec", "qui", "au", "aux", "par", "ce", "sont"},
+	"es": {"el", "los", "las", "del", "y", "es", "una", "por", "con", "para", "que", "se", "su", "al", "como", "más"},
+	"it": {"il", "gli", "della", "di", "che", "è", "per", "una", "con", "non", "sono", "nel", "alla", "dei"},
+	"pt": {"os", "das", "dos", "não", "uma", "com", "para", "em", "que", "ao", "na", "no", "é", "mais"},
+	"nl": {"het", "een", "van", "en", "niet", "met", "voor", "op", "zijn", "dat", "wordt", "ook"},
+}
+
+// latinStopWordLanguages maps every stop word to its languages
+var latinStopWordLanguages = func() map[string][]string {
+	languages := make(map[string][]string)
+	for language, words := range latinStopWords {
+		for _, word := range words {
+			languages[word] = append(languages[word], language)
+		}
+	}
+	return languages
+}()
+
+// detectLanguage returns the ISO 639-1 code of the language of the text by its
+// script and, for the Latin script, by its stop words. It is empty when the
+// text is too short or has no known words.
+func detectLanguage(text string) string {
+	var letters, cyrillic, latin int
+	scripts := make(map[string]int)
+	ukrainian := false
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			// і, ї, є and ґ are not used by Russian
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian = true
+			}
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					scripts[s.language]++
+					break
+				}
+			}
+		}
+	}
+	if letters < languageMinLetters {
+		return ""
+	}
+	best, count := "", 0
+	for language, n := range scripts {
+		if n > count || (n == count && language < best) {
+			best, count = language, n
+		}
+	}
+	// kana among Han characters is Japanese
+	if best == "zh" && scripts["ja"] > 0 {
+		best, count = "ja", count+scripts["ja"]
+	}
+	switch {
+	case cyrillic > latin && cyrillic > count:
+		if ukrainian {
+			return "uk"
+		}
+		return "ru"
+	case latin > count:
+		return latinLanguage(text)
+	}
+	return best
+}
+
+// latinLanguage returns the language whose stop words the text has most of
+func latinLanguage(text string) string {
+	scores := make(map[string]int)
+	for _, word := range titleWords(text) {
+		for _, language := range latinStopWordLanguages[word] {
+			scores[language]++
+		}
+	}
+	best, score := "", 0
+	for language, n := range scores {
+		if n > score || (n == score && language < best) {
+			best, score = language, n
+		}
+	}
+	return best
+}
+
+// itemLanguage detects the language of the title, the summary and the stored
+// content of the item, the Language hint of the rule is used when it can not
+// be detected
+func (rule *ParsingRule) itemLanguage(item *NewsItem) string {
+	text := item.Title
+	if item.Summary != "" {
+		text += "\n" + item.Summary
+	}
+	if item.Content != "" {
+		text += "\n" + item.Content
+	}
+	if language := detectLanguage(text); language != "" {
+		return language
+	}
+	return rule.Language
+}
@@ -0,0 +1,246 @@
+package aggregator
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchDurationBuckets are the upper bounds in seconds of the fetch duration
+// histogram
+var fetchDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// latencyBuckets are the upper bounds in seconds of the API request and the
+// database query histograms
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 5}
+
+// histogram counts observations per bucket bound, the counts are made
+// cumulative when exposed
+type histogram struct {
+	bounds  []float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(seconds float64) {
+	for i, bound := range h.bounds {
+		if seconds <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (h *histogram) write(buf *bytes.Buffer, name string, labels string) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.buckets[i]
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(buf, "%s_sum{%s} %g\n", name, labels, h.sum)
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+type sourceMetrics struct {
+	name        string
+	inserted    uint64
+	duplicates  uint64
+	fetchErrors uint64
+	fetches     *histogram
+	lastSuccess time.Time
+	// parses and parseSeconds add up the extraction of successful updates
+	parses       uint64
+	parseSeconds float64
+}
+
+// metrics are the counters of the sources, the API and the database exposed
+// in the Prometheus text format
+type metrics struct {
+	mu      sync.Mutex
+	sources map[string]*sourceMetrics
+	// requests are the API latencies by route, queries the database
+	// latencies by query
+	requests map[string]*histogram
+	queries  map[string]*histogram
+}
+
+func (m *metrics) source(rule *ParsingRule) *sourceMetrics {
+	if m.sources == nil {
+		m.sources = make(map[string]*sourceMetrics)
+	}
+	source, ok := m.sources[rule.URL]
+	if !ok {
+		source = &sourceMetrics{fetches: newHistogram(fetchDurationBuckets)}
+		m.sources[rule.URL] = source
+	}
+	source.name = rule.Source()
+	return source
+}
+
+// observeFetch records the duration and the outcome of loading the items of
+// the rule
+func (m *metrics) observeFetch(rule *ParsingRule, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	source := m.source(rule)
+	source.fetches.observe(duration.Seconds())
+	if err != nil {
+		source.fetchErrors++
+	} else {
+		source.lastSuccess = time.Now()
+	}
+}
+
+// observeParse records the time spent extracting the items of an update
+func (m *metrics) observeParse(rule *ParsingRule, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	source := m.source(rule)
+	source.parses++
+	source.parseSeconds += duration.Seconds()
+}
+
+// addStored counts the items of an update stored for the first time and
+// those skipped as duplicates
+func (m *metrics) addStored(rule *ParsingRule, inserted int, duplicates int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	source := m.source(rule)
+	source.inserted += uint64(inserted)
+	source.duplicates += uint64(duplicates)
+}
+
+// sourceStats adds the counters of the source to the stats
+func (m *metrics) sourceStats(url string, stats *SourceStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	source, ok := m.sources[url]
+	if !ok {
+		return
+	}
+	stats.Inserted = source.inserted
+	stats.Duplicates = source.duplicates
+	stats.Fetches = source.fetches.count
+	stats.FetchErrors = source.fetchErrors
+	if source.fetches.count > 0 {
+		stats.AverageFetchSeconds = source.fetches.sum / float64(source.fetches.count)
+	}
+	if source.parses > 0 {
+		stats.AverageParseSeconds = source.parseSeconds / float64(source.parses)
+	}
+}
+
+func observeLatency(histograms *map[string]*histogram, key string, duration time.Duration) {
+	if *histograms == nil {
+		*histograms = make(map[string]*histogram)
+	}
+	h, ok := (*histograms)[key]
+	if !ok {
+		h = newHistogram(latencyBuckets)
+		(*histograms)[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// observeRequest records the latency of an API request to the route
+func (m *metrics) observeRequest(route string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observeLatency(&m.requests, route, duration)
+}
+
+// observeQuery records the duration of a database query, queries are named
+// by what they do such as search or store
+func (m *metrics) observeQuery(query string, start time.Time) {
+	duration := time.Since(start)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observeLatency(&m.queries, query, duration)
+}
+
+// write writes all metrics in the Prometheus text exposition format
+func (m *metrics) write(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	urls := make([]string, 0, len(m.sources))
+	for url := range m.sources {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	labels := func(url string) string {
+		return fmt.Sprintf(`source="%s",name="%s"`, escapeLabel(url), escapeLabel(m.sources[url].name))
+	}
+	buf.WriteString("# HELP news_items_inserted_total Items stored for the first time.\n# TYPE news_items_inserted_total counter\n")
+	for _, url := range urls {
+		fmt.Fprintf(buf, "news_items_inserted_total{%s} %d\n", labels(url), m.sources[url].inserted)
+	}
+	buf.WriteString("# HELP news_items_duplicate_total Items skipped because they were already stored.\n# TYPE news_items_duplicate_total counter\n")
+	for _, url := range urls {
+		fmt.Fprintf(buf, "news_items_duplicate_total{%s} %d\n", labels(url), m.sources[url].duplicates)
+	}
+	buf.WriteString("# HELP news_fetch_errors_total Failed loads of a source.\n# TYPE news_fetch_errors_total counter\n")
+	for _, url := range urls {
+		fmt.Fprintf(buf, "news_fetch_errors_total{%s} %d\n", labels(url), m.sources[url].fetchErrors)
+	}
+	buf.WriteString("# HELP news_fetch_duration_seconds Duration of loading the items of a source.\n# TYPE news_fetch_duration_seconds histogram\n")
+	for _, url := range urls {
+		m.sources[url].fetches.write(buf, "news_fetch_duration_seconds", labels(url))
+	}
+	buf.WriteString("# HELP news_last_success_timestamp_seconds Unix time of the last successful load of a source.\n# TYPE news_last_success_timestamp_seconds gauge\n")
+	for _, url := range urls {
+		if last := m.sources[url].lastSuccess; !last.IsZero() {
+			fmt.Fprintf(buf, "news_last_success_timestamp_seconds{%s} %d\n", labels(url), last.Unix())
+		}
+	}
+	buf.WriteString("# HELP news_http_request_duration_seconds Latency of API requests by route.\n# TYPE news_http_request_duration_seconds histogram\n")
+	writeHistograms(buf, "news_http_request_duration_seconds", "route", m.requests)
+	buf.WriteString("# HELP news_db_query_duration_seconds Duration of database queries.\n# TYPE news_db_query_duration_seconds histogram\n")
+	writeHistograms(buf, "news_db_query_duration_seconds", "query", m.queries)
+}
+
+func writeHistograms(buf *bytes.Buffer, name string, label string, histograms map[string]*histogram) {
+	keys := make([]string, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		histograms[key].write(buf, name, fmt.Sprintf(`%s="%s"`, label, escapeLabel(key)))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func (app *NewsApp) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	app.metrics.write(&buf)
+	app.pool.writeMetrics(&buf)
+	w.Header().Set("Content-type", "text/plain; version=0.0.4; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// instrument records the latency of the requests of the route
+func (app *NewsApp) instrument(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler.ServeHTTP(w, r)
+		app.metrics.observeRequest(route, time.Since(start))
+	})
+}
@@ -0,0 +1,527 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: newspb/news.proto
+
+// The gRPC API of the aggregator, served on -grpcPort. Requests are
+// authenticated like the HTTP API: the token of a user session in the
+// authorization metadata as "Bearer <token>" or the API key in x-api-key.
+
+package newspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	NewsService_ListNews_FullMethodName       = "/newsaggregator.v1.NewsService/ListNews"
+	NewsService_GetNewsItem_FullMethodName    = "/newsaggregator.v1.NewsService/GetNewsItem"
+	NewsService_StreamNewItems_FullMethodName = "/newsaggregator.v1.NewsService/StreamNewItems"
+	NewsService_ListSources_FullMethodName    = "/newsaggregator.v1.NewsService/ListSources"
+)
+
+// NewsServiceClient is the client API for NewsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// NewsService reads the stored news and the state of the sources
+type NewsServiceClient interface {
+	// ListNews returns a page of the items matching the filter, like /news/
+	ListNews(ctx context.Context, in *ListNewsRequest, opts ...grpc.CallOption) (*NewsPage, error)
+	// GetNewsItem returns an item with its content, NOT_FOUND when there is
+	// no item with the id
+	GetNewsItem(ctx context.Context, in *GetNewsItemRequest, opts ...grpc.CallOption) (*NewsItem, error)
+	// StreamNewItems sends the items matching the filter as they are stored,
+	// like /news/stream. The items stored after filter.since are sent first.
+	StreamNewItems(ctx context.Context, in *StreamNewItemsRequest, opts ...grpc.CallOption) (NewsService_StreamNewItemsClient, error)
+	// ListSources returns the fetch state of every source, like /sources
+	ListSources(ctx context.Context, in *ListSourcesRequest, opts ...grpc.CallOption) (*ListSourcesResponse, error)
+}
+
+type newsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNewsServiceClient(cc grpc.ClientConnInterface) NewsServiceClient {
+	return &newsServiceClient{cc}
+}
+
+func (c *newsServiceClient) ListNews(ctx context.Context, in *ListNewsRequest, opts ...grpc.CallOption) (*NewsPage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NewsPage)
+	err := c.cc.Invoke(ctx, NewsService_ListNews_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *newsServiceClient) GetNewsItem(ctx context.Context, in *GetNewsItemRequest, opts ...grpc.CallOption) (*NewsItem, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NewsItem)
+	err := c.cc.Invoke(ctx, NewsService_GetNewsItem_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *newsServiceClient) StreamNewItems(ctx context.Context, in *StreamNewItemsRequest, opts ...grpc.CallOption) (NewsService_StreamNewItemsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &NewsService_ServiceDesc.Streams[0], NewsService_StreamNewItems_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &newsServiceStreamNewItemsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type NewsService_StreamNewItemsClient interface {
+	Recv() (*NewsItem, error)
+	grpc.ClientStream
+}
+
+type newsServiceStreamNewItemsClient struct {
+	grpc.ClientStream
+}
+
+func (x *newsServiceStreamNewItemsClient) Recv() (*NewsItem, error) {
+	m := new(NewsItem)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *newsServiceClient) ListSources(ctx context.Context, in *ListSourcesRequest, opts ...grpc.CallOption) (*ListSourcesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSourcesResponse)
+	err := c.cc.Invoke(ctx, NewsService_ListSources_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NewsServiceServer is the server API for NewsService service.
+// All implementations must embed UnimplementedNewsServiceServer
+// for forward compatibility
+//
+// NewsService reads the stored news and the state of the sources
+type NewsServiceServer interface {
+	// ListNews returns a page of the items matching the filter, like /news/
+	ListNews(context.Context, *ListNewsRequest) (*NewsPage, error)
+	// GetNewsItem returns an item with its content, NOT_FOUND when there is
+	// no item with the id
+	GetNewsItem(context.Context, *GetNewsItemRequest) (*NewsItem, error)
+	// StreamNewItems sends the items matching the filter as they are stored,
+	// like /news/stream. The items stored after filter.since are sent first.
+	StreamNewItems(*StreamNewItemsRequest, NewsService_StreamNewItemsServer) error
+	// ListSources returns the fetch state of every source, like /sources
+	ListSources(context.Context, *ListSourcesRequest) (*ListSourcesResponse, error)
+	mustEmbedUnimplementedNewsServiceServer()
+}
+
+// UnimplementedNewsServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedNewsServiceServer struct {
+}
+
+func (UnimplementedNewsServiceServer) ListNews(context.Context, *ListNewsRequest) (*NewsPage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNews not implemented")
+}
+func (UnimplementedNewsServiceServer) GetNewsItem(context.Context, *GetNewsItemRequest) (*NewsItem, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNewsItem not implemented")
+}
+func (UnimplementedNewsServiceServer) StreamNewItems(*StreamNewItemsRequest, NewsService_StreamNewItemsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamNewItems not implemented")
+}
+func (UnimplementedNewsServiceServer) ListSources(context.Context, *ListSourcesRequest) (*ListSourcesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSources not implemented")
+}
+func (UnimplementedNewsServiceServer) mustEmbedUnimplementedNewsServiceServer() {}
+
+// UnsafeNewsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NewsServiceServer will
+// result in compilation errors.
+type UnsafeNewsServiceServer interface {
+	mustEmbedUnimplementedNewsServiceServer()
+}
+
+func RegisterNewsServiceServer(s grpc.ServiceRegistrar, srv NewsServiceServer) {
+	s.RegisterService(&NewsService_ServiceDesc, srv)
+}
+
+func _NewsService_ListNews_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNewsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NewsServiceServer).ListNews(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NewsService_ListNews_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NewsServiceServer).ListNews(ctx, req.(*ListNewsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NewsService_GetNewsItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNewsItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NewsServiceServer).GetNewsItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NewsService_GetNewsItem_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NewsServiceServer).GetNewsItem(ctx, req.(*GetNewsItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NewsService_StreamNewItems_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamNewItemsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NewsServiceServer).StreamNewItems(m, &newsServiceStreamNewItemsServer{ServerStream: stream})
+}
+
+type NewsService_StreamNewItemsServer interface {
+	Send(*NewsItem) error
+	grpc.ServerStream
+}
+
+type newsServiceStreamNewItemsServer struct {
+	grpc.ServerStream
+}
+
+func (x *newsServiceStreamNewItemsServer) Send(m *NewsItem) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _NewsService_ListSources_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSourcesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NewsServiceServer).ListSources(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NewsService_ListSources_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NewsServiceServer).ListSources(ctx, req.(*ListSourcesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// NewsService_ServiceDesc is the grpc.ServiceDesc for NewsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var NewsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "newsaggregator.v1.NewsService",
+	HandlerType: (*NewsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListNews",
+			Handler:    _NewsService_ListNews_Handler,
+		},
+		{
+			MethodName: "GetNewsItem",
+			Handler:    _NewsService_GetNewsItem_Handler,
+		},
+		{
+			MethodName: "ListSources",
+			Handler:    _NewsService_ListSources_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamNewItems",
+			Handler:       _NewsService_StreamNewItems_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "newspb/news.proto",
+}
+
+const (
+	RulesService_ListRules_FullMethodName   = "/newsaggregator.v1.RulesService/ListRules"
+	RulesService_AddRule_FullMethodName     = "/newsaggregator.v1.RulesService/AddRule"
+	RulesService_ReplaceRule_FullMethodName = "/newsaggregator.v1.RulesService/ReplaceRule"
+	RulesService_DeleteRule_FullMethodName  = "/newsaggregator.v1.RulesService/DeleteRule"
+	RulesService_ReloadRules_FullMethodName = "/newsaggregator.v1.RulesService/ReloadRules"
+)
+
+// RulesServiceClient is the client API for RulesService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RulesService manages the parsing rules, like /api/rules. It is limited to
+// administrators.
+type RulesServiceClient interface {
+	ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*ListRulesResponse, error)
+	// AddRule adds a rule, ALREADY_EXISTS when a rule has its url
+	AddRule(ctx context.Context, in *AddRuleRequest, opts ...grpc.CallOption) (*RuleChanges, error)
+	// ReplaceRule replaces the rule with the url
+	ReplaceRule(ctx context.Context, in *ReplaceRuleRequest, opts ...grpc.CallOption) (*RuleChanges, error)
+	DeleteRule(ctx context.Context, in *DeleteRuleRequest, opts ...grpc.CallOption) (*RuleChanges, error)
+	// ReloadRules re-reads the rules file, like /reload
+	ReloadRules(ctx context.Context, in *ReloadRulesRequest, opts ...grpc.CallOption) (*RuleChanges, error)
+}
+
+type rulesServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRulesServiceClient(cc grpc.ClientConnInterface) RulesServiceClient {
+	return &rulesServiceClient{cc}
+}
+
+func (c *rulesServiceClient) ListRules(ctx context.Context, in *ListRulesRequest, opts ...grpc.CallOption) (*ListRulesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRulesResponse)
+	err := c.cc.Invoke(ctx, RulesService_ListRules_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rulesServiceClient) AddRule(ctx context.Context, in *AddRuleRequest, opts ...grpc.CallOption) (*RuleChanges, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RuleChanges)
+	err := c.cc.Invoke(ctx, RulesService_AddRule_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rulesServiceClient) ReplaceRule(ctx context.Context, in *ReplaceRuleRequest, opts ...grpc.CallOption) (*RuleChanges, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RuleChanges)
+	err := c.cc.Invoke(ctx, RulesService_ReplaceRule_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rulesServiceClient) DeleteRule(ctx context.Context, in *DeleteRuleRequest, opts ...grpc.CallOption) (*RuleChanges, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RuleChanges)
+	err := c.cc.Invoke(ctx, RulesService_DeleteRule_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rulesServiceClient) ReloadRules(ctx context.Context, in *ReloadRulesRequest, opts ...grpc.CallOption) (*RuleChanges, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RuleChanges)
+	err := c.cc.Invoke(ctx, RulesService_ReloadRules_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RulesServiceServer is the server API for RulesService service.
+// All implementations must embed UnimplementedRulesServiceServer
+// for forward compatibility
+//
+// RulesService manages the parsing rules, like /api/rules. It is limited to
+// administrators.
+type RulesServiceServer interface {
+	ListRules(context.Context, *ListRulesRequest) (*ListRulesResponse, error)
+	// AddRule adds a rule, ALREADY_EXISTS when a rule has its url
+	AddRule(context.Context, *AddRuleRequest) (*RuleChanges, error)
+	// ReplaceRule replaces the rule with the url
+	ReplaceRule(context.Context, *ReplaceRuleRequest) (*RuleChanges, error)
+	DeleteRule(context.Context, *DeleteRuleRequest) (*RuleChanges, error)
+	// ReloadRules re-reads the rules file, like /reload
+	ReloadRules(context.Context, *ReloadRulesRequest) (*RuleChanges, error)
+	mustEmbedUnimplementedRulesServiceServer()
+}
+
+// UnimplementedRulesServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedRulesServiceServer struct {
+}
+
+func (UnimplementedRulesServiceServer) ListRules(context.Context, *ListRulesRequest) (*ListRulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRules not implemented")
+}
+func (UnimplementedRulesServiceServer) AddRule(context.Context, *AddRuleRequest) (*RuleChanges, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddRule not implemented")
+}
+func (UnimplementedRulesServiceServer) ReplaceRule(context.Context, *ReplaceRuleRequest) (*RuleChanges, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplaceRule not implemented")
+}
+func (UnimplementedRulesServiceServer) DeleteRule(context.Context, *DeleteRuleRequest) (*RuleChanges, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRule not implemented")
+}
+func (UnimplementedRulesServiceServer) ReloadRules(context.Context, *ReloadRulesRequest) (*RuleChanges, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadRules not implemented")
+}
+func (UnimplementedRulesServiceServer) mustEmbedUnimplementedRulesServiceServer() {}
+
+// UnsafeRulesServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RulesServiceServer will
+// result in compilation errors.
+type UnsafeRulesServiceServer interface {
+	mustEmbedUnimplementedRulesServiceServer()
+}
+
+func RegisterRulesServiceServer(s grpc.ServiceRegistrar, srv RulesServiceServer) {
+	s.RegisterService(&RulesService_ServiceDesc, srv)
+}
+
+func _RulesService_ListRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RulesServiceServer).ListRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RulesService_ListRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RulesServiceServer).ListRules(ctx, req.(*ListRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RulesService_AddRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RulesServiceServer).AddRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RulesService_AddRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RulesServiceServer).AddRule(ctx, req.(*AddRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RulesService_ReplaceRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplaceRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RulesServiceServer).ReplaceRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RulesService_ReplaceRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RulesServiceServer).ReplaceRule(ctx, req.(*ReplaceRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RulesService_DeleteRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RulesServiceServer).DeleteRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RulesService_DeleteRule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RulesServiceServer).DeleteRule(ctx, req.(*DeleteRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RulesService_ReloadRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RulesServiceServer).ReloadRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RulesService_ReloadRules_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RulesServiceServer).ReloadRules(ctx, req.(*ReloadRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RulesService_ServiceDesc is the grpc.ServiceDesc for RulesService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RulesService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "newsaggregator.v1.RulesService",
+	HandlerType: (*RulesServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRules",
+			Handler:    _RulesService_ListRules_Handler,
+		},
+		{
+			MethodName: "AddRule",
+			Handler:    _RulesService_AddRule_Handler,
+		},
+		{
+			MethodName: "ReplaceRule",
+			Handler:    _RulesService_ReplaceRule_Handler,
+		},
+		{
+			MethodName: "DeleteRule",
+			Handler:    _RulesService_DeleteRule_Handler,
+		},
+		{
+			MethodName: "ReloadRules",
+			Handler:    _RulesService_ReloadRules_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "newspb/news.proto",
+}
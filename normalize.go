@@ -0,0 +1,66 @@
+package aggregator
+
+import (
+	"net/url"
+	"strings"
+)
+
+// defaultTrackingParams are the query parameters of -stripParams by default
+const defaultTrackingParams = "utm_*,fbclid,gclid,dclid,yclid,msclkid,mc_cid,mc_eid,_ga,_hsenc,_hsmi"
+
+// defaultPorts are dropped from the hosts of links
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// normalizeURL rewrites equivalent forms of a link to a single one so that
+// they are not stored as different items. The host is lowercased, default
+// ports, fragments and the -stripParams tracking parameters are removed.
+// Fragments starting with ! are kept as they are routes of some sites.
+func (app *NewsApp) normalizeURL(link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	u.Host = strings.ToLower(u.Host)
+	if app.config.ForceHTTPS && u.Scheme == "http" {
+		u.Scheme = "https"
+		if u.Port() == "80" {
+			u.Host = u.Hostname()
+		}
+	}
+	if port := u.Port(); port != "" && defaultPorts[u.Scheme] == port {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if app.config.StripWWW {
+		host := u.Hostname()
+		if strings.HasPrefix(host, "www.") {
+			if port := u.Port(); port != "" {
+				u.Host = host[len("www."):] + ":" + port
+			} else {
+				u.Host = host[len("www."):]
+			}
+		}
+	}
+	if !strings.HasPrefix(u.Fragment, "!") {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if len(app.config.StripParams) > 0 && u.RawQuery != "" {
+		u.RawQuery = removeQueryParams(u.RawQuery, app.config.StripParams)
+	}
+	return u.String(), nil
+}
+
+// removeQueryParams drops the matching parameters keeping the order and the
+// encoding of the others, so links without tracking parameters are unchanged
+func removeQueryParams(rawQuery string, names []string) string {
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(key); err == nil && matchesParam(name, names) {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,35 @@
+package aggregator
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		link       string
+		forceHTTPS bool
+		stripWWW   bool
+		want       string
+	}{
+		{"https://Example.com:443/news/1#top", false, false, "https://example.com/news/1"},
+		{"http://example.com/news/1", false, false, "http://example.com/news/1"},
+		{"http://example.com/news/1", true, false, "https://example.com/news/1"},
+		{"http://example.com:80/news/1", true, false, "https://example.com/news/1"},
+		{"http://example.com:8080/news/1", true, false, "https://example.com:8080/news/1"},
+		{"https://www.example.com/news/1", false, false, "https://www.example.com/news/1"},
+		{"https://www.example.com/news/1", false, true, "https://example.com/news/1"},
+		{"https://www.example.com:8443/news/1", false, true, "https://example.com:8443/news/1"},
+		{"http://WWW.example.com/news/1", true, true, "https://example.com/news/1"},
+		{"https://example.com/#!/news/1", true, true, "https://example.com/#!/news/1"},
+		{"https://example.com/news/1?utm_source=feed&id=2", false, false, "https://example.com/news/1?utm_source=feed&id=2"},
+	}
+	for _, test := range tests {
+		app := NewNewsApp(Config{ForceHTTPS: test.forceHTTPS, StripWWW: test.stripWWW})
+		got, err := app.normalizeURL(test.link)
+		if err != nil {
+			t.Errorf("normalizeURL(%q): %v", test.link, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("normalizeURL(%q) with forceHTTPS=%v stripWWW=%v = %q, want %q", test.link, test.forceHTTPS, test.stripWWW, got, test.want)
+		}
+	}
+}
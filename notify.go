@@ -0,0 +1,136 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	alertTimeout = 15 * time.Second
+	telegramAPI  = "https://api.telegram.org"
+	// telegramMaxLength is the maximal length of a Telegram message
+	telegramMaxLength = 4096
+)
+
+// sendAlert notifies the channel of the alert of the items
+func (app *NewsApp) sendAlert(ctx context.Context, alert *Alert, items []NewsItem) error {
+	ctx, cancel := context.WithTimeout(ctx, alertTimeout)
+	defer cancel()
+	switch alert.Channel {
+	case alertChannelWebhook:
+		return app.sendWebhook(ctx, alert, items)
+	case alertChannelEmail:
+		return app.sendEmail(alert, items)
+	case alertChannelTelegram:
+		return app.sendTelegram(ctx, alert, items)
+	}
+	return fmt.Errorf("unknown channel %q", alert.Channel)
+}
+
+// alertText lists the titles and the links of the items
+func alertText(items []NewsItem) string {
+	var text strings.Builder
+	for _, item := range items {
+		fmt.Fprintf(&text, "%s\n%s\n\n", item.Title, item.Link)
+	}
+	return strings.TrimSpace(text.String())
+}
+
+func alertSubject(alert *Alert, items []NewsItem) string {
+	if len(items) == 1 {
+		return fmt.Sprintf("%s: %s", alert.Name, items[0].Title)
+	}
+	return fmt.Sprintf("%s: %d new items", alert.Name, len(items))
+}
+
+// sendWebhook posts {"alert": ..., "items": [...]} as JSON to the target
+func (app *NewsApp) sendWebhook(ctx context.Context, alert *Alert, items []NewsItem) error {
+	body, err := json.Marshal(struct {
+		Alert *Alert     `json:"alert"`
+		Items []NewsItem `json:"items"`
+	}{alert, items})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, alert.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return app.postNotification(req)
+}
+
+func (app *NewsApp) sendTelegram(ctx context.Context, alert *Alert, items []NewsItem) error {
+	text := alertSubject(alert, items) + "\n\n" + alertText(items)
+	if len(text) > telegramMaxLength {
+		text = truncateText(text, telegramMaxLength)
+	}
+	return app.sendTelegramMessage(ctx, alert.Target, text)
+}
+
+// sendTelegramMessage sends the text to the chat with the bot of -telegramToken
+func (app *NewsApp) sendTelegramMessage(ctx context.Context, chat, text string) error {
+	form := url.Values{"chat_id": {chat}, "text": {text}, "disable_web_page_preview": {"true"}}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, app.config.TelegramToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := app.postNotification(req); err != nil {
+		// the URL contains the bot token
+		return app.redactTelegram(err)
+	}
+	return nil
+}
+
+// postNotification sends the request, responses other than 2xx are errors
+func (app *NewsApp) postNotification(req *http.Request) error {
+	resp, err := app.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return nil
+}
+
+func (app *NewsApp) sendEmail(alert *Alert, items []NewsItem) error {
+	host, _, err := net.SplitHostPort(app.config.SMTPAddr)
+	if err != nil {
+		return fmt.Errorf("invalid -smtpAddr: %v", err)
+	}
+	var auth smtp.Auth
+	if app.config.SMTPUser != "" {
+		auth = smtp.PlainAuth("", app.config.SMTPUser, app.config.SMTPPassword, host)
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", app.config.SMTPFrom, alert.Target,
+		mime.QEncoding.Encode("utf-8", alertSubject(alert, items)), time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(alertText(items), "\n", "\r\n"))
+	message.WriteString("\r\n")
+	return smtp.SendMail(app.config.SMTPAddr, auth, app.config.SMTPFrom, []string{alert.Target}, message.Bytes())
+}
+
+// truncateText cuts the text to at most max bytes without splitting a rune
+func truncateText(text string, max int) string {
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + ellipsis
+}
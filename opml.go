@@ -0,0 +1,196 @@
+package aggregator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultImportInterval is the update interval of imported rules without the
+// intervalMinutes parameter
+const defaultImportInterval = 60
+
+const formatOPML = "opml"
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title,omitempty"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline is a subscription when it has an xmlUrl, otherwise a folder of
+// subscriptions
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+func (outline *opmlOutline) title() string {
+	if outline.Title != "" {
+		return strings.TrimSpace(outline.Title)
+	}
+	return strings.TrimSpace(outline.Text)
+}
+
+// opmlRules returns an rss rule for every subscription of the outlines, the
+// category of a subscription is its own or else the title of its folder
+func opmlRules(outlines []opmlOutline, category string, interval uint) []*ParsingRule {
+	var rules []*ParsingRule
+	for i := range outlines {
+		outline := &outlines[i]
+		if outline.XMLURL == "" {
+			rules = append(rules, opmlRules(outline.Outlines, outline.title(), interval)...)
+			continue
+		}
+		rule := &ParsingRule{URL: strings.TrimSpace(outline.XMLURL), Type: ruleTypeRSS, Name: outline.title(),
+			Category: category, Interval: interval}
+		// the category attribute is a comma-separated list of paths like
+		// /News/World, the first is kept
+		if first, _, _ := strings.Cut(outline.Category, ","); strings.Trim(first, "/ ") != "" {
+			rule.Category = strings.Trim(first, "/ ")
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// opmlImport is the response of /api/rules/import, Skipped are the feeds
+// that already had a rule
+type opmlImport struct {
+	ruleChanges
+	Skipped []string `json:"skipped"`
+}
+
+// rulesImportHandler adds an rss rule for every feed of the OPML body, feeds
+// already having a rule are skipped. The rules are updated every
+// intervalMinutes, defaultImportInterval by default.
+func (app *NewsApp) rulesImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != formatOPML {
+		http.Error(w, fmt.Sprintf("unsupported format %q, expected opml", format), http.StatusBadRequest)
+		return
+	}
+	interval := uint(defaultImportInterval)
+	if value := r.URL.Query().Get("intervalMinutes"); value != "" {
+		minutes, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || minutes == 0 {
+			http.Error(w, "intervalMinutes must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		interval = uint(minutes)
+	}
+	var doc opmlDocument
+	if err := xml.NewDecoder(r.Body).Decode(&doc); err != nil {
+		http.Error(w, fmt.Sprintf("error while reading the OPML: %v", err), http.StatusBadRequest)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	rules := append([]*ParsingRule(nil), app.parsingRules...)
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		seen[rule.URL] = true
+	}
+	result := opmlImport{Skipped: make([]string, 0)}
+	for _, rule := range opmlRules(doc.Outlines, "", interval) {
+		if seen[rule.URL] {
+			result.Skipped = append(result.Skipped, rule.URL)
+			continue
+		}
+		seen[rule.URL] = true
+		rules = append(rules, rule)
+	}
+	if err := app.prepareChangedRules(rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := writeParsingRules(app.config.RulesFile, rules); err != nil {
+		http.Error(w, fmt.Sprintf("unable to save parsing rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	changes, err := app.replaceParsingRules(rules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	result.ruleChanges = changes
+	writeRulesJSON(w, http.StatusOK, result)
+}
+
+// rulesExportHandler lists the rules as OPML in folders of their categories.
+// The feed of an rss rule is its url, other rules link to the RSS feed of
+// their source served by the application.
+func (app *NewsApp) rulesExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != formatOPML {
+		http.Error(w, fmt.Sprintf("unsupported format %q, expected opml", format), http.StatusBadRequest)
+		return
+	}
+	app.mu.Lock()
+	rules := app.parsingRules
+	app.mu.Unlock()
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+	doc := opmlDocument{Version: "2.0"}
+	doc.Head.Title = "news-aggregator sources"
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	folders := make(map[string]*opmlOutline)
+	var categories []string
+	var outlines []opmlOutline
+	for _, rule := range rules {
+		outline := opmlOutline{Text: rule.Source(), Title: rule.Source(), Type: "rss", XMLURL: rule.URL}
+		if rule.Type != ruleTypeRSS {
+			outline.XMLURL = base + "/rss.xml?source=" + url.QueryEscape(rule.Source())
+			outline.HTMLURL = rule.URL
+		}
+		if rule.Category == "" {
+			outlines = append(outlines, outline)
+			continue
+		}
+		folder, ok := folders[rule.Category]
+		if !ok {
+			folder = &opmlOutline{Text: rule.Category, Title: rule.Category}
+			folders[rule.Category] = folder
+			categories = append(categories, rule.Category)
+		}
+		folder.Outlines = append(folder.Outlines, outline)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		doc.Outlines = append(doc.Outlines, *folders[category])
+	}
+	doc.Outlines = append(doc.Outlines, outlines...)
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="sources.opml"`)
+	fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+}
@@ -0,0 +1,165 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// pageMetadata are the fields an article page declares about itself in
+// OpenGraph tags and schema.org JSON-LD
+type pageMetadata struct {
+	title       string
+	description string
+	image       string
+	published   *time.Time
+}
+
+// jsonLDTypes are the schema.org types of articles, other objects of the
+// JSON-LD of a page such as its organization are ignored
+var jsonLDTypes = map[string]bool{
+	"Article": true, "NewsArticle": true, "ReportageNewsArticle": true, "AnalysisNewsArticle": true,
+	"BlogPosting": true, "TechArticle": true, "ScholarlyArticle": true, "WebPage": true,
+}
+
+// extractPageMetadata reads the OpenGraph tags of the page and, for the
+// fields they lack, its JSON-LD and then its title element
+func extractPageMetadata(doc *html.Node) pageMetadata {
+	meta := pageMetadata{
+		title:       metaContent(doc, "og:title"),
+		description: metaContent(doc, "og:description"),
+		image:       metaContent(doc, "og:image"),
+		published:   parseISOTime(metaContent(doc, "article:published_time")),
+	}
+	for _, script := range htmlquery.Find(doc, "//script[@type='application/ld+json']") {
+		var data interface{}
+		if err := json.Unmarshal([]byte(htmlquery.InnerText(script)), &data); err != nil {
+			continue
+		}
+		if article := findJSONLDArticle(data); article != nil {
+			if meta.title == "" {
+				meta.title = jsonLDString(article["headline"])
+			}
+			if meta.title == "" {
+				meta.title = jsonLDString(article["name"])
+			}
+			if meta.description == "" {
+				meta.description = jsonLDString(article["description"])
+			}
+			if meta.image == "" {
+				meta.image = jsonLDString(article["image"])
+			}
+			if meta.published == nil {
+				meta.published = parseISOTime(jsonLDString(article["datePublished"]))
+			}
+			break
+		}
+	}
+	if meta.title == "" {
+		meta.title = siteTitle(doc)
+	}
+	meta.title = collapseSpace(meta.title)
+	return meta
+}
+
+// metaContent returns the content of the meta tag with the property, sites
+// also use name for OpenGraph tags
+func metaContent(doc *html.Node, property string) string {
+	node := htmlquery.FindOne(doc, "//meta[@property='"+property+"' or @name='"+property+"']")
+	if node == nil {
+		return ""
+	}
+	return strings.TrimSpace(htmlquery.SelectAttr(node, "content"))
+}
+
+// findJSONLDArticle returns the first object of an article type in the
+// JSON-LD, which may be an array or hold its objects in @graph
+func findJSONLDArticle(data interface{}) map[string]interface{} {
+	switch value := data.(type) {
+	case []interface{}:
+		for _, element := range value {
+			if article := findJSONLDArticle(element); article != nil {
+				return article
+			}
+		}
+	case map[string]interface{}:
+		if isJSONLDArticle(value["@type"]) {
+			return value
+		}
+		if graph, ok := value["@graph"]; ok {
+			return findJSONLDArticle(graph)
+		}
+	}
+	return nil
+}
+
+// isJSONLDArticle tests @type, a name or a list of names
+func isJSONLDArticle(types interface{}) bool {
+	switch value := types.(type) {
+	case string:
+		return jsonLDTypes[value]
+	case []interface{}:
+		for _, element := range value {
+			if name, ok := element.(string); ok && jsonLDTypes[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonLDString returns a text value, the url of an object such as an
+// ImageObject or the first of a list
+func jsonLDString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case map[string]interface{}:
+		return jsonLDString(value["url"])
+	case []interface{}:
+		for _, element := range value {
+			if text := jsonLDString(element); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// parseISOTime parses the ISO 8601 times of OpenGraph and JSON-LD, with or
+// without the seconds and the zone, nil when the value is none of them
+func parseISOTime(value string) *time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// missingPageFields tells whether the item lacks a title, a summary or an
+// image, the publication date is taken only from pages fetched anyway
+func missingPageFields(item *NewsItem) bool {
+	return item.Title == "" || item.Summary == "" || item.Image == ""
+}
+
+// fillFromPage sets the empty fields of the item from the page metadata
+func fillFromPage(item *NewsItem, meta pageMetadata) {
+	if item.Title == "" {
+		item.Title = meta.title
+	}
+	if item.Summary == "" {
+		item.Summary = meta.description
+	}
+	if item.Image == "" && meta.image != "" {
+		if image, err := absoluteImageURL(item.Link, meta.image); err == nil {
+			item.Image = image
+		}
+	}
+	if item.Published == nil {
+		item.Published = meta.published
+	}
+}
@@ -0,0 +1,73 @@
+package aggregator
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultRequestDelay = 250 * time.Millisecond
+
+// hostLimiter spaces requests to the same host
+type hostLimiter struct {
+	mu    sync.Mutex
+	hosts map[string]*hostSchedule
+}
+
+type hostSchedule struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until a request to the host may be sent, the next request to
+// the host is allowed after the delay. The slot is reserved under the lock of
+// the host and waited for without it, so a canceled request does not hold up
+// the others. It returns the error of ctx when ctx is done first.
+func (l *hostLimiter) wait(ctx context.Context, host string, delay time.Duration) error {
+	l.mu.Lock()
+	if l.hosts == nil {
+		l.hosts = make(map[string]*hostSchedule)
+	}
+	schedule, ok := l.hosts[host]
+	if !ok {
+		schedule = &hostSchedule{}
+		l.hosts[host] = schedule
+	}
+	l.mu.Unlock()
+	schedule.mu.Lock()
+	start := time.Now()
+	if schedule.next.After(start) {
+		start = schedule.next
+	}
+	schedule.next = start.Add(delay)
+	schedule.mu.Unlock()
+	wait := time.Until(start)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestDelay returns the delay between requests of the rule to one host
+func (rule *ParsingRule) requestDelay() time.Duration {
+	if rule.RequestDelay == nil {
+		return defaultRequestDelay
+	}
+	return time.Duration(*rule.RequestDelay) * time.Millisecond
+}
+
+// requestDelay returns the delay of the rule but at least -minRequestDelay,
+// so rules can not poll a host faster than the operator allows
+func (app *NewsApp) requestDelay(rule *ParsingRule) time.Duration {
+	if delay := rule.requestDelay(); delay > app.config.MinRequestDelay {
+		return delay
+	}
+	return app.config.MinRequestDelay
+}
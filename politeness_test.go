@@ -0,0 +1,39 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterWait(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		host    string
+		minWait time.Duration
+		maxWait time.Duration
+		err     error
+	}{
+		{"first request", context.Background(), "example.com", 0, delay / 2, nil},
+		{"canceled while waiting", canceled, "example.com", 0, delay / 2, context.Canceled},
+		{"other host", context.Background(), "example.org", 0, delay / 2, nil},
+		// the slot of the canceled request stays taken
+		{"next slot", context.Background(), "example.com", delay * 3 / 2, delay * 3, nil},
+	}
+	var limiter hostLimiter
+	for _, test := range tests {
+		start := time.Now()
+		err := limiter.wait(test.ctx, test.host, delay)
+		waited := time.Since(start)
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if waited < test.minWait || waited > test.maxWait {
+			t.Errorf("%s: waited %v, want between %v and %v", test.name, waited, test.minWait, test.maxWait)
+		}
+	}
+}
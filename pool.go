@@ -0,0 +1,142 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultJobTimeout is the default of -jobTimeout
+const defaultJobTimeout = 10 * time.Minute
+
+// fetchJob is one update of a rule, done is called when it finished or was
+// dropped on shutdown. stats receives the counters of the update when set.
+type fetchJob struct {
+	ctx   context.Context
+	rule  *ParsingRule
+	done  func()
+	stats *ingestStats
+}
+
+// fetchPool queues the updates for a fixed number of workers, so at most
+// MaxConcurrentFetches sources are fetched at once however many are due
+type fetchPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []fetchJob
+	running int
+	closed  bool
+}
+
+func newFetchPool() *fetchPool {
+	pool := new(fetchPool)
+	pool.cond = sync.NewCond(&pool.mu)
+	return pool
+}
+
+// submit queues the job, false when the pool is closed
+func (p *fetchPool) submit(job fetchJob) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.pending = append(p.pending, job)
+	p.cond.Signal()
+	return true
+}
+
+// next waits for a job, false once the pool is closed
+func (p *fetchPool) next() (fetchJob, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.pending) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return fetchJob{}, false
+	}
+	job := p.pending[0]
+	p.pending = p.pending[1:]
+	p.running++
+	return job, true
+}
+
+func (p *fetchPool) finished() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+}
+
+// close stops the workers and returns the jobs that did not start
+func (p *fetchPool) close() []fetchJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	dropped := p.pending
+	p.pending = nil
+	p.cond.Broadcast()
+	return dropped
+}
+
+func (p *fetchPool) counts() (queued, running int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending), p.running
+}
+
+// startWorkers runs MaxConcurrentFetches workers until ctx is canceled, the
+// updates in progress are finished then
+func (app *NewsApp) startWorkers(ctx context.Context) {
+	for i := 0; i < app.config.MaxConcurrentFetches; i++ {
+		app.background.Add(1)
+		go func() {
+			defer app.background.Done()
+			for {
+				job, ok := app.pool.next()
+				if !ok {
+					return
+				}
+				app.runJob(job)
+				app.pool.finished()
+			}
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		for _, job := range app.pool.close() {
+			job.done()
+		}
+	}()
+}
+
+// runJob updates the rule of the job within -jobTimeout, a job of a rule
+// removed while it was queued is skipped
+func (app *NewsApp) runJob(job fetchJob) {
+	defer job.done()
+	if job.ctx.Err() != nil {
+		return
+	}
+	ctx := job.ctx
+	if app.config.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, app.config.JobTimeout)
+		defer cancel()
+	}
+	stats := job.stats
+	if stats == nil {
+		stats = new(ingestStats)
+	}
+	app.tryUpdateNews(ctx, job.rule, stats)
+}
+
+// writeMetrics writes the number of queued and running updates
+func (p *fetchPool) writeMetrics(buf *bytes.Buffer) {
+	queued, running := p.counts()
+	buf.WriteString("# HELP news_fetch_jobs_queued Updates waiting for a worker.\n# TYPE news_fetch_jobs_queued gauge\n")
+	fmt.Fprintf(buf, "news_fetch_jobs_queued %d\n", queued)
+	buf.WriteString("# HELP news_fetch_jobs_running Updates in progress.\n# TYPE news_fetch_jobs_running gauge\n")
+	fmt.Fprintf(buf, "news_fetch_jobs_running %d\n", running)
+}
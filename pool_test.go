@@ -0,0 +1,72 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchPoolConcurrency(t *testing.T) {
+	var running, highest atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			peak := highest.Load()
+			if current <= peak || highest.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, testPage)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		workers int
+		jobs    int
+	}{
+		{1, 4},
+		{2, 8},
+		{4, 8},
+	}
+	noDelay := uint(0)
+	for _, test := range tests {
+		highest.Store(0)
+		app := newTestApp(t)
+		app.config.MaxConcurrentFetches = test.workers
+		ctx, cancel := context.WithCancel(context.Background())
+		app.startWorkers(ctx)
+		var done sync.WaitGroup
+		for i := 0; i < test.jobs; i++ {
+			rule := &ParsingRule{
+				URL:                fmt.Sprintf("%s/%d/", server.URL, i),
+				Interval:           30,
+				RequestDelay:       &noDelay,
+				NewsNodesXPathExpr: `//div[@class="news"]`,
+				LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+				TitleRule:          ExtractRule{XPathExpr: "a"},
+			}
+			if err := PrepareParsingRules([]*ParsingRule{rule}); err != nil {
+				t.Fatal(err)
+			}
+			done.Add(1)
+			app.pool.submit(fetchJob{ctx: ctx, rule: rule, done: done.Done})
+		}
+		done.Wait()
+		cancel()
+		app.background.Wait()
+		if peak := int(highest.Load()); peak > test.workers || peak == 0 {
+			t.Errorf("%d workers: got %d concurrent fetches", test.workers, peak)
+		}
+	}
+}
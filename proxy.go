@@ -0,0 +1,108 @@
+package aggregator
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// proxyDirect as the proxy of a rule sends its requests without the proxy of
+// -proxy or of the environment
+const proxyDirect = "direct"
+
+// parseProxy checks the URL of an HTTP, HTTPS or SOCKS5 proxy, which may hold
+// the credentials of the proxy
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q, expected an http, https or socks5 url", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q, the host is missing", u.Redacted())
+	}
+	return u, nil
+}
+
+// proxy returns the proxy of the rule, of -proxy when the rule has none, or
+// proxyDirect. Empty means the proxy of the environment.
+func (app *NewsApp) proxy(rule *ParsingRule) string {
+	if rule.Proxy != "" {
+		return rule.Proxy
+	}
+	return app.config.Proxy
+}
+
+// proxyTransports keeps a transport for every proxy, so the rules of a proxy
+// share its connections while other rules use other proxies at the same time
+type proxyTransports struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func (t *proxyTransports) get(proxy string) (*http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if transport, ok := t.transports[proxy]; ok {
+		return transport, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy == proxyDirect {
+		transport.Proxy = nil
+	} else {
+		u, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if t.transports == nil {
+		t.transports = make(map[string]*http.Transport)
+	}
+	t.transports[proxy] = transport
+	return transport, nil
+}
+
+// ruleClient returns the client sending the requests of the rule, a copy of
+// the shared client with the timeout and the proxy of the rule
+func (app *NewsApp) ruleClient(rule *ParsingRule) (*http.Client, error) {
+	client := *app.client
+	client.Timeout = app.fetchTimeout(rule)
+	if proxy := app.proxy(rule); proxy != "" {
+		transport, err := app.proxies.get(proxy)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+	return &client, nil
+}
+
+// renderProxy returns the --proxy-server argument of Chromium for the proxy of
+// the rule, Chromium takes no credentials on the command line
+func (app *NewsApp) renderProxy(rule *ParsingRule) (string, error) {
+	proxy := app.proxy(rule)
+	if proxy == "" {
+		return "", nil
+	}
+	if proxy == proxyDirect {
+		return "--no-proxy-server", nil
+	}
+	u, err := parseProxy(proxy)
+	if err != nil {
+		return "", err
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("render does not support the credentials of proxy %s", u.Redacted())
+	}
+	scheme := u.Scheme
+	if scheme == "socks5h" {
+		scheme = "socks5"
+	}
+	return "--proxy-server=" + scheme + "://" + u.Host, nil
+}
@@ -86,7 +86,7 @@ var AppComponent = /** @class */ (function () {
         this.querySubject.next(query.trim());
     };
     AppComponent.prototype.getNewsList = function (query) {
-        return (query.length > 0) ? this.http.get(this.newsURL + "?q=" + query) : Object(rxjs__WEBPACK_IMPORTED_MODULE_2__["of"])(null);
+        return (query.length > 0) ? this.http.get(this.newsURL + "?q=" + query).pipe(Object(rxjs_operators__WEBPACK_IMPORTED_MODULE_3__["map"])(function (page) { return page.items; })) : Object(rxjs__WEBPACK_IMPORTED_MODULE_2__["of"])(null);
     };
     AppComponent = __decorate([
         Object(_angular_core__WEBPACK_IMPORTED_MODULE_0__["Component"])({
@@ -0,0 +1,56 @@
+package aggregator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window of local time such as 22:00-07:00 in which
+// alerts are not delivered, the zero value is no window. Set parses a window,
+// so it is the value of the -quietHours flag.
+type QuietHours struct {
+	start, end int
+	set        bool
+}
+
+func (q *QuietHours) String() string {
+	if q == nil || !q.set {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", q.start/60, q.start%60, q.end/60, q.end%60)
+}
+
+func (q *QuietHours) Set(value string) error {
+	if value == "" {
+		*q = QuietHours{}
+		return nil
+	}
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return fmt.Errorf("expected a window such as 22:00-07:00")
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return fmt.Errorf("invalid start of quiet hours: %v", err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return fmt.Errorf("invalid end of quiet hours: %v", err)
+	}
+	*q = QuietHours{start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), true}
+	return nil
+}
+
+// active tells whether the time is in the window, a window ending before it
+// starts spans midnight
+func (q QuietHours) active(t time.Time) bool {
+	if !q.set || q.start == q.end {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if q.start < q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
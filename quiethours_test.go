@@ -0,0 +1,46 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	tests := []struct {
+		window string
+		valid  bool
+		quiet  []string
+		loud   []string
+	}{
+		{"22:00-07:00", true, []string{"22:00", "23:59", "00:00", "06:59"}, []string{"07:00", "12:00", "21:59"}},
+		{"13:00-14:30", true, []string{"13:00", "14:29"}, []string{"12:59", "14:30"}},
+		{"", true, nil, []string{"00:00", "12:00"}},
+		{"08:00-08:00", true, nil, []string{"08:00", "20:00"}},
+		{"22:00", false, nil, nil},
+		{"25:00-07:00", false, nil, nil},
+	}
+	for _, test := range tests {
+		var q QuietHours
+		if err := q.Set(test.window); (err == nil) != test.valid {
+			t.Errorf("Set(%q) = %v", test.window, err)
+			continue
+		}
+		if test.valid && q.String() != test.window {
+			t.Errorf("Set(%q) gives %q", test.window, q.String())
+		}
+		for _, clock := range test.quiet {
+			if !q.active(at(clock)) {
+				t.Errorf("%s is outside the quiet hours %s", clock, test.window)
+			}
+		}
+		for _, clock := range test.loud {
+			if q.active(at(clock)) {
+				t.Errorf("%s is in the quiet hours %s", clock, test.window)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package aggregator
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var errUpdateRunning = errors.New("an update of the source is already running")
+
+// refreshResult is the response of /api/sources/{id}/refresh
+type refreshResult struct {
+	ID              string  `json:"id"`
+	URL             string  `json:"url"`
+	Matched         int     `json:"matched"`
+	New             int     `json:"new"`
+	Updated         int     `json:"updated"`
+	Duplicates      int     `json:"duplicates"`
+	SkippedEmpty    int     `json:"skippedEmpty"`
+	SkippedFiltered int     `json:"skippedFiltered"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// refreshRule queues an update of the scheduled rule with the URL out of its
+// schedule and returns a channel closed when it finished. The update waits for
+// a worker like the scheduled ones and requests the page unconditionally.
+func (app *NewsApp) refreshRule(url string, stats *ingestStats) (<-chan struct{}, error) {
+	s := &app.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.rules[url]
+	if !ok {
+		return nil, errors.New("the source is not scheduled")
+	}
+	if entry.running {
+		return nil, errUpdateRunning
+	}
+	finished := make(chan struct{})
+	entry.running = app.pool.submit(fetchJob{ctx: withoutValidators(entry.ctx), rule: entry.rule, stats: stats, done: func() {
+		app.scheduler.mu.Lock()
+		entry.running = false
+		app.scheduler.mu.Unlock()
+		close(finished)
+	}})
+	if !entry.running {
+		return nil, errors.New("the application is shutting down")
+	}
+	return finished, nil
+}
+
+// sourceRefreshHandler serves POST /api/sources/{id}/refresh, it updates the
+// source at once and returns the counters of the update. The next scheduled
+// update stays due at its time.
+func (app *NewsApp) sourceRefreshHandler(w http.ResponseWriter, r *http.Request, rule *ParsingRule) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !rule.enabled() {
+		http.Error(w, "the source is disabled", http.StatusConflict)
+		return
+	}
+	var stats ingestStats
+	start := time.Now()
+	finished, err := app.refreshRule(rule.URL, &stats)
+	if err == errUpdateRunning {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case <-finished:
+	case <-r.Context().Done():
+		// the update goes on without the client
+		return
+	}
+	result := refreshResult{ID: rule.ID(), URL: rule.URL, Matched: stats.matched, New: stats.inserted,
+		Updated: stats.updated, Duplicates: stats.duplicates, SkippedEmpty: stats.skippedEmpty,
+		SkippedFiltered: stats.skippedFiltered, DurationSeconds: time.Since(start).Seconds()}
+	if stats.errors > 0 {
+		result.Error = app.statuses.report(rule.URL, 0).LastError
+	}
+	writeRulesJSON(w, http.StatusOK, result)
+}
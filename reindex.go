@@ -0,0 +1,164 @@
+package aggregator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ftsBatchSize is the number of items indexed in one transaction
+const ftsBatchSize = 500
+
+// reindexNews rebuilds the full-text index in batches of items, every batch in
+// its own transaction, so neither searches nor updates wait for the whole
+// rebuild. progress is called with the number of items indexed so far.
+func (app *NewsApp) reindexNews(ctx context.Context, progress func(indexed int)) (int, error) {
+	var lower int64
+	indexed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return indexed, err
+		}
+		upper, count, err := app.reindexBatch(ctx, lower)
+		if err != nil {
+			return indexed, err
+		}
+		if count == 0 {
+			return indexed, nil
+		}
+		indexed += count
+		lower = upper
+		if progress != nil {
+			progress(indexed)
+		}
+	}
+}
+
+// reindexBatch replaces the index entries of the next batch of items after the
+// lower id. The entries after the last item are removed with the last batch.
+func (app *NewsApp) reindexBatch(ctx context.Context, lower int64) (int64, int, error) {
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	var upper sql.NullInt64
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT MAX(id), COUNT(*) FROM (SELECT id FROM news WHERE id > ? ORDER BY id LIMIT ?)",
+		lower, ftsBatchSize).Scan(&upper, &count)
+	if err != nil {
+		return 0, 0, err
+	}
+	if count == 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM news_fts WHERE rowid > ?", lower); err != nil {
+			return 0, 0, err
+		}
+		return lower, 0, tx.Commit()
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM news_fts WHERE rowid > ? AND rowid <= ?", lower, upper.Int64); err != nil {
+		return 0, 0, err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO news_fts(rowid, title, summary) SELECT id, title, decompress(summary) FROM news WHERE id > ? AND id <= ?",
+		lower, upper.Int64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return upper.Int64, count, tx.Commit()
+}
+
+// ReindexStatus is the progress of the last rebuild of the full-text index
+type ReindexStatus struct {
+	Running  bool       `json:"running"`
+	Indexed  int        `json:"indexed"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+type reindexState struct {
+	mu     sync.Mutex
+	status ReindexStatus
+}
+
+func (s *reindexState) get() ReindexStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// start marks a rebuild as running, it returns false when one already is
+func (s *reindexState) start() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.Running {
+		return false
+	}
+	now := time.Now()
+	s.status = ReindexStatus{Running: true, Started: &now}
+	return true
+}
+
+func (s *reindexState) progress(indexed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Indexed = indexed
+}
+
+func (s *reindexState) finish(indexed int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.status.Running = false
+	s.status.Indexed = indexed
+	s.status.Finished = &now
+	if err != nil {
+		s.status.Error = err.Error()
+	}
+}
+
+// reindexHandler starts a rebuild of the full-text index on POST and reports
+// the progress of the last one on GET
+func (app *NewsApp) reindexHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !app.fts {
+			http.Error(w, "full-text search is not available", http.StatusConflict)
+			return
+		}
+		if !app.reindex.start() {
+			http.Error(w, "the index is already being rebuilt", http.StatusConflict)
+			return
+		}
+		app.background.Add(1)
+		go func() {
+			defer app.background.Done()
+			count, err := app.reindexNews(app.ctx, app.reindex.progress)
+			app.reindex.finish(count, err)
+			if err != nil {
+				slog.Error("unable to rebuild the full-text index", "err", err)
+				return
+			}
+			slog.Info("rebuilt the full-text index", "items", count)
+		}()
+		status = http.StatusAccepted
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := json.MarshalIndent(app.reindex.get(), "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s\n", data)
+}
@@ -0,0 +1,51 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReindexHandler(t *testing.T) {
+	app := newTestApp(t)
+	storeTestNews(t, app, &ParsingRule{URL: "https://example.com/"}, ftsBatchSize+10)
+	// without FTS5 there is no index to rebuild
+	want := http.StatusConflict
+	if app.fts {
+		want = http.StatusAccepted
+	}
+	tests := []struct {
+		method string
+		status int
+	}{
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodPost, want},
+		{http.MethodGet, http.StatusOK},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		app.reindexHandler(w, httptest.NewRequest(test.method, "/admin/reindex", nil))
+		if w.Code != test.status {
+			t.Fatalf("%s: got status %d, want %d: %s", test.method, w.Code, test.status, w.Body)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		var status ReindexStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !app.fts {
+		return
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for app.reindex.get().Running && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := app.reindex.get(); status.Running || status.Indexed != ftsBatchSize+10 || status.Error != "" {
+		t.Errorf("got status %+v", status)
+	}
+}
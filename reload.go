@@ -0,0 +1,149 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ruleChanges are the URLs of the rules changed by a reload
+type ruleChanges struct {
+	Rules   int      `json:"rules"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// reloadParsingRules re-reads the parsing rules file and restarts the updaters
+// of added and changed rules, the others keep their schedule. The HTTP
+// listener and the database connection are kept. When the new rules can not
+// be read the old ones stay in effect.
+func (app *NewsApp) reloadParsingRules() (ruleChanges, error) {
+	rules, err := loadParsingRules(app.config.RulesFile)
+	if err != nil {
+		return ruleChanges{}, err
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	return app.replaceParsingRules(rules)
+}
+
+// replaceParsingRules switches to the prepared rules restarting the updaters
+// of the added and changed ones, app.mu must be held
+func (app *NewsApp) replaceParsingRules(rules []*ParsingRule) (ruleChanges, error) {
+	if app.ctx.Err() != nil {
+		return ruleChanges{}, errors.New("the application is shutting down")
+	}
+	added, removed, changed := diffParsingRules(app.parsingRules, rules)
+	restart := make(map[string]bool)
+	for _, url := range append(append(removed, changed...), added...) {
+		app.stopUpdater(url)
+		restart[url] = true
+	}
+	app.parsingRules = rules
+	for _, rule := range rules {
+		if restart[rule.URL] {
+			app.startUpdater(rule)
+		}
+	}
+	slog.Info("parsing rules reloaded", "rules", len(rules), "added", added, "removed", removed, "changed", changed)
+	return ruleChanges{len(rules), added, removed, changed}, nil
+}
+
+func (app *NewsApp) reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		slog.Info("SIGHUP received, reloading parsing rules")
+		if _, err := app.reloadParsingRules(); err != nil {
+			slog.Error("unable to reload parsing rules, keeping the old ones", "err", err)
+		}
+	}
+}
+
+// watchParsingRules reloads the rules whenever the modification time or the
+// size of the rules file changes
+func (app *NewsApp) watchParsingRules(ctx context.Context, interval time.Duration) {
+	last, err := os.Stat(app.config.RulesFile)
+	if err != nil {
+		slog.Warn("unable to watch parsing rules", "err", err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		info, err := os.Stat(app.config.RulesFile)
+		if err != nil {
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+		slog.Info("parsing rules file changed, reloading")
+		if _, err := app.reloadParsingRules(); err != nil {
+			slog.Error("unable to reload parsing rules, keeping the old ones", "err", err)
+		}
+	}
+}
+
+// reloadHandler reloads the parsing rules and reports what changed
+func (app *NewsApp) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	changes, err := app.reloadParsingRules()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to reload parsing rules, keeping the old ones: %v", err), http.StatusBadRequest)
+		return
+	}
+	data, err := json.MarshalIndent(changes, "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	fmt.Fprintf(w, "%s\n", data)
+}
+
+// diffParsingRules compares two rule sets by URL and returns URLs of the
+// rules that were added, removed or changed.
+func diffParsingRules(oldRules, newRules []*ParsingRule) (added, removed, changed []string) {
+	oldByURL := make(map[string]*ParsingRule)
+	for _, rule := range oldRules {
+		oldByURL[rule.URL] = rule
+	}
+	newByURL := make(map[string]*ParsingRule)
+	for _, rule := range newRules {
+		newByURL[rule.URL] = rule
+		oldRule, ok := oldByURL[rule.URL]
+		if !ok {
+			added = append(added, rule.URL)
+			continue
+		}
+		oldData, _ := json.Marshal(oldRule)
+		newData, _ := json.Marshal(rule)
+		if string(oldData) != string(newData) {
+			changed = append(changed, rule.URL)
+		}
+	}
+	for _, rule := range oldRules {
+		if _, ok := newByURL[rule.URL]; !ok {
+			removed = append(removed, rule.URL)
+		}
+	}
+	return added, removed, changed
+}
@@ -0,0 +1,104 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// renderChromium renders the page of a rule in headless Chromium before the
+// XPath expressions are applied
+const renderChromium = "chromium"
+
+const (
+	defaultRenderTimeout = 30 * time.Second
+	// renderBudget is the time given to the scripts of the page
+	renderBudget = 5 * time.Second
+)
+
+// chromiumNames are looked up in PATH when -chromiumPath is not set
+var chromiumNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"}
+
+// chromiumPath returns the browser binary of -chromiumPath or the first one
+// found in PATH
+func (app *NewsApp) chromiumPath() (string, error) {
+	if app.config.ChromiumPath != "" {
+		return app.config.ChromiumPath, nil
+	}
+	for _, name := range chromiumNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no Chromium found in PATH, set -chromiumPath")
+}
+
+// renderPage loads the page of the rule in headless Chromium and parses the
+// DOM once its scripts ran. At most -renderConcurrency browsers run at once
+// and each is killed after -renderTimeout.
+func (app *NewsApp) renderPage(ctx context.Context, rule *ParsingRule) (*html.Node, error) {
+	path, err := app.chromiumPath()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case app.renders <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-app.renders }()
+	if u, err := url.Parse(rule.URL); err == nil {
+		crawlDelay, err := app.checkRobots(ctx, u, rule)
+		if err != nil {
+			return nil, err
+		}
+		if err := app.hosts.wait(ctx, u.Host, max(app.requestDelay(rule), crawlDelay)); err != nil {
+			return nil, err
+		}
+	}
+	proxy, err := app.renderProxy(rule)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, app.config.RenderTimeout)
+	defer cancel()
+	args := []string{"--headless=new", "--disable-gpu", "--no-first-run", "--mute-audio", "--hide-scrollbars",
+		"--user-agent=" + rule.userAgent(),
+		fmt.Sprintf("--virtual-time-budget=%d", renderBudget.Milliseconds()),
+		"--dump-dom", rule.URL}
+	if proxy != "" {
+		args = append([]string{proxy}, args...)
+	}
+	// Chromium refuses to run as root with its sandbox, e.g. in containers
+	if os.Geteuid() == 0 {
+		args = append([]string{"--no-sandbox"}, args...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("rendering %s: %v", rule.URL, ctx.Err())
+		}
+		return nil, fmt.Errorf("rendering %s: %v: %s", rule.URL, err, lastLine(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("rendering %s: empty document", rule.URL)
+	}
+	return htmlquery.Parse(&stdout)
+}
+
+// lastLine returns the last non-empty line of the output of a command
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
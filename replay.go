@@ -0,0 +1,104 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Replay runs the extraction of the current rule with the name on the page of
+// a stored snapshot and writes the items to w. The network is not used and
+// nothing is stored, so links are not verified and detail pages are not
+// fetched.
+func (app *NewsApp) Replay(w io.Writer, snapshotID int64, ruleName string) error {
+	rules, err := loadParsingRules(app.config.RulesFile)
+	if err != nil {
+		return err
+	}
+	var rule *ParsingRule
+	for _, r := range rules {
+		if r.Source() != ruleName {
+			continue
+		}
+		if rule != nil {
+			return fmt.Errorf("several rules are named %s in %s", ruleName, app.config.RulesFile)
+		}
+		rule = r
+	}
+	if rule == nil {
+		return fmt.Errorf("no rule named %s in %s", ruleName, app.config.RulesFile)
+	}
+	if err := app.compileBlocklist(); err != nil {
+		return err
+	}
+	if app.db == nil {
+		if err := app.openDatabase(); err != nil {
+			return err
+		}
+		defer app.db.Close()
+	}
+	page, err := app.loadSnapshot(context.Background(), snapshotID)
+	if err != nil {
+		return err
+	}
+	var stats ingestStats
+	items, err := app.extractDocument(rule, page, &stats)
+	if err != nil {
+		return err
+	}
+	// only the extracted fields, the others are set when items are stored
+	type replayedItem struct {
+		Link      string            `json:"link"`
+		Title     string            `json:"title"`
+		Summary   string            `json:"summary,omitempty"`
+		Image     string            `json:"image,omitempty"`
+		Metadata  map[string]string `json:"metadata,omitempty"`
+		Published *time.Time        `json:"published,omitempty"`
+	}
+	replayed := make([]replayedItem, len(items))
+	for i, item := range items {
+		replayed[i] = replayedItem{item.Link, item.Title, item.Summary, item.Image, item.Metadata, item.Published}
+	}
+	data, err := json.MarshalIndent(replayed, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s\n", data)
+	fmt.Fprintf(os.Stderr, "matched=%d extracted=%d skipped_empty=%d skipped_filtered=%d\n",
+		stats.matched, len(items), stats.skippedEmpty, stats.skippedFiltered)
+	return nil
+}
+
+// extractDocument parses a document of the type of the rule and extracts its
+// items
+func (app *NewsApp) extractDocument(rule *ParsingRule, r io.Reader, stats *ingestStats) ([]NewsItem, error) {
+	switch rule.Type {
+	case ruleTypeRSS:
+		_, entries, err := parseFeed(r)
+		if err != nil {
+			return nil, err
+		}
+		return app.extractFeedNews(rule, entries, stats)
+	case ruleTypeJSON:
+		doc, err := parseJSONDocument(r)
+		if err != nil {
+			return nil, err
+		}
+		return app.extractJSONNews(rule, doc, stats)
+	case ruleTypeSitemap:
+		doc, err := parseSitemap(r)
+		if err != nil {
+			return nil, err
+		}
+		return app.extractSitemapNews(rule, doc, stats)
+	}
+	// saved pages have no Content-Type, only their meta tags tell the charset
+	doc, err := parseHTML(r, "")
+	if err != nil {
+		return nil, err
+	}
+	return app.extractNews(rule, doc, stats)
+}
@@ -0,0 +1,75 @@
+package aggregator
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/htmlquery"
+)
+
+const replayRules = `[{"url": "https://example.com/", "name": "Example", "intervalMinutes": 30,
+	"newsNodesExpr": "//div[@class=\"news\"]", "linkRule": {"expr": "a", "attr": "href"}, "titleRule": {"expr": "a"}}]`
+
+func TestReplaySnapshot(t *testing.T) {
+	app := newTestApp(t)
+	app.config.RulesFile = filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(app.config.RulesFile, []byte(replayRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rule := &ParsingRule{URL: "https://example.com/"}
+	saveTestSnapshot := func(page string) int64 {
+		t.Helper()
+		doc, err := htmlquery.Parse(strings.NewReader(page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.saveSnapshot(rule, doc, snapshotNoItems)
+		var id int64
+		if err := app.db.QueryRow("SELECT id FROM snapshots WHERE source_url = ?", rule.URL).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	replaced := saveTestSnapshot("<html><body><p>redesigned</p></body></html>")
+	id := saveTestSnapshot(testPage)
+	if id == replaced {
+		t.Fatalf("a new snapshot of the source kept the id %d", id)
+	}
+
+	tests := []struct {
+		id    int64
+		name  string
+		links []string
+		valid bool
+	}{
+		{id, "Example", []string{"https://example.com/first", "https://example.com/second"}, true},
+		{replaced, "Example", nil, false},
+		{id, "example.com", nil, false},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := app.Replay(&out, test.id, test.name)
+		if (err == nil) != test.valid {
+			t.Errorf("snapshot %d with %s: got error %v", test.id, test.name, err)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		var items []NewsItem
+		if err := json.Unmarshal(out.Bytes(), &items); err != nil {
+			t.Fatal(err)
+		}
+		var links []string
+		for _, item := range items {
+			links = append(links, item.Link)
+		}
+		if strings.Join(links, " ") != strings.Join(test.links, " ") {
+			t.Errorf("snapshot %d with %s: got links %q, want %q", test.id, test.name, links, test.links)
+		}
+	}
+}
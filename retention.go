@@ -0,0 +1,142 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	retentionInterval  = time.Hour
+	retentionBatchSize = 500
+)
+
+// retentionPolicy limits the age and the number of items of one source, or of
+// all items when source is empty. Zero values keep items and starred items are
+// never deleted. A deleted item that is still listed by its source is stored
+// again, -compactRetention keeps the links of old items instead.
+type retentionPolicy struct {
+	source   string
+	days     uint
+	maxItems uint
+}
+
+// PruneStats counts the items deleted by the retention policies
+type PruneStats struct {
+	Total   int64      `json:"total"`
+	LastRun *time.Time `json:"lastRun,omitempty"`
+}
+
+type pruneCounter struct {
+	mu    sync.Mutex
+	stats PruneStats
+}
+
+func (c *pruneCounter) add(count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.stats.Total += count
+	c.stats.LastRun = &now
+}
+
+func (c *pruneCounter) get() PruneStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// retentionPolicies returns the global policy followed by those of the rules,
+// rules sharing a source share the stricter limits
+func (app *NewsApp) retentionPolicies() []retentionPolicy {
+	policies := []retentionPolicy{{days: app.config.RetentionDays, maxItems: app.config.MaxItems}}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	for _, rule := range app.parsingRules {
+		if rule.RetentionDays > 0 || rule.MaxItems > 0 {
+			policies = append(policies, retentionPolicy{rule.Source(), rule.RetentionDays, rule.MaxItems})
+		}
+	}
+	return policies
+}
+
+func (app *NewsApp) pruneNewsPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		var total int64
+		for _, policy := range app.retentionPolicies() {
+			count, err := app.pruneNews(policy)
+			total += count
+			if err != nil {
+				slog.Error("unable to prune news", "source", policy.source, "err", err)
+			} else if count > 0 {
+				slog.Info("pruned news", "items", count, "source", policy.source,
+					"retention_days", policy.days, "max_items", policy.maxItems)
+			}
+		}
+		app.pruned.add(total)
+		if count, err := app.pruneSnapshots(); err != nil {
+			slog.Error("unable to prune snapshots", "err", err)
+		} else if count > 0 {
+			slog.Info("pruned snapshots", "snapshots", count)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pruneNews deletes the items first seen more than the days of the policy ago
+// and the oldest items beyond its maximal number
+func (app *NewsApp) pruneNews(policy retentionPolicy) (int64, error) {
+	// starred items are kept
+	scope, args := "NOT "+starredByAnyone, []interface{}{}
+	if policy.source != "" {
+		scope, args = scope+" AND source = ?", []interface{}{policy.source}
+	}
+	var total int64
+	if policy.days > 0 {
+		count, err := app.pruneBatches(`DELETE FROM news WHERE id IN
+			(SELECT id FROM news WHERE `+scope+` AND timestamp < datetime('now', ?) LIMIT ?)`,
+			append(args, fmt.Sprintf("-%d days", policy.days), retentionBatchSize)...)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	if policy.maxItems > 0 {
+		count, err := app.pruneBatches(`DELETE FROM news WHERE id IN
+			(SELECT id FROM news WHERE `+scope+` ORDER BY seq DESC LIMIT ? OFFSET ?)`,
+			append(args, retentionBatchSize, policy.maxItems)...)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// pruneBatches repeats a delete of at most retentionBatchSize rows until it
+// deletes fewer, so readers wait for short transactions only
+func (app *NewsApp) pruneBatches(statement string, args ...interface{}) (int64, error) {
+	var total int64
+	for {
+		result, err := app.db.Exec(statement, args...)
+		if err != nil {
+			return total, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += count
+		if count < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
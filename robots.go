@@ -0,0 +1,272 @@
+package aggregator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsTTL is how long a robots.txt is cached, robotsErrorTTL how long
+	// a host whose robots.txt failed to load stays disallowed
+	robotsTTL      = 24 * time.Hour
+	robotsErrorTTL = 10 * time.Minute
+	// maxRobotsSize is the part of a robots.txt that is read
+	maxRobotsSize = 512 << 10
+	// maxCrawlDelay caps the Crawl-delay of a robots.txt, a huge delay would
+	// stall every update of the host
+	maxCrawlDelay = 10 * time.Minute
+)
+
+// robotsRule allows or disallows the paths starting with a pattern, where *
+// matches any characters and a final $ the end of the path
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// robotsGroup are the rules of the user agents of one group of a robots.txt
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsTxt is a parsed robots.txt, disallowAll is set when it could not be
+// loaded because the host failed
+type robotsTxt struct {
+	groups      []*robotsGroup
+	disallowAll bool
+}
+
+// parseRobots reads the groups of a robots.txt, lines that are not understood
+// are ignored
+func parseRobots(r io.Reader) *robotsTxt {
+	robots := &robotsTxt{}
+	var group *robotsGroup
+	// agents is false after the rules of a group started, so the next
+	// user-agent line starts another group
+	agents := false
+	scanner := bufio.NewScanner(io.LimitReader(r, maxRobotsSize))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "user-agent":
+			if !agents {
+				group = &robotsGroup{}
+				robots.groups = append(robots.groups, group)
+				agents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			agents = false
+			// an empty disallow allows everything
+			if group != nil && value != "" {
+				group.rules = append(group.rules, robotsRule{value, strings.EqualFold(strings.TrimSpace(field), "allow")})
+			}
+		case "crawl-delay":
+			agents = false
+			if seconds, err := strconv.ParseFloat(value, 64); group != nil && err == nil && seconds > 0 {
+				group.crawlDelay = maxCrawlDelay
+				if seconds < maxCrawlDelay.Seconds() {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+	return robots
+}
+
+// group returns the group of the user agent, the one with the longest agent
+// contained in it or else the * group
+func (robots *robotsTxt) group(userAgent string) *robotsGroup {
+	userAgent = strings.ToLower(userAgent)
+	var match, any *robotsGroup
+	longest := 0
+	for _, group := range robots.groups {
+		for _, agent := range group.agents {
+			if agent == "*" {
+				if any == nil {
+					any = group
+				}
+			} else if len(agent) > longest && strings.Contains(userAgent, agent) {
+				match, longest = group, len(agent)
+			}
+		}
+	}
+	if match != nil {
+		return match
+	}
+	return any
+}
+
+// allowed tells whether the user agent may request the path, the longest
+// matching rule decides and allow wins a tie
+func (robots *robotsTxt) allowed(userAgent, path string) bool {
+	if robots.disallowAll {
+		return false
+	}
+	group := robots.group(userAgent)
+	if group == nil {
+		return true
+	}
+	allowed, longest := true, -1
+	for _, rule := range group.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// crawlDelay returns the Crawl-delay of the group of the user agent
+func (robots *robotsTxt) crawlDelay(userAgent string) time.Duration {
+	if group := robots.group(userAgent); group != nil {
+		return group.crawlDelay
+	}
+	return 0
+}
+
+// robotsMatch reports whether the path starts with the pattern
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	parts = parts[1:]
+	for i, part := range parts {
+		// the last part of an anchored pattern has to end the path
+		if anchored && i == len(parts)-1 {
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	return !anchored || rest == ""
+}
+
+// robotsCache holds the robots.txt of every host requested
+type robotsCache struct {
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	mu      sync.Mutex
+	robots  *robotsTxt
+	expires time.Time
+}
+
+func (c *robotsCache) entry(origin string) *robotsEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hosts == nil {
+		c.hosts = make(map[string]*robotsEntry)
+	}
+	entry, ok := c.hosts[origin]
+	if !ok {
+		entry = &robotsEntry{}
+		c.hosts[origin] = entry
+	}
+	return entry
+}
+
+// robots returns the robots.txt of the host of u, loading it when it is not
+// cached or expired. Requests of one host wait while it is loaded.
+func (app *NewsApp) robots(ctx context.Context, u *url.URL, rule *ParsingRule) *robotsTxt {
+	origin := u.Scheme + "://" + u.Host
+	entry := app.robotsCache.entry(origin)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.robots != nil && time.Now().Before(entry.expires) {
+		return entry.robots
+	}
+	robots, err := app.loadRobots(ctx, origin, rule)
+	if err != nil && ctx.Err() != nil {
+		// a canceled update says nothing about the host
+		return robots
+	}
+	entry.robots, entry.expires = robots, time.Now().Add(robotsTTL)
+	if err != nil {
+		slog.Warn("robots.txt failed to load, disallowing the host", "host", u.Host, "err", err)
+		entry.expires = time.Now().Add(robotsErrorTTL)
+	}
+	return robots
+}
+
+// loadRobots requests the robots.txt of the origin. A missing robots.txt
+// allows everything while a server error disallows everything.
+func (app *NewsApp) loadRobots(ctx context.Context, origin string, rule *ParsingRule) (*robotsTxt, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return &robotsTxt{disallowAll: true}, err
+	}
+	req.Header.Set("User-Agent", rule.userAgent())
+	client, err := app.ruleClient(rule)
+	if err != nil {
+		return &robotsTxt{disallowAll: true}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &robotsTxt{disallowAll: true}, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return parseRobots(resp.Body), nil
+	case resp.StatusCode >= 500:
+		return &robotsTxt{disallowAll: true}, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	default:
+		return &robotsTxt{}, nil
+	}
+}
+
+// checkRobots returns an error when the robots.txt of its host disallows the
+// request of u, otherwise the Crawl-delay asked for, at most the interval of
+// the rule. Nothing is checked with
+// -ignoreRobots or for rules with ignoreRobots.
+func (app *NewsApp) checkRobots(ctx context.Context, u *url.URL, rule *ParsingRule) (time.Duration, error) {
+	if app.config.IgnoreRobots || rule.IgnoreRobots {
+		return 0, nil
+	}
+	robots := app.robots(ctx, u, rule)
+	userAgent := rule.userAgent()
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if !robots.allowed(userAgent, path) {
+		slog.Warn("request disallowed by robots.txt", "source", rule.URL, "url", u.String())
+		return 0, fmt.Errorf("%s is disallowed by robots.txt", u)
+	}
+	delay := robots.crawlDelay(userAgent)
+	// a delay beyond the interval of the rule would postpone its updates
+	if interval := time.Duration(rule.Interval) * time.Minute; interval > 0 && delay > interval {
+		delay = interval
+	}
+	return delay, nil
+}
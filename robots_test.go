@@ -0,0 +1,42 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCrawlDelay(t *testing.T) {
+	tests := []struct {
+		crawlDelay string
+		interval   uint
+		want       time.Duration
+	}{
+		{"5", 30, 5 * time.Second},
+		{"0.5", 30, 500 * time.Millisecond},
+		{"-3", 30, 0},
+		{"soon", 30, 0},
+		{"86400", 0, maxCrawlDelay},
+		{"1e300", 0, maxCrawlDelay},
+		{"600", 1, time.Minute},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "User-agent: *\nCrawl-delay: %s\n", test.crawlDelay)
+		}))
+		app := NewNewsApp(Config{})
+		rule := &ParsingRule{URL: server.URL + "/", Interval: test.interval}
+		u, _ := url.Parse(rule.URL)
+		delay, err := app.checkRobots(context.Background(), u, rule)
+		server.Close()
+		if err != nil {
+			t.Errorf("Crawl-delay %s: %v", test.crawlDelay, err)
+		} else if delay != test.want {
+			t.Errorf("Crawl-delay %s with interval %d: got %v, want %v", test.crawlDelay, test.interval, delay, test.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package aggregator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// rulesHandler manages the parsing rules. GET lists the rules or returns the
+// one with the url parameter, POST adds the rule of the body, PUT replaces the
+// rule with the url parameter by the body and DELETE removes it. Changes are
+// written to the rules file and only the updaters of the affected rules are
+// restarted.
+func (app *NewsApp) rulesHandler(w http.ResponseWriter, r *http.Request) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	url := r.URL.Query().Get("url")
+	index := -1
+	for i, rule := range app.parsingRules {
+		if rule.URL == url {
+			index = i
+			break
+		}
+	}
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete || r.Method == http.MethodGet && url != "" {
+		if url == "" {
+			http.Error(w, "url is required", http.StatusBadRequest)
+			return
+		}
+		if index < 0 {
+			http.Error(w, fmt.Sprintf("no rule with url %q", url), http.StatusNotFound)
+			return
+		}
+	}
+	rules := append([]*ParsingRule(nil), app.parsingRules...)
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+		if index >= 0 {
+			writeRulesJSON(w, status, app.parsingRules[index])
+			return
+		}
+		writeRulesJSON(w, status, app.parsingRules)
+		return
+	case http.MethodPost, http.MethodPut:
+		rule := new(ParsingRule)
+		if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+			http.Error(w, fmt.Sprintf("error while reading the rule: %v", err), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPut {
+			rules[index] = rule
+		} else {
+			rules = append(rules, rule)
+			status = http.StatusCreated
+		}
+	case http.MethodDelete:
+		rules = append(rules[:index], rules[index+1:]...)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := app.prepareChangedRules(rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := writeParsingRules(app.config.RulesFile, rules); err != nil {
+		http.Error(w, fmt.Sprintf("unable to save parsing rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	changes, err := app.replaceParsingRules(rules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeRulesJSON(w, status, changes)
+}
+
+// sourceEnableHandler enables or disables the rule with the URL, the change is
+// written to the rules file and the updater of the rule is started or stopped
+func (app *NewsApp) sourceEnableHandler(w http.ResponseWriter, r *http.Request, url string, enabled bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	rules := append([]*ParsingRule(nil), app.parsingRules...)
+	index := -1
+	for i, rule := range rules {
+		if rule.URL == url {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		http.Error(w, "unknown source", http.StatusNotFound)
+		return
+	}
+	rule, err := rules[index].clone()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rule.Enabled = nil
+	if !enabled {
+		rule.Enabled = &enabled
+	}
+	rules[index] = rule
+	if err := app.prepareChangedRules(rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := writeParsingRules(app.config.RulesFile, rules); err != nil {
+		http.Error(w, fmt.Sprintf("unable to save parsing rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	changes, err := app.replaceParsingRules(rules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeRulesJSON(w, http.StatusOK, changes)
+}
+
+func writeRulesJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s\n", data)
+}
+
+// writeParsingRules replaces the rules file through a temporary file, so a
+// failed write does not leave a truncated file
+func writeParsingRules(filename string, rules []*ParsingRule) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// XPath expressions are kept readable instead of escaping < > and &
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(rules); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
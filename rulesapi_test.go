@@ -0,0 +1,87 @@
+package aggregator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newRulesTestApp returns an application with one prepared live rule and a
+// rules file in a temporary directory
+func newRulesTestApp(t *testing.T) (*NewsApp, *ParsingRule) {
+	live := &ParsingRule{
+		URL:                "https://example.com/",
+		Schedule:           "0 7 * * *",
+		NewsNodesXPathExpr: "//article",
+		LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+		TitleRule:          ExtractRule{XPathExpr: "a"},
+		DetailRules:        map[string]ExtractRule{"author": {Selector: ".author"}},
+	}
+	if err := prepareParsingRules([]*ParsingRule{live}); err != nil {
+		t.Fatal(err)
+	}
+	app := NewNewsApp(Config{RulesFile: filepath.Join(t.TempDir(), "rules.json")})
+	app.parsingRules = []*ParsingRule{live}
+	return app, live
+}
+
+func TestRulesHandlerKeepsLiveRules(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/api/rules", `{"url": "https://example.org/", "intervalMinutes": 30, "newsNodesExpr": "//li", "linkRule": {"expr": "a", "attr": "href"}, "titleRule": {"expr": "a"}}`, http.StatusCreated},
+		{http.MethodPost, "/api/rules", `{"url": "https://example.org/"}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		app, live := newRulesTestApp(t)
+		cron := live.cron
+		detailRules := reflect.ValueOf(live.DetailRules).Pointer()
+		w := httptest.NewRecorder()
+		app.rulesHandler(w, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+		if w.Code != test.status {
+			t.Errorf("%s %s: got status %d, want %d: %s", test.method, test.body, w.Code, test.status, w.Body)
+		}
+		if live.cron != cron || reflect.ValueOf(live.DetailRules).Pointer() != detailRules {
+			t.Errorf("%s %s: the live rule was compiled again", test.method, test.body)
+		}
+	}
+}
+
+func TestSourceEnableHandlerClonesRule(t *testing.T) {
+	tests := []struct {
+		url     string
+		enabled bool
+		status  int
+	}{
+		{"https://example.com/", false, http.StatusOK},
+		{"https://example.com/", true, http.StatusOK},
+		{"https://example.net/", false, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		app, live := newRulesTestApp(t)
+		cron := live.cron
+		detailRules := reflect.ValueOf(live.DetailRules).Pointer()
+		w := httptest.NewRecorder()
+		app.sourceEnableHandler(w, httptest.NewRequest(http.MethodPost, "/api/sources/1/enable", nil), test.url, test.enabled)
+		if w.Code != test.status {
+			t.Errorf("%s enabled=%v: got status %d, want %d: %s", test.url, test.enabled, w.Code, test.status, w.Body)
+			continue
+		}
+		if live.cron != cron || reflect.ValueOf(live.DetailRules).Pointer() != detailRules || !live.enabled() {
+			t.Errorf("%s enabled=%v: the live rule was changed", test.url, test.enabled)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		rule := app.parsingRules[0]
+		if rule == live || rule.enabled() != test.enabled || rule.DetailRules["author"].selectorExpr == "" {
+			t.Errorf("%s enabled=%v: got rule %+v", test.url, test.enabled, rule)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package aggregator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// reasons passed to the observer of observeNews
+const (
+	skipReasonEmpty    = "empty"
+	skipReasonFiltered = "filtered"
+)
+
+// maxDiagnosticHTML limits the markup of a news node in the diagnostics
+const maxDiagnosticHTML = 500
+
+// ruleTest is the body of /api/rules/test, the rule is applied to HTML, or to
+// the feed of an rss rule, the sitemap of a sitemap rule or the document of a
+// json rule, instead of its page when given
+type ruleTest struct {
+	Rule *ParsingRule `json:"rule"`
+	HTML string       `json:"html,omitempty"`
+}
+
+// nodeDiagnostic tells what a rule found in one news node. LinkExpr and
+// TitleExpr are the expressions that produced the values, empty when none
+// did, so a failing alternative can be spotted.
+type nodeDiagnostic struct {
+	Index     int    `json:"index"`
+	Link      string `json:"link,omitempty"`
+	Title     string `json:"title,omitempty"`
+	LinkExpr  string `json:"linkExpr,omitempty"`
+	TitleExpr string `json:"titleExpr,omitempty"`
+	Skipped   string `json:"skipped,omitempty"`
+	HTML      string `json:"html,omitempty"`
+}
+
+type ruleTestResult struct {
+	Matched         int              `json:"matched"`
+	Extracted       int              `json:"extracted"`
+	SkippedEmpty    int              `json:"skippedEmpty"`
+	SkippedFiltered int              `json:"skippedFiltered"`
+	Items           []NewsItem       `json:"items"`
+	Nodes           []nodeDiagnostic `json:"nodes,omitempty"`
+}
+
+// matchingExpr returns the expression of the rule or of its alternatives that
+// extracts a value from the node, empty when none does
+func matchingExpr(node *html.Node, rule *ExtractRule) string {
+	if extractSingleValue(node, rule) != "" {
+		if rule.Selector != "" {
+			return rule.Selector
+		}
+		return rule.XPathExpr
+	}
+	for i := range rule.Alternatives {
+		if expr := matchingExpr(node, &rule.Alternatives[i]); expr != "" {
+			return expr
+		}
+	}
+	return ""
+}
+
+func outerHTML(node *html.Node) string {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, node); err != nil {
+		return ""
+	}
+	if buf.Len() > maxDiagnosticHTML {
+		return truncateText(buf.String(), maxDiagnosticHTML)
+	}
+	return buf.String()
+}
+
+// ruleTestHandler applies the rule of the body to its page, or to the HTML of
+// the body, and returns the items with diagnostics of every news node. Nothing
+// is stored, links are not verified and detail pages are not fetched.
+func (app *NewsApp) ruleTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var test ruleTest
+	if err := json.NewDecoder(r.Body).Decode(&test); err != nil {
+		http.Error(w, fmt.Sprintf("error while reading the test: %v", err), http.StatusBadRequest)
+		return
+	}
+	if test.Rule == nil {
+		http.Error(w, "rule is required", http.StatusBadRequest)
+		return
+	}
+	rule := test.Rule
+	if err := prepareParsingRules([]*ParsingRule{rule}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the updates of the rule keep their validators
+	ctx := withoutValidators(r.Context())
+	var stats ingestStats
+	result := ruleTestResult{Items: make([]NewsItem, 0)}
+	var items []NewsItem
+	var err error
+	if rule.Type == ruleTypeRSS {
+		var entries []feedEntry
+		if test.HTML != "" {
+			_, entries, err = parseFeed(strings.NewReader(test.HTML))
+		} else {
+			var req *http.Request
+			if req, err = newRuleRequest(ctx, rule); err == nil {
+				var resp *http.Response
+				if resp, err = app.fetch(req, rule); err == nil {
+					_, entries, err = parseFeed(resp.Body)
+					resp.Body.Close()
+				}
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		items, err = app.extractFeedNews(rule, entries, &stats)
+	} else if rule.Type == ruleTypeJSON {
+		var doc interface{}
+		if test.HTML != "" {
+			doc, err = parseJSONDocument(strings.NewReader(test.HTML))
+		} else {
+			var req *http.Request
+			if req, err = newRuleRequest(ctx, rule); err == nil {
+				var resp *http.Response
+				if resp, err = app.fetch(req, rule); err == nil {
+					doc, err = parseJSONDocument(resp.Body)
+					resp.Body.Close()
+				}
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		items, err = app.extractJSONNews(rule, doc, &stats)
+	} else if rule.Type == ruleTypeSitemap {
+		if test.HTML != "" {
+			var doc *sitemapDocument
+			if doc, err = parseSitemap(strings.NewReader(test.HTML)); err == nil {
+				items, err = app.extractSitemapNews(rule, doc, &stats)
+			}
+		} else {
+			items, err = app.loadSitemapNews(ctx, rule, &stats)
+		}
+	} else {
+		var doc *html.Node
+		if test.HTML != "" {
+			doc, err = htmlquery.Parse(strings.NewReader(test.HTML))
+		} else {
+			doc, err = app.fetchDocument(ctx, rule)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		items, err = app.observeNews(rule, doc, &stats, func(nodes newsNodes, link, title, skipped string) {
+			diagnostic := nodeDiagnostic{
+				Index:     len(result.Nodes) + 1,
+				Link:      link,
+				Title:     title,
+				LinkExpr:  matchingExpr(nodes.link, &rule.LinkRule),
+				TitleExpr: matchingExpr(nodes.title, &rule.TitleRule),
+				Skipped:   skipped,
+				HTML:      outerHTML(nodes.title),
+			}
+			if skipped == skipReasonEmpty {
+				if link == "" {
+					diagnostic.Skipped = "link is empty"
+				} else {
+					diagnostic.Skipped = "title is empty"
+				}
+			}
+			result.Nodes = append(result.Nodes, diagnostic)
+		})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if items != nil {
+		result.Items = items
+	}
+	result.Matched = stats.matched
+	result.Extracted = len(items)
+	result.SkippedEmpty = stats.skippedEmpty
+	result.SkippedFiltered = stats.skippedFiltered
+	writeRulesJSON(w, http.StatusOK, result)
+}
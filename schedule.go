@@ -0,0 +1,167 @@
+package aggregator
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// defaultJitter is the default of -jitter
+const defaultJitter = 30 * time.Second
+
+// jitter returns the maximal random delay of the updates of the rule,
+// -jitter when the rule does not set one
+func (app *NewsApp) jitter(rule *ParsingRule) time.Duration {
+	if rule.JitterSeconds == nil {
+		return app.config.Jitter
+	}
+	return time.Duration(*rule.JitterSeconds) * time.Second
+}
+
+// scheduledRule is the next run of a rule, at is the time of the interval or
+// the cron schedule and due adds the jitter to it
+type scheduledRule struct {
+	rule    *ParsingRule
+	at      time.Time
+	due     time.Time
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running bool
+}
+
+// ruleScheduler starts the due updates of all rules from one goroutine
+type ruleScheduler struct {
+	mu    sync.Mutex
+	rules map[string]*scheduledRule
+	// wake makes the scheduler look at the rules before the next due one
+	wake chan struct{}
+}
+
+func (s *ruleScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextRun returns when the rule is due after the run at the time, or the
+// first run when at is zero. Interval rules run right after the start, rules
+// with a schedule wait for its next time.
+func (app *NewsApp) nextRun(rule *ParsingRule, at time.Time, now time.Time) time.Time {
+	if rule.cron != nil {
+		return rule.cron.next(now)
+	}
+	if at.IsZero() {
+		return now
+	}
+	interval := time.Duration(rule.Interval) * time.Minute
+	// runs missed while an update took too long are dropped like ticks
+	at = at.Add(interval)
+	for !at.After(now) {
+		at = at.Add(interval)
+	}
+	return at
+}
+
+func (app *NewsApp) addJitter(rule *ParsingRule, at time.Time) time.Time {
+	if jitter := app.jitter(rule); jitter > 0 {
+		return at.Add(time.Duration(rand.Int63n(int64(jitter))))
+	}
+	return at
+}
+
+func (app *NewsApp) startUpdaters() {
+	for _, rule := range app.parsingRules {
+		app.startUpdater(rule)
+	}
+}
+
+// startUpdater schedules the first run of the rule, the jitter spreads the
+// updates of the rules run at the start. Disabled rules are not scheduled.
+func (app *NewsApp) startUpdater(rule *ParsingRule) {
+	if !rule.enabled() {
+		return
+	}
+	s := &app.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rules == nil {
+		s.rules = make(map[string]*scheduledRule)
+	}
+	ctx, cancel := context.WithCancel(app.ctx)
+	entry := &scheduledRule{rule: rule, ctx: ctx, cancel: cancel}
+	entry.at = app.nextRun(rule, time.Time{}, time.Now())
+	entry.due = app.addJitter(rule, entry.at)
+	s.rules[rule.URL] = entry
+	app.statuses.scheduled(rule.URL, entry.due)
+	s.notify()
+}
+
+// stopUpdater removes the rule with the URL from the schedule, an update in
+// progress is finished
+func (app *NewsApp) stopUpdater(url string) {
+	s := &app.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.rules[url]; ok {
+		entry.cancel()
+		delete(s.rules, url)
+	}
+}
+
+// runScheduler starts the updates of the due rules until ctx is canceled. A
+// rule whose previous update is still running skips the run.
+func (app *NewsApp) runScheduler(ctx context.Context) {
+	s := &app.scheduler
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		now := time.Now()
+		wait := time.Duration(-1)
+		s.mu.Lock()
+		for _, entry := range s.rules {
+			if !entry.due.After(now) {
+				if entry.running {
+					slog.Warn("previous update still running, skipping", "source", entry.rule.URL)
+				} else {
+					app.startUpdate(entry)
+				}
+				entry.at = app.nextRun(entry.rule, entry.at, now)
+				entry.due = app.addJitter(entry.rule, entry.at)
+				app.statuses.scheduled(entry.rule.URL, entry.due)
+			}
+			if until := entry.due.Sub(now); wait < 0 || until < wait {
+				wait = until
+			}
+		}
+		s.mu.Unlock()
+		if wait < 0 {
+			wait = time.Hour
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startUpdate submits an update of the scheduled rule to the workers,
+// app.scheduler.mu must be held
+func (app *NewsApp) startUpdate(entry *scheduledRule) {
+	entry.running = app.pool.submit(fetchJob{ctx: entry.ctx, rule: entry.rule, done: func() {
+		app.scheduler.mu.Lock()
+		entry.running = false
+		app.scheduler.mu.Unlock()
+	}})
+}
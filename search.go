@@ -0,0 +1,117 @@
+package aggregator
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/cleonty/news-aggregator/storage"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// foldCase maps a text to the form compared by the title search, the SQL
+// function fold
+var foldCase = storage.FoldCase
+
+// escapeLike escapes the wildcards of a LIKE pattern with a backslash
+func escapeLike(text string) string {
+	return likeEscaper.Replace(text)
+}
+
+// searchTerm is a word or a quoted phrase of a search, negated by a leading -
+type searchTerm struct {
+	text    string
+	phrase  bool
+	negated bool
+}
+
+// searchQuery holds the clauses of a search which all have to match, a clause
+// matches when one of its terms does. Negated terms are clauses of their own.
+type searchQuery [][]searchTerm
+
+// parseSearch splits the search text into words and "quoted phrases" that
+// must all occur in any order, a term starting with - must not occur and OR
+// between terms lets either of them match
+func parseSearch(text string) searchQuery {
+	var query searchQuery
+	or := false
+	for _, term := range searchTerms(text) {
+		switch {
+		case !term.phrase && !term.negated && term.text == "OR":
+			or = len(query) > 0
+			continue
+		case or && !term.negated && !query[len(query)-1][0].negated:
+			query[len(query)-1] = append(query[len(query)-1], term)
+		default:
+			query = append(query, []searchTerm{term})
+		}
+		or = false
+	}
+	return query
+}
+
+// searchTerms tokenizes the search text, an unterminated quote ends the text
+func searchTerms(text string) []searchTerm {
+	var terms []searchTerm
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return terms
+		}
+		var term searchTerm
+		if strings.HasPrefix(text, "-") && len(text) > 1 && !unicode.IsSpace(rune(text[1])) {
+			term.negated = true
+			text = text[1:]
+		}
+		if strings.HasPrefix(text, `"`) {
+			phrase, rest, _ := strings.Cut(text[1:], `"`)
+			term.text = strings.Join(strings.Fields(phrase), " ")
+			term.phrase = true
+			text = rest
+		} else {
+			end := strings.IndexFunc(text, unicode.IsSpace)
+			if end < 0 {
+				end = len(text)
+			}
+			term.text, text = text[:end], text[end:]
+		}
+		if term.text != "" {
+			terms = append(terms, term)
+		}
+	}
+}
+
+// positive tells whether the query has a clause that is not negated
+func (query searchQuery) positive() bool {
+	for _, clause := range query {
+		if !clause[0].negated {
+			return true
+		}
+	}
+	return false
+}
+
+// likeConditions returns SQL conditions matching the folded titles against
+// the query, the terms match as substrings ignoring case
+func (query searchQuery) likeConditions() ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	for _, clause := range query {
+		if clause[0].negated {
+			conditions = append(conditions, `fold(title) NOT LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(foldCase(clause[0].text))+"%")
+			continue
+		}
+		alternatives := make([]string, 0, len(clause))
+		for _, term := range clause {
+			alternatives = append(alternatives, `fold(title) LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+escapeLike(foldCase(term.text))+"%")
+		}
+		if len(alternatives) == 1 {
+			conditions = append(conditions, alternatives[0])
+		} else {
+			conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+		}
+	}
+	return conditions, args
+}
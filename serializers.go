@@ -0,0 +1,152 @@
+package aggregator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cleonty/news-aggregator/server"
+)
+
+const defaultFormat = "json"
+
+// Serializer writes a page of news items in some format
+type Serializer interface {
+	// ContentType is the media type of the format, it is matched against Accept
+	ContentType() string
+	Serialize(w io.Writer, r *http.Request, page NewsPage) error
+}
+
+var (
+	serializersMu sync.RWMutex
+	serializers   = map[string]Serializer{
+		"json":     jsonSerializer{},
+		"csv":      csvSerializer{},
+		"atom":     atomSerializer{},
+		"rss":      rssSerializer{},
+		"jsonfeed": jsonFeedSerializer{},
+	}
+)
+
+// RegisterSerializer makes a format available to the news endpoints through
+// the format parameter and the Accept header
+func RegisterSerializer(format string, serializer Serializer) {
+	serializersMu.Lock()
+	defer serializersMu.Unlock()
+	serializers[format] = serializer
+}
+
+// negotiateSerializer selects a serializer by the format parameter or else by
+// the Accept header. It returns nil when no registered format is acceptable.
+func negotiateSerializer(r *http.Request) Serializer {
+	serializersMu.RLock()
+	defer serializersMu.RUnlock()
+	if format := r.Form.Get("format"); format != "" {
+		return serializers[format]
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return serializers[defaultFormat]
+	}
+	var formats []string
+	for format := range serializers {
+		formats = append(formats, format)
+	}
+	// the default format wins among several matching ones
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i] == defaultFormat || (formats[j] != defaultFormat && formats[i] < formats[j])
+	})
+	for _, mediaRange := range server.ParseAccept(accept) {
+		if mediaRange == "*/*" {
+			return serializers[defaultFormat]
+		}
+		for _, format := range formats {
+			if mediaTypeMatches(mediaRange, serializers[format].ContentType()) {
+				return serializers[format]
+			}
+		}
+	}
+	return nil
+}
+
+func mediaTypeMatches(mediaRange, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return mediaRange == mediaType
+}
+
+// writeNews serializes the page in the negotiated format, the total is also
+// sent in the X-Total-Count header for formats without a place for it
+func writeNews(w http.ResponseWriter, r *http.Request, page NewsPage) {
+	serializer := negotiateSerializer(r)
+	if serializer == nil {
+		http.Error(w, "none of the requested formats is supported", http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Set("Content-type", serializer.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	// the serializers encode the page before writing it, so a failure other
+	// than a broken connection is reported before anything is sent
+	if err := serializer.Serialize(w, r, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) ContentType() string {
+	return "application/json"
+}
+
+func (jsonSerializer) Serialize(w io.Writer, r *http.Request, page NewsPage) error {
+	return json.NewEncoder(w).Encode(page)
+}
+
+type csvSerializer struct{}
+
+func (csvSerializer) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (csvSerializer) Serialize(w io.Writer, r *http.Request, page NewsPage) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+	for _, item := range page.Items {
+		writer.Write(csvRecord(&item))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+var csvHeader = []string{"id", "seq", "link", "title", "source", "timestamp", "published", "ruleVersion", "category"}
+
+func csvRecord(item *NewsItem) []string {
+	var published string
+	if item.Published != nil {
+		published = item.Published.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		strconv.FormatInt(item.ID, 10),
+		strconv.FormatInt(item.Seq, 10),
+		item.Link,
+		item.Title,
+		item.Source,
+		item.Timestamp.UTC().Format(time.RFC3339),
+		published,
+		item.RuleVersion,
+		item.Category,
+	}
+}
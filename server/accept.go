@@ -0,0 +1,40 @@
+// Package server holds the HTTP middleware of the API: CORS, rate limits,
+// compression and request logging
+package server
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseAccept returns the media ranges of an Accept header by descending quality
+func ParseAccept(accept string) []string {
+	type mediaRange struct {
+		value   string
+		quality float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType, quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+	result := make([]string, len(ranges))
+	for i, r := range ranges {
+		result[i] = r.value
+	}
+	return result
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+// compressionEncoding returns the encoding of the response negotiated by the
+// Accept-Encoding header, gzip or deflate, empty for none
+func compressionEncoding(r *http.Request) string {
+	for _, encoding := range ParseAccept(r.Header.Get("Accept-Encoding")) {
+		switch encoding {
+		case "gzip", "x-gzip", "*":
+			return "gzip"
+		case "deflate":
+			return "deflate"
+		}
+	}
+	return ""
+}
+
+// Compress compresses the responses of the handler with the encoding
+// accepted by the client. Responses without a body and those encoded by the
+// handler itself are sent as they are.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := compressionEncoding(r)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter starts compressing with the first write of the body
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	writer      io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	header := cw.Header()
+	bodyless := status == http.StatusNoContent || status == http.StatusNotModified || status < http.StatusOK
+	if !bodyless && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		if cw.encoding == "gzip" {
+			cw.writer = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.writer, _ = flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.writer == nil {
+		return cw.ResponseWriter.Write(data)
+	}
+	return cw.writer.Write(data)
+}
+
+// Flush sends the data compressed so far, for responses streamed in batches
+func (cw *compressWriter) Flush() {
+	if flusher, ok := cw.writer.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) close() {
+	if cw.writer != nil {
+		cw.writer.Close()
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// DefaultAllowMethods and DefaultAllowHeaders are sent in preflight
+// responses by default
+const (
+	DefaultAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	DefaultAllowHeaders = "Authorization, X-API-Key, Content-Type"
+)
+
+// CORS lets the Origins, "*" for any, call the API from a browser with the
+// Methods and Headers of preflight requests
+type CORS struct {
+	Origins []string
+	Methods []string
+	Headers []string
+}
+
+// origin returns the value of Access-Control-Allow-Origin for the origin of
+// a request, empty when the origin is not allowed
+func (c *CORS) origin(origin string) string {
+	if slices.Contains(c.Origins, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(c.Origins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// Handler adds CORS headers for the allowed origins and answers preflight
+// requests, which carry no API key, before they reach next. Without origins
+// no headers are added.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(c.Origins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header := w.Header()
+		origin := c.origin(r.Header.Get("Origin"))
+		if origin != "*" {
+			header.Add("Vary", "Origin")
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			if preflight {
+				// the browser rejects the request without the headers
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Expose-Headers", "X-Total-Count")
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", strings.Join(c.Methods, ", "))
+			header.Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+			header.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// StatusRecorder remembers the Status and the Size of a response
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+	Size   int
+}
+
+func (rec *StatusRecorder) WriteHeader(status int) {
+	if rec.Status == 0 {
+		rec.Status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *StatusRecorder) Write(data []byte) (int, error) {
+	if rec.Status == 0 {
+		rec.Status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(data)
+	rec.Size += n
+	return n, err
+}
+
+// Flush keeps streamed responses working through the recorder
+func (rec *StatusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *StatusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// LogRequests logs the requests of the route with their status and duration
+func LogRequests(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &StatusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(rec, r)
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		slog.Info("request", "method", r.Method, "route", route, "path", r.URL.Path, "status", rec.Status,
+			"bytes", rec.Size, "duration", time.Since(start), "remote", r.RemoteAddr)
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitSweep is how often the buckets of clients that are idle long
+// enough to be full again are dropped
+const rateLimitSweep = time.Minute
+
+// RateLimiter allows every client rate requests per second with bursts of
+// burst requests, a token bucket per client address
+type RateLimiter struct {
+	rate       float64
+	burst      float64
+	trustProxy bool
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter, it does not limit anything when rate is 0
+func NewRateLimiter(rate float64, burst int, trustProxy bool) *RateLimiter {
+	return &RateLimiter{rate: rate, burst: float64(burst), trustProxy: trustProxy, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token of the client and returns how long to wait for one when
+// there is none
+func (l *RateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateLimitSweep {
+		l.sweep(now)
+	}
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// client returns the address of the client of the request
+func (l *RateLimiter) client(r *http.Request) string {
+	if l.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Limit answers 429 Too Many Requests to clients beyond the rate
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	if l.rate <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(l.client(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
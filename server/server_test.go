@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   []string
+	}{
+		{"", []string{}},
+		{"gzip", []string{"gzip"}},
+		{"deflate;q=0.5, gzip", []string{"gzip", "deflate"}},
+		{"gzip;q=0, br", []string{"br"}},
+	}
+	for _, test := range tests {
+		if got := ParseAccept(test.accept); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseAccept(%q) = %q, want %q", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := NewRateLimiter(1, 2, false)
+	now := time.Now()
+	tests := []struct {
+		client string
+		after  time.Duration
+		allow  bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+		{"b", 0, true},
+		{"a", time.Second, true},
+		{"a", time.Second, false},
+	}
+	for i, test := range tests {
+		if allow, _ := limiter.allow(test.client, now.Add(test.after)); allow != test.allow {
+			t.Errorf("request %d of %s: allow = %v, want %v", i, test.client, allow, test.allow)
+		}
+	}
+}
+
+func TestCORSHandler(t *testing.T) {
+	cors := &CORS{Origins: []string{"https://example.com"}, Methods: []string{"GET"}, Headers: []string{"X-API-Key"}}
+	handler := cors.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		origin    string
+		preflight bool
+		status    int
+		allowed   string
+	}{
+		{"https://example.com", false, http.StatusOK, "https://example.com"},
+		{"https://example.com", true, http.StatusNoContent, "https://example.com"},
+		{"https://other.com", false, http.StatusOK, ""},
+		{"https://other.com", true, http.StatusNoContent, ""},
+	}
+	for _, test := range tests {
+		method := http.MethodGet
+		if test.preflight {
+			method = http.MethodOptions
+		}
+		r := httptest.NewRequest(method, "/news/", nil)
+		r.Header.Set("Origin", test.origin)
+		if test.preflight {
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status || w.Header().Get("Access-Control-Allow-Origin") != test.allowed {
+			t.Errorf("%s from %s: got %d with origin %q", method, test.origin, w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
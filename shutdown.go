@@ -0,0 +1,42 @@
+package aggregator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// shutdownTimeout bounds the wait for open requests and running updates
+const shutdownTimeout = 30 * time.Second
+
+// shutdown stops the HTTP and gRPC servers and the updaters and closes the database
+// once the updates in progress are finished. The context of the application
+// must already be canceled.
+func (app *NewsApp) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := app.server.Shutdown(ctx)
+	if err != nil {
+		slog.Warn("unable to finish open requests", "err", err)
+	}
+	if app.redirect != nil {
+		app.redirect.Shutdown(ctx)
+	}
+	if app.grpc != nil {
+		app.stopGRPC(ctx)
+	}
+	finished := make(chan struct{})
+	go func() {
+		app.background.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		slog.Warn("updates did not finish in time, closing the database anyway")
+	}
+	if closeErr := app.db.Close(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
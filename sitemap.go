@@ -0,0 +1,212 @@
+package aggregator
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// maxSitemapURLs is the number of the most recently modified URLs kept
+	// from the sitemaps of one update
+	maxSitemapURLs = 1000
+	// maxSitemaps limits the sitemaps read through sitemap indexes
+	maxSitemaps = 50
+)
+
+// sitemapDocument is a urlset or a sitemapindex, the news and image fields
+// are the Google News and image extensions
+type sitemapDocument struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+		News    struct {
+			Title           string `xml:"title"`
+			PublicationDate string `xml:"publication_date"`
+		} `xml:"news"`
+		Images []struct {
+			Loc string `xml:"loc"`
+		} `xml:"image"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+// sitemapEntry is a URL of a sitemap with the time it was modified
+type sitemapEntry struct {
+	feedEntry
+	modified *time.Time
+}
+
+// compileURLPattern compiles the urlPattern of a sitemap rule
+func (rule *ParsingRule) compileURLPattern() error {
+	rule.urlPattern = nil
+	if rule.URLPattern == "" {
+		return nil
+	}
+	pattern, err := regexp.Compile(rule.URLPattern)
+	if err != nil {
+		return err
+	}
+	rule.urlPattern = pattern
+	return nil
+}
+
+// sitemapCutoff returns the time before which URLs are skipped, zero when
+// maxAgeHours is not set
+func (rule *ParsingRule) sitemapCutoff() time.Time {
+	if rule.MaxAgeHours == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-time.Duration(rule.MaxAgeHours) * time.Hour)
+}
+
+// loadSitemapNews reads the sitemap of the rule, following sitemap indexes,
+// and turns the URLs matching urlPattern and modified within maxAgeHours into
+// items. Titles come from the news extension or else, with pageMetadata, from
+// the pages.
+func (app *NewsApp) loadSitemapNews(ctx context.Context, rule *ParsingRule, stats *ingestStats) ([]NewsItem, error) {
+	cutoff := rule.sitemapCutoff()
+	req, err := newRuleRequest(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	pending := []*http.Request{req}
+	var entries []sitemapEntry
+	for read := 0; len(pending) > 0; read++ {
+		if read == maxSitemaps {
+			slog.Warn("sitemap index lists too many sitemaps, the rest is skipped", "source", rule.URL, "limit", maxSitemaps)
+			break
+		}
+		req, pending = pending[0], pending[1:]
+		doc, err := app.fetchSitemap(req, rule)
+		if err != nil {
+			if read == 0 {
+				return nil, err
+			}
+			slog.Warn("unable to read sitemap", "source", rule.URL, "sitemap", req.URL.String(), "err", err)
+			continue
+		}
+		for _, sitemap := range doc.Sitemaps {
+			if modified := parseISOTime(strings.TrimSpace(sitemap.LastMod)); modified != nil && modified.Before(cutoff) {
+				continue
+			}
+			child, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(sitemap.Loc), nil)
+			if err != nil {
+				slog.Warn("invalid sitemap in index", "source", rule.URL, "sitemap", sitemap.Loc, "err", err)
+				continue
+			}
+			pending = append(pending, child)
+		}
+		entries = append(entries, rule.sitemapEntries(doc, cutoff, stats)...)
+	}
+	return app.extractSitemapEntries(rule, entries, stats)
+}
+
+// extractSitemapNews turns the URLs of a urlset into items without network
+// requests, the sitemaps of an index are not read
+func (app *NewsApp) extractSitemapNews(rule *ParsingRule, doc *sitemapDocument, stats *ingestStats) ([]NewsItem, error) {
+	return app.extractSitemapEntries(rule, rule.sitemapEntries(doc, rule.sitemapCutoff(), stats), stats)
+}
+
+// sitemapEntries returns the URLs of the sitemap matching urlPattern and
+// modified after the cutoff, URLs without lastmod are kept
+func (rule *ParsingRule) sitemapEntries(doc *sitemapDocument, cutoff time.Time, stats *ingestStats) []sitemapEntry {
+	var entries []sitemapEntry
+	for _, u := range doc.URLs {
+		entry := sitemapEntry{
+			feedEntry: feedEntry{title: u.News.Title, link: strings.TrimSpace(u.Loc), published: u.News.PublicationDate},
+			modified:  parseISOTime(strings.TrimSpace(u.LastMod)),
+		}
+		if entry.modified == nil {
+			entry.modified = parseISOTime(strings.TrimSpace(u.News.PublicationDate))
+		}
+		if len(u.Images) > 0 {
+			entry.image = strings.TrimSpace(u.Images[0].Loc)
+		}
+		if (rule.urlPattern != nil && !rule.urlPattern.MatchString(entry.link)) ||
+			(entry.modified != nil && entry.modified.Before(cutoff)) {
+			// the entries kept are counted as matched by extractFeedNews
+			stats.matched++
+			stats.skippedFiltered++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// extractSitemapEntries keeps the maxSitemapURLs most recently modified
+// entries and turns them into items like the entries of a feed
+func (app *NewsApp) extractSitemapEntries(rule *ParsingRule, entries []sitemapEntry, stats *ingestStats) ([]NewsItem, error) {
+	// the newest first, URLs without lastmod last
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].modified, entries[j].modified
+		return a != nil && (b == nil || a.After(*b))
+	})
+	if len(entries) > maxSitemapURLs {
+		slog.Info("sitemap lists more URLs than are read", "source", rule.URL, "urls", len(entries), "limit", maxSitemapURLs)
+		stats.matched += len(entries) - maxSitemapURLs
+		stats.skippedFiltered += len(entries) - maxSitemapURLs
+		entries = entries[:maxSitemapURLs]
+	}
+	feedEntries := make([]feedEntry, len(entries))
+	for i, entry := range entries {
+		feedEntries[i] = entry.feedEntry
+	}
+	return app.extractFeedNews(rule, feedEntries, stats)
+}
+
+// fetchSitemap requests and parses a sitemap
+func (app *NewsApp) fetchSitemap(req *http.Request, rule *ParsingRule) (*sitemapDocument, error) {
+	resp, err := app.fetch(req, rule)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	doc, err := parseSitemap(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", req.URL, err)
+	}
+	return doc, nil
+}
+
+// parseSitemap reads a urlset or a sitemapindex, gzip-compressed sitemaps
+// are recognized by their content
+func parseSitemap(r io.Reader) (*sitemapDocument, error) {
+	body := bufio.NewReader(r)
+	r = body
+	if magic, err := body.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip sitemap: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	var doc sitemapDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid sitemap: %v", err)
+	}
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+		return &doc, nil
+	}
+	return nil, fmt.Errorf("unsupported sitemap root element <%s>", doc.XMLName.Local)
+}
@@ -0,0 +1,156 @@
+package aggregator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// maxSnapshotSize is the size of the HTML kept of a snapshot, the rest of a
+// larger page is dropped
+const maxSnapshotSize = 2 << 20
+
+const (
+	snapshotNoItems     = "no items"
+	snapshotEmptyFields = "items without a link or a title"
+)
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if room := b.max - b.Len(); len(data) > room {
+		b.Buffer.Write(data[:room])
+		b.truncated = true
+		return len(data), nil
+	}
+	return b.Buffer.Write(data)
+}
+
+// snapshotReason returns why the page of an update is saved, it is empty when
+// the extraction looks fine
+func snapshotReason(items []NewsItem, stats *ingestStats) string {
+	switch {
+	case len(items) == 0 && stats.skippedFiltered == 0:
+		return snapshotNoItems
+	case stats.skippedEmpty > 0:
+		return snapshotEmptyFields
+	}
+	return ""
+}
+
+// saveSnapshot stores the parsed page of the rule as the last snapshot of its
+// source, the page is what the expressions of the rule were evaluated on
+func (app *NewsApp) saveSnapshot(rule *ParsingRule, doc *html.Node, reason string) {
+	if app.db == nil {
+		return
+	}
+	page := limitedBuffer{max: maxSnapshotSize}
+	if err := html.Render(&page, doc); err != nil {
+		slog.Warn("unable to render snapshot", "source", rule.URL, "err", err)
+		return
+	}
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	writer.Write(page.Bytes())
+	if err := writer.Close(); err != nil {
+		slog.Warn("unable to compress snapshot", "source", rule.URL, "err", err)
+		return
+	}
+	// the previous snapshot of the source is replaced, the new one gets a new id
+	result, err := app.db.Exec(`INSERT OR REPLACE INTO snapshots(source_url, reason, size, truncated, body, fetched)
+		VALUES(?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		rule.URL, reason, page.Len(), page.truncated, body.Bytes())
+	if err != nil {
+		slog.Error("unable to save snapshot", "source", rule.URL, "err", err)
+		return
+	}
+	id, _ := result.LastInsertId()
+	slog.Info("saved snapshot of the page", "source", rule.URL, "snapshot", id, "reason", reason, "size", page.Len())
+}
+
+// loadSnapshot returns the page of the snapshot with the id
+func (app *NewsApp) loadSnapshot(ctx context.Context, id int64) (io.Reader, error) {
+	var body []byte
+	err := app.db.QueryRowContext(ctx, "SELECT body FROM snapshots WHERE id = ?", id).Scan(&body)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no snapshot %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot %d: %v", id, err)
+	}
+	return reader, nil
+}
+
+// pruneSnapshots deletes the snapshots older than -snapshotRetention
+func (app *NewsApp) pruneSnapshots() (int64, error) {
+	if app.config.SnapshotRetention <= 0 {
+		return 0, nil
+	}
+	result, err := app.db.Exec("DELETE FROM snapshots WHERE fetched < ?",
+		time.Now().Add(-app.config.SnapshotRetention).UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// snapshotHandler serves the last snapshot of the source. Its scripts must not
+// run with the origin of the API, so it is sandboxed.
+func (app *NewsApp) snapshotHandler(w http.ResponseWriter, r *http.Request, rule *ParsingRule) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var id int64
+	var reason string
+	var truncated bool
+	var body []byte
+	var fetched time.Time
+	err := retryOnBusy(r.Context(), func() error {
+		return app.db.QueryRowContext(r.Context(), "SELECT id, reason, truncated, body, fetched FROM snapshots WHERE source_url = ?", rule.URL).
+			Scan(&id, &reason, &truncated, &body, &fetched)
+	})
+	if err == sql.ErrNoRows {
+		http.Error(w, "the source has no snapshot", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid snapshot: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Snapshot-Id", strconv.FormatInt(id, 10))
+	w.Header().Set("X-Snapshot-Reason", reason)
+	w.Header().Set("X-Snapshot-Truncated", strconv.FormatBool(truncated))
+	w.Header().Set("Last-Modified", fetched.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, reader)
+}
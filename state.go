@@ -0,0 +1,74 @@
+package aggregator
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// itemStates are the states of an item set by POST /news/{id}/{state} and
+// cleared by DELETE, mapped to their columns in item_states
+var itemStates = map[string]string{"read": "read", "starred": "starred", "hidden": "hidden"}
+
+// itemStateColumn returns an expression of a state of the current news row for
+// the user, the id is formatted into the SQL since it comes from the database
+func itemStateColumn(column string, userID int64) string {
+	return fmt.Sprintf("EXISTS(SELECT 1 FROM item_states WHERE item_states.user_id = %d AND item_states.news_id = news.id AND item_states.%s = 1)", userID, column)
+}
+
+// starredByAnyone is true for the news rows starred by any user, such items
+// are kept by retention and compaction
+const starredByAnyone = "EXISTS(SELECT 1 FROM item_states WHERE item_states.news_id = news.id AND item_states.starred = 1)"
+
+// setItemState sets or clears a state of the item for the user of the request
+// and reports whether the item exists
+func (app *NewsApp) setItemState(r *http.Request, id int64, column string, value bool) (bool, error) {
+	result, err := app.db.ExecContext(r.Context(), `INSERT INTO item_states(user_id, news_id, `+column+`)
+		SELECT ?, id, ? FROM news WHERE id = ?
+		ON CONFLICT(user_id, news_id) DO UPDATE SET `+column+` = excluded.`+column+`, updated = CURRENT_TIMESTAMP`, requestUserID(r), value, id)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// itemStateHandler serves /news/{id}/read, /news/{id}/starred and
+// /news/{id}/hidden. POST sets the state, DELETE clears it and both return the
+// item.
+func (app *NewsApp) itemStateHandler(w http.ResponseWriter, r *http.Request, value, state string) {
+	column, ok := itemStates[state]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		http.Error(w, "the item id must be a number", http.StatusBadRequest)
+		return
+	}
+	if isReadOnly(r) {
+		http.Error(w, "read-only access", http.StatusForbidden)
+		return
+	}
+	var set bool
+	switch r.Method {
+	case http.MethodPost:
+		set = true
+	case http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	found, err := app.setItemState(r, id, column, set)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("no item with id %d", id), http.StatusNotFound)
+		return
+	}
+	app.itemHandler(w, r, value)
+}
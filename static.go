@@ -0,0 +1,26 @@
+package aggregator
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// staticFiles is the web client built into public, served unless -static
+// points at a directory
+//
+//go:embed public
+var staticFiles embed.FS
+
+// staticFileSystem returns the directory of -static, used while developing
+// the client, or the embedded files
+func (app *NewsApp) staticFileSystem() (http.FileSystem, error) {
+	if app.config.StaticDir != "" {
+		return http.Dir(app.config.StaticDir), nil
+	}
+	public, err := fs.Sub(staticFiles, "public")
+	if err != nil {
+		return nil, err
+	}
+	return http.FS(public), nil
+}
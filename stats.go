@@ -0,0 +1,98 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type cycleCounts struct {
+	time     time.Time
+	seen     int
+	inserted int
+}
+
+// dedupStats keeps the counts of seen and inserted items of recent update
+// cycles per source
+type dedupStats struct {
+	mu     sync.Mutex
+	cycles map[string][]cycleCounts
+}
+
+// SourceDedupStats are the rolling window counts of a source reported by /stats
+type SourceDedupStats struct {
+	URL        string `json:"url"`
+	Seen       int    `json:"seen"`
+	Inserted   int    `json:"inserted"`
+	Duplicates int    `json:"duplicates"`
+	// DuplicateRatio is the share of seen items that were already stored
+	DuplicateRatio float64 `json:"duplicateRatio"`
+}
+
+func (d *dedupStats) record(url string, stats *ingestStats, window time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cycles == nil {
+		d.cycles = make(map[string][]cycleCounts)
+	}
+	now := time.Now()
+	cycles := append(d.cycles[url], cycleCounts{
+		time:     now,
+		seen:     stats.inserted + stats.updated + stats.duplicates,
+		inserted: stats.inserted,
+	})
+	for len(cycles) > 0 && now.Sub(cycles[0].time) > window {
+		cycles = cycles[1:]
+	}
+	d.cycles[url] = cycles
+}
+
+func (d *dedupStats) report(url string, window time.Duration) SourceDedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := SourceDedupStats{URL: url}
+	now := time.Now()
+	for _, cycle := range d.cycles[url] {
+		if now.Sub(cycle.time) > window {
+			continue
+		}
+		result.Seen += cycle.seen
+		result.Inserted += cycle.inserted
+	}
+	result.Duplicates = result.Seen - result.Inserted
+	if result.Seen > 0 {
+		result.DuplicateRatio = float64(result.Duplicates) / float64(result.Seen)
+	}
+	return result
+}
+
+// Stats is the report of /stats
+type Stats struct {
+	Window  string             `json:"window"`
+	Sources []SourceDedupStats `json:"sources"`
+	Pruned  PruneStats         `json:"pruned"`
+}
+
+// stats returns the duplicate counts of every source within -statsWindow
+func (app *NewsApp) stats() Stats {
+	app.mu.Lock()
+	rules := app.parsingRules
+	app.mu.Unlock()
+	stats := Stats{Window: app.config.StatsWindow.String(), Sources: make([]SourceDedupStats, 0, len(rules)), Pruned: app.pruned.get()}
+	for _, rule := range rules {
+		stats.Sources = append(stats.Sources, app.dedup.report(rule.URL, app.config.StatsWindow))
+	}
+	return stats
+}
+
+func (app *NewsApp) statsHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(app.stats(), "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	fmt.Fprintf(w, "%s\n", data)
+}
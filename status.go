@@ -0,0 +1,295 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// sourceStatus is the fetch state of a single source
+type sourceStatus struct {
+	// SiteTitle is the title of the source page
+	SiteTitle   string     `json:"siteTitle,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	// LastItems is the number of items found by the last successful update
+	// and LastInserted the number of them that were new
+	LastItems     int        `json:"lastItems"`
+	LastInserted  int        `json:"lastInserted"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+	// ConsecutiveFailures counts the failed updates since the last success
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// NextRun is when the next update of the source is due
+	NextRun *time.Time `json:"nextRun,omitempty"`
+}
+
+// SourceStatus is the fetch state of a source reported by /sources
+type SourceStatus struct {
+	// ID identifies the source in /api/sources/{id}/stats
+	ID              string `json:"id"`
+	URL             string `json:"url"`
+	Name            string `json:"name"`
+	Category        string `json:"category,omitempty"`
+	IntervalMinutes uint   `json:"intervalMinutes,omitempty"`
+	Schedule        string `json:"schedule,omitempty"`
+	Enabled         bool   `json:"enabled"`
+	sourceStatus
+	// Healthy is false while the last fetch of the source failed
+	Healthy bool `json:"healthy"`
+	// Rule is the whole parsing rule, included only when asked with ?rules=true
+	Rule *ParsingRule `json:"rule,omitempty"`
+}
+
+type sourceStatuses struct {
+	mu       sync.Mutex
+	statuses map[string]*sourceStatus
+}
+
+func (s *sourceStatuses) get(url string) *sourceStatus {
+	if s.statuses == nil {
+		s.statuses = make(map[string]*sourceStatus)
+	}
+	status, ok := s.statuses[url]
+	if !ok {
+		status = &sourceStatus{}
+		s.statuses[url] = status
+	}
+	return status
+}
+
+// setSiteTitle stores the title and reports whether it was changed
+func (s *sourceStatuses) setSiteTitle(url, title string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.get(url)
+	if status.SiteTitle == title {
+		return false
+	}
+	status.SiteTitle = title
+	return true
+}
+
+func (s *sourceStatuses) success(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	status := s.get(url)
+	status.LastSuccess = &now
+	status.ConsecutiveFailures = 0
+}
+
+// stored records the number of items found and inserted by an update
+func (s *sourceStatuses) stored(url string, found, inserted int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.get(url)
+	status.LastItems = found
+	status.LastInserted = inserted
+}
+
+// scheduled records when the next update of the source is due
+func (s *sourceStatuses) scheduled(url string, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(url).NextRun = &next
+}
+
+func (s *sourceStatuses) failure(url string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	status := s.get(url)
+	status.LastError = err.Error()
+	status.LastErrorTime = &now
+	status.ConsecutiveFailures++
+}
+
+// report returns the status of a source forgetting errors older than maxErrorAge
+func (s *sourceStatuses) report(url string, maxErrorAge time.Duration) SourceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.get(url)
+	if status.LastErrorTime != nil && maxErrorAge > 0 && time.Since(*status.LastErrorTime) > maxErrorAge {
+		status.LastError = ""
+		status.LastErrorTime = nil
+	}
+	healthy := status.LastErrorTime == nil ||
+		(status.LastSuccess != nil && status.LastSuccess.After(*status.LastErrorTime))
+	return SourceStatus{URL: url, sourceStatus: *status, Healthy: healthy}
+}
+
+// sourceStatuses returns the status of every source, with its rule when
+// withRules is set
+func (app *NewsApp) sourceStatuses(withRules bool) []SourceStatus {
+	app.mu.Lock()
+	rules := app.parsingRules
+	app.mu.Unlock()
+	statuses := make([]SourceStatus, 0, len(rules))
+	for _, rule := range rules {
+		status := app.statuses.report(rule.URL, app.config.MaxErrorAge)
+		status.ID = rule.ID()
+		status.Name = rule.Source()
+		status.Category = rule.Category
+		status.IntervalMinutes = rule.Interval
+		status.Schedule = rule.Schedule
+		status.Enabled = rule.enabled()
+		if !status.Enabled {
+			status.NextRun = nil
+		}
+		if withRules {
+			status.Rule = rule
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (app *NewsApp) sourcesHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(app.sourceStatuses(r.FormValue("rules") == "true"), "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	fmt.Fprintf(w, "%s\n", data)
+}
+
+// SourceStats are the counters of a source reported by
+// /api/sources/{id}/stats. The items are counted in the database, the other
+// counters since the application started.
+type SourceStats struct {
+	ID                  string     `json:"id"`
+	URL                 string     `json:"url"`
+	Name                string     `json:"name"`
+	TotalItems          int64      `json:"totalItems"`
+	ItemsLastDay        int64      `json:"itemsLast24h"`
+	Inserted            uint64     `json:"inserted"`
+	Duplicates          uint64     `json:"duplicatesSkipped"`
+	Fetches             uint64     `json:"fetches"`
+	FetchErrors         uint64     `json:"fetchErrors"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	AverageFetchSeconds float64    `json:"averageFetchSeconds"`
+	AverageParseSeconds float64    `json:"averageParseSeconds"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// sourceHandler serves /api/sources/{id}/stats, /api/sources/{id}/refresh and
+// /api/sources/{id}/enable or disable, the id is the one listed by /sources
+func (app *NewsApp) sourceHandler(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/sources/"), "/")
+	if !ok || id == "" || (action != "stats" && action != "refresh" && action != "enable" && action != "disable" && action != "last-snapshot") {
+		http.NotFound(w, r)
+		return
+	}
+	app.mu.Lock()
+	var rule *ParsingRule
+	for _, candidate := range app.parsingRules {
+		if candidate.ID() == id {
+			rule = candidate
+			break
+		}
+	}
+	app.mu.Unlock()
+	if rule == nil {
+		http.Error(w, "unknown source", http.StatusNotFound)
+		return
+	}
+	switch action {
+	case "stats":
+		app.sourceStatsHandler(w, r, rule)
+	case "last-snapshot":
+		app.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			app.snapshotHandler(w, r, rule)
+		})(w, r)
+	case "refresh":
+		app.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			app.sourceRefreshHandler(w, r, rule)
+		})(w, r)
+	default:
+		app.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			app.sourceEnableHandler(w, r, rule.URL, action == "enable")
+		})(w, r)
+	}
+}
+
+// sourceStatsHandler serves /api/sources/{id}/stats
+func (app *NewsApp) sourceStatsHandler(w http.ResponseWriter, r *http.Request, rule *ParsingRule) {
+	stats, err := app.sourceStats(r.Context(), rule)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	writeRulesJSON(w, http.StatusOK, stats)
+}
+
+// sourceStats collects the counters of the source of the rule
+func (app *NewsApp) sourceStats(ctx context.Context, rule *ParsingRule) (*SourceStats, error) {
+	stats := &SourceStats{ID: rule.ID(), URL: rule.URL, Name: rule.Source()}
+	if err := app.countSourceItems(ctx, stats); err != nil {
+		return nil, err
+	}
+	app.metrics.sourceStats(rule.URL, stats)
+	status := app.statuses.report(rule.URL, app.config.MaxErrorAge)
+	stats.ConsecutiveFailures = status.ConsecutiveFailures
+	stats.LastSuccess = status.LastSuccess
+	stats.LastError = status.LastError
+	return stats, nil
+}
+
+// countSourceItems counts the stored items of the source and those stored
+// within the last day
+func (app *NewsApp) countSourceItems(ctx context.Context, stats *SourceStats) error {
+	defer app.metrics.observeQuery("count", time.Now())
+	err := app.db.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(CASE WHEN timestamp > datetime('now', '-1 day') THEN 1 END)
+		FROM news WHERE source = ?`, stats.Name).Scan(&stats.TotalItems, &stats.ItemsLastDay)
+	if err != nil {
+		return fmt.Errorf("error while counting the items of %s: %v", stats.Name, err)
+	}
+	return nil
+}
+
+// siteTitle returns the text of the <title> element of a page
+func siteTitle(doc *html.Node) string {
+	node := htmlquery.FindOne(doc, "//head/title")
+	if node == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(htmlquery.InnerText(node)), " ")
+}
+
+// updateSiteTitle remembers the title of a source and saves it when it changes
+func (app *NewsApp) updateSiteTitle(url, title string) {
+	if title == "" || !app.statuses.setSiteTitle(url, title) || app.db == nil {
+		return
+	}
+	_, err := app.db.Exec(`INSERT INTO sources(url, title) VALUES(?, ?)
+		ON CONFLICT(url) DO UPDATE SET title = excluded.title, updated = CURRENT_TIMESTAMP`, url, title)
+	if err != nil {
+		slog.Error("unable to save the site title", "source", url, "err", err)
+	}
+}
+
+func (app *NewsApp) loadSiteTitles() error {
+	rows, err := app.db.Query("SELECT url, title FROM sources")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var url, title string
+		if err := rows.Scan(&url, &title); err != nil {
+			return err
+		}
+		app.statuses.setSiteTitle(url, title)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup copies the main database of src to dst with the online backup API.
+// The pages are copied in a single step, which reads one consistent state
+// while writers go on in WAL mode.
+func Backup(ctx context.Context, dst, src *sql.DB) error {
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	return dstConn.Raw(func(dstDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			dstSQLite, ok := dstDriverConn.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("backups need SQLite connections")
+			}
+			backup, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// BackupFile writes a consistent copy of the database to a new file
+func BackupFile(ctx context.Context, db *sql.DB, filename string) error {
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("%s already exists", filename)
+	}
+	dst, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if err := Backup(ctx, dst, db); err != nil {
+		os.Remove(filename)
+		return fmt.Errorf("unable to back up the database: %v", err)
+	}
+	return nil
+}
+
+// Restore replaces the database file of dsn with the backup, the backup is
+// checked first so a broken file changes nothing
+func Restore(dsn, backup string) error {
+	if _, err := os.Stat(backup); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", "file:"+backup+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	var check string
+	if err := src.QueryRow("PRAGMA quick_check").Scan(&check); err != nil {
+		return fmt.Errorf("unable to check the backup: %v", err)
+	}
+	if check != "ok" {
+		return fmt.Errorf("the backup is damaged: %s", check)
+	}
+	dst, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	return Backup(context.Background(), dst, src)
+}
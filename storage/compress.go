@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Compress gzips a text for a compressed column, Decompress reads it back
+func Compress(text string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(text)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress reads a column stored by Compress, values stored as plain text
+// are returned as they are
+func Decompress(data []byte) (string, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return string(data), nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	text, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// decompress is Decompress as the SQL function decompress, NULL stays NULL
+func decompress(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case []byte:
+		if value == nil {
+			return nil, nil
+		}
+		return Decompress(value)
+	case string:
+		return Decompress([]byte(value))
+	}
+	return value, nil
+}
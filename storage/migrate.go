@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles are the schema changes named NNNN_description.sql, a file is
+// applied once in the order of its number. Released files are never edited,
+// a change of the schema is a new file.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func loadMigrations() ([]migration, error) {
+	names, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []migration
+	for _, entry := range names {
+		number, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with a version number", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version, entry.Name(), string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migrations[i-1].name, migrations[i].name)
+		}
+	}
+	return migrations, nil
+}
+
+// migrateDatabase applies the migrations newer than the version recorded in
+// schema_version, each one in its own transaction
+func migrateDatabase(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS 'schema_version' (
+		'version' INTEGER PRIMARY KEY,
+		'name' VARCHAR(255) NOT NULL,
+		'applied' DATETIME DEFAULT CURRENT_TIMESTAMP)`); err != nil {
+		return err
+	}
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		return fmt.Errorf("the database schema version %d is newer than %d supported by this build", current, latest)
+	}
+	if current == 0 {
+		if err := upgradeLegacySchema(db); err != nil {
+			return fmt.Errorf("unable to upgrade the database schema: %v", err)
+		}
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("unable to apply migration %s: %v", m.name, err)
+		}
+		slog.Info("applied database migration", "migration", m.name)
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version(version, name) VALUES(?, ?)", m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upgradeLegacySchema adds the columns that databases created before the
+// migrations may lack, the first migration then takes them over as they are
+func upgradeLegacySchema(db *sql.DB) error {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		tables[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	newColumns := []struct{ table, name, definition string }{
+		{"news", "metadata", "TEXT"},
+		{"news", "rule_version", "VARCHAR(16)"},
+		{"news", "published", "DATETIME"},
+		{"news", "seq", "INTEGER"},
+		{"news", "last_updated", "DATETIME"},
+		{"news", "source", "VARCHAR(255)"},
+		{"news", "summary", "TEXT"},
+		{"news", "image", "VARCHAR(1024)"},
+		{"news", "category", "VARCHAR(255)"},
+		{"news", "content", "TEXT"},
+		{"sources", "backfilled", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range newColumns {
+		// missing tables are created by the first migration with all columns
+		if !tables[column.table] {
+			continue
+		}
+		if err := addColumnIfMissing(db, column.table, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table created by an older version
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info('%s')", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			value      sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &value, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE '%s' ADD COLUMN '%s' %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,35 @@
+-- the schema as it was before versioned migrations, every statement is
+-- idempotent so databases created by older versions are taken over
+CREATE TABLE IF NOT EXISTS 'news' (
+	'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+	'link' VARCHAR(1024) UNIQUE NOT NULL,
+	'title' VARCHAR(1024) NOT NULL,
+	'timestamp' DATETIME DEFAULT CURRENT_TIMESTAMP,
+	'metadata' TEXT,
+	'rule_version' VARCHAR(16),
+	'published' DATETIME,
+	'seq' INTEGER,
+	'last_updated' DATETIME,
+	'source' VARCHAR(255),
+	'summary' TEXT,
+	'image' VARCHAR(1024),
+	'category' VARCHAR(255),
+	'content' TEXT);
+
+CREATE TABLE IF NOT EXISTS 'seen_links' (
+	'hash' INTEGER PRIMARY KEY);
+
+CREATE TABLE IF NOT EXISTS 'sources' (
+	'url' VARCHAR(1024) PRIMARY KEY,
+	'title' VARCHAR(1024) NOT NULL,
+	'updated' DATETIME DEFAULT CURRENT_TIMESTAMP,
+	'backfilled' INTEGER NOT NULL DEFAULT 0);
+
+UPDATE news SET seq = id WHERE seq IS NULL;
+UPDATE news SET last_updated = timestamp WHERE last_updated IS NULL;
+
+CREATE INDEX IF NOT EXISTS news_seq ON news(seq);
+CREATE INDEX IF NOT EXISTS news_source ON news(source);
+CREATE INDEX IF NOT EXISTS news_category ON news(category);
+CREATE INDEX IF NOT EXISTS news_timestamp ON news(timestamp);
+CREATE INDEX IF NOT EXISTS news_published ON news(COALESCE(published, timestamp));
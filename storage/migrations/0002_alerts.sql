@@ -0,0 +1,21 @@
+-- alerts notify a channel of new items whose titles match, deliveries are
+-- the queue of notifications still to be sent
+CREATE TABLE 'alerts' (
+	'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+	'name' VARCHAR(255) NOT NULL,
+	'contains' VARCHAR(1024),
+	'pattern' VARCHAR(1024),
+	'channel' VARCHAR(16) NOT NULL,
+	'target' VARCHAR(1024) NOT NULL,
+	'created' DATETIME DEFAULT CURRENT_TIMESTAMP);
+
+CREATE TABLE 'alert_deliveries' (
+	'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+	'alert_id' INTEGER NOT NULL,
+	'news_id' INTEGER NOT NULL,
+	'attempts' INTEGER NOT NULL DEFAULT 0,
+	'next_attempt' DATETIME DEFAULT CURRENT_TIMESTAMP,
+	'last_error' TEXT,
+	'created' DATETIME DEFAULT CURRENT_TIMESTAMP);
+
+CREATE INDEX alert_deliveries_next_attempt ON alert_deliveries(next_attempt);
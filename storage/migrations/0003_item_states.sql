@@ -0,0 +1,12 @@
+-- the reading state of items, an item without a row is unread, not starred
+-- and not hidden
+CREATE TABLE 'item_states' (
+	'news_id' INTEGER PRIMARY KEY,
+	'read' INTEGER NOT NULL DEFAULT 0,
+	'starred' INTEGER NOT NULL DEFAULT 0,
+	'hidden' INTEGER NOT NULL DEFAULT 0,
+	'updated' DATETIME DEFAULT CURRENT_TIMESTAMP);
+
+CREATE TRIGGER item_states_delete AFTER DELETE ON news BEGIN
+	DELETE FROM item_states WHERE news_id = old.id;
+END;
@@ -0,0 +1,43 @@
+-- users with their sessions and subscribed sources. The reading state gets a
+-- user, user 0 is the reader without an account as before.
+CREATE TABLE 'users' (
+	'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+	'name' VARCHAR(255) UNIQUE NOT NULL,
+	'password_hash' VARCHAR(255) NOT NULL,
+	'admin' INTEGER NOT NULL DEFAULT 0,
+	'created' DATETIME DEFAULT CURRENT_TIMESTAMP);
+
+CREATE TABLE 'sessions' (
+	'token_hash' VARCHAR(64) PRIMARY KEY,
+	'user_id' INTEGER NOT NULL,
+	'created' DATETIME DEFAULT CURRENT_TIMESTAMP,
+	'expires' DATETIME NOT NULL);
+
+CREATE TABLE 'subscriptions' (
+	'user_id' INTEGER NOT NULL,
+	'source' VARCHAR(255) NOT NULL,
+	PRIMARY KEY (user_id, source));
+
+CREATE TABLE 'item_states_by_user' (
+	'user_id' INTEGER NOT NULL DEFAULT 0,
+	'news_id' INTEGER NOT NULL,
+	'read' INTEGER NOT NULL DEFAULT 0,
+	'starred' INTEGER NOT NULL DEFAULT 0,
+	'hidden' INTEGER NOT NULL DEFAULT 0,
+	'updated' DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, news_id));
+
+INSERT INTO item_states_by_user(user_id, news_id, read, starred, hidden, updated)
+	SELECT 0, news_id, read, starred, hidden, updated FROM item_states;
+
+DROP TRIGGER item_states_delete;
+
+DROP TABLE item_states;
+
+ALTER TABLE item_states_by_user RENAME TO item_states;
+
+CREATE INDEX item_states_news ON item_states(news_id);
+
+CREATE TRIGGER item_states_delete AFTER DELETE ON news BEGIN
+	DELETE FROM item_states WHERE news_id = old.id;
+END;
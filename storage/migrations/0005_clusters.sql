@@ -0,0 +1,7 @@
+-- near-duplicate stories share a cluster, title_hash is the SimHash of the
+-- normalized title. An item with a NULL cluster_id heads its own cluster.
+ALTER TABLE news ADD COLUMN 'title_hash' INTEGER;
+
+ALTER TABLE news ADD COLUMN 'cluster_id' INTEGER;
+
+CREATE INDEX news_cluster ON news(COALESCE(cluster_id, id));
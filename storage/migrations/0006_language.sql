@@ -0,0 +1,4 @@
+-- the ISO 639-1 code of the language of the item, NULL when it is unknown
+ALTER TABLE news ADD COLUMN 'language' VARCHAR(8);
+
+CREATE INDEX news_language ON news(language);
@@ -0,0 +1,9 @@
+-- the last page of every source that gave no items or items without a link
+-- or a title, gzipped, for debugging its rule
+CREATE TABLE 'snapshots' (
+	'source_url' VARCHAR(1024) PRIMARY KEY,
+	'reason' VARCHAR(255) NOT NULL,
+	'size' INTEGER NOT NULL,
+	'truncated' INTEGER NOT NULL DEFAULT 0,
+	'body' BLOB NOT NULL,
+	'fetched' DATETIME DEFAULT CURRENT_TIMESTAMP);
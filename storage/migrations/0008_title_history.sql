@@ -0,0 +1,12 @@
+-- the previous titles of items whose titles changed after they were stored
+CREATE TABLE 'title_history' (
+	'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+	'news_id' INTEGER NOT NULL,
+	'title' VARCHAR(1024) NOT NULL,
+	'changed' DATETIME DEFAULT CURRENT_TIMESTAMP);
+
+CREATE INDEX title_history_news ON title_history(news_id);
+
+CREATE TRIGGER title_history_delete AFTER DELETE ON news BEGIN
+	DELETE FROM title_history WHERE news_id = old.id;
+END;
@@ -0,0 +1,17 @@
+-- snapshots get an id replays refer to, a new snapshot of a source replaces
+-- the row of the previous one and gets a new id
+CREATE TABLE 'snapshots_new' (
+	'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+	'source_url' VARCHAR(1024) NOT NULL UNIQUE,
+	'reason' VARCHAR(255) NOT NULL,
+	'size' INTEGER NOT NULL,
+	'truncated' INTEGER NOT NULL DEFAULT 0,
+	'body' BLOB NOT NULL,
+	'fetched' DATETIME DEFAULT CURRENT_TIMESTAMP);
+
+INSERT INTO snapshots_new(source_url, reason, size, truncated, body, fetched)
+	SELECT source_url, reason, size, truncated, body, fetched FROM snapshots;
+
+DROP TABLE snapshots;
+
+ALTER TABLE snapshots_new RENAME TO snapshots;
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var pragmaPattern = regexp.MustCompile(`(?i)^\s*(?:PRAGMA\s+)?([a-z_]+)\s*(?:=\s*([\w\-\.']+)|\(\s*([\w\-\.']+)\s*\))?\s*;?\s*$`)
+
+// defaultPragmas let readers work while an update writes and make a
+// connection wait for a lock instead of failing at once, -pragma overrides them
+var defaultPragmas = []string{"journal_mode=WAL", "busy_timeout=5000"}
+
+// parsePragma validates a pragma statement, "PRAGMA" may be omitted, and
+// returns it in the canonical form
+func parsePragma(statement string) (string, error) {
+	match := pragmaPattern.FindStringSubmatch(statement)
+	if match == nil {
+		return "", fmt.Errorf("%q is not a pragma statement", statement)
+	}
+	value := match[2]
+	if value == "" {
+		value = match[3]
+	}
+	if value == "" {
+		return "PRAGMA " + match[1], nil
+	}
+	return "PRAGMA " + match[1] + " = " + value, nil
+}
+
+// withDefaultPragmas prepends the default pragmas not set by the given ones
+func withDefaultPragmas(pragmas []string) []string {
+	set := make(map[string]bool)
+	for _, pragma := range pragmas {
+		if match := pragmaPattern.FindStringSubmatch(pragma); match != nil {
+			set[strings.ToLower(match[1])] = true
+		}
+	}
+	var result []string
+	for _, pragma := range defaultPragmas {
+		if match := pragmaPattern.FindStringSubmatch(pragma); !set[match[1]] {
+			result = append(result, pragma)
+		}
+	}
+	return append(result, pragmas...)
+}
+
+// sqliteDriverName returns the name of a driver applying the pragmas to every
+// new connection, connections of a pool do not share pragmas. Every
+// connection also gets the functions used by the queries.
+func sqliteDriverName(pragmas []string) (string, error) {
+	statements := make([]string, len(pragmas))
+	for i, pragma := range pragmas {
+		statement, err := parsePragma(pragma)
+		if err != nil {
+			return "", err
+		}
+		statements[i] = statement
+	}
+	name := "sqlite3_news"
+	if len(statements) > 0 {
+		name += "_pragmas_" + strings.Join(statements, ";")
+	}
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return name, nil
+		}
+	}
+	sql.Register(name, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("fold", FoldCase, true); err != nil {
+				return fmt.Errorf("unable to register fold: %v", err)
+			}
+			if err := conn.RegisterFunc("decompress", decompress, true); err != nil {
+				return fmt.Errorf("unable to register decompress: %v", err)
+			}
+			for _, statement := range statements {
+				if _, err := conn.Exec(statement, nil); err != nil {
+					return fmt.Errorf("%s failed: %v", statement, err)
+				}
+			}
+			return nil
+		},
+	})
+	return name, nil
+}
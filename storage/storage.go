@@ -0,0 +1,43 @@
+// Package storage opens the SQLite database of the news, keeps its schema up
+// to date and backs it up
+package storage
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Open opens the SQLite database file of dsn with the pragmas, on top of the
+// default ones, run on every connection and migrates its schema
+func Open(dsn string, pragmas []string) (*sql.DB, error) {
+	driver, err := sqliteDriverName(withDefaultPragmas(pragmas))
+	if err != nil {
+		return nil, err
+	}
+	// writers take the lock when their transaction begins, a deferred
+	// transaction upgrading from a read would fail instead of waiting
+	db, err := sql.Open(driver, withDSNParam(dsn, "_txlock=immediate"))
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateDatabase(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// FoldCase maps a text to the form compared by the title search, it is
+// registered as the SQL function fold because lower of SQLite handles only
+// ASCII letters
+func FoldCase(text string) string {
+	return strings.ToLower(text)
+}
+
+// withDSNParam appends a driver parameter to a database file name
+func withDSNParam(dsn, param string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param
+	}
+	return dsn + "?" + param
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePragma(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      string
+		valid     bool
+	}{
+		{"synchronous=NORMAL", "PRAGMA synchronous = NORMAL", true},
+		{"PRAGMA cache_size(-2000);", "PRAGMA cache_size = -2000", true},
+		{"optimize", "PRAGMA optimize", true},
+		{"synchronous=NORMAL; DROP TABLE news", "", false},
+	}
+	for _, test := range tests {
+		got, err := parsePragma(test.statement)
+		if (err == nil) != test.valid || got != test.want {
+			t.Errorf("parsePragma(%q) = %q, %v", test.statement, got, err)
+		}
+	}
+}
+
+func TestOpenBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(filepath.Join(dir, "news.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO news(link, title) VALUES('https://example.com/a', 'A')"); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, "backup.db")
+	if err := BackupFile(context.Background(), db, backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := BackupFile(context.Background(), db, backup); err == nil {
+		t.Error("BackupFile overwrote an existing file")
+	}
+	restored := filepath.Join(dir, "restored.db")
+	if err := Restore(restored, backup); err != nil {
+		t.Fatal(err)
+	}
+	restoredDB, err := Open(restored, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restoredDB.Close()
+	var count int
+	if err := restoredDB.QueryRow("SELECT COUNT(*) FROM news").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d restored items, want 1", count)
+	}
+}
@@ -0,0 +1,122 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const streamHeartbeat = 30 * time.Second
+
+// newsHub wakes the streaming clients when new items are stored
+type newsHub struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func (h *newsHub) subscribe() chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan struct{}]struct{})
+	}
+	ch := make(chan struct{}, 1)
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (h *newsHub) unsubscribe(ch chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+}
+
+// notify wakes every subscriber, a subscriber that was not woken up yet is
+// not blocked on
+func (h *newsHub) notify() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// streamHandler pushes items stored from now on, or after the seq given by
+// the Last-Event-ID header or the since parameter, as server-sent events. The
+// items can be filtered like on /news/ and every event has the seq of its item
+// as the id, so a reconnecting EventSource resumes where it stopped. At most
+// maxSearchLimit of the newest items are sent at once.
+func (app *NewsApp) streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := newsFilterFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.OrderBy = ""
+	filter.Limit = maxSearchLimit
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if filter.Since, err = strconv.ParseInt(id, 10, 64); err != nil {
+			http.Error(w, "Last-Event-ID must be a seq", http.StatusBadRequest)
+			return
+		}
+	} else if r.Form.Get("since") == "" {
+		if err := app.db.QueryRowContext(r.Context(), "SELECT COALESCE(MAX(seq), 0) FROM news").Scan(&filter.Since); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+	}
+	updates := app.hub.subscribe()
+	defer app.hub.unsubscribe(updates)
+	w.Header().Set("Content-type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		items, err := app.getNews(r.Context(), filter)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+			flusher.Flush()
+			return
+		}
+		// the newest items come first
+		for i := len(items) - 1; i >= 0; i-- {
+			data, err := json.Marshal(items[i])
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: news\ndata: %s\n\n", items[i].Seq, data)
+			filter.Since = items[i].Seq
+		}
+		flusher.Flush()
+		for wait := true; wait; {
+			select {
+			case <-updates:
+				wait = false
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-app.ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// telegramPollTimeout is how long a getUpdates request waits for messages
+	telegramPollTimeout = 30 * time.Second
+	// telegramRetryDelay is the wait after a failed getUpdates
+	telegramRetryDelay = 10 * time.Second
+	// botDefaultItems and botMaxItems are the numbers of items answered to
+	// /latest and /search by default and at most
+	botDefaultItems = 10
+	botMaxItems     = 20
+)
+
+const botHelp = `/latest [n] - the newest items
+/search <query> - items matching the query, e.g. golang -rust
+/subscribe <keyword> - send new items whose titles contain the keyword
+/unsubscribe <keyword> - stop sending the items of the keyword
+/subscriptions - the keywords of this chat`
+
+// telegramUpdate is a message received by the bot
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// runTelegramBot answers the commands sent to the bot of -telegramToken until
+// the context is done. Subscriptions are telegram alerts of the chat.
+func (app *NewsApp) runTelegramBot(ctx context.Context) {
+	slog.Info("telegram bot started")
+	var offset int64
+	for {
+		updates, err := app.telegramUpdates(ctx, offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("unable to receive telegram messages", "err", err)
+			select {
+			case <-time.After(telegramRetryDelay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || update.Message.Text == "" {
+				continue
+			}
+			chat := strconv.FormatInt(update.Message.Chat.ID, 10)
+			if len(app.config.TelegramChats) > 0 && !slices.Contains(app.config.TelegramChats, chat) {
+				slog.Warn("telegram message from a chat not in -telegramChats", "chat", chat)
+				continue
+			}
+			reply := app.botCommand(ctx, chat, update.Message.Text)
+			if reply == "" {
+				continue
+			}
+			sendCtx, cancel := context.WithTimeout(ctx, alertTimeout)
+			if err := app.sendTelegramMessage(sendCtx, chat, reply); err != nil {
+				slog.Warn("unable to answer telegram message", "chat", chat, "err", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// telegramUpdates waits for the messages after the offset
+func (app *NewsApp) telegramUpdates(ctx context.Context, offset int64) ([]telegramUpdate, error) {
+	ctx, cancel := context.WithTimeout(ctx, telegramPollTimeout+alertTimeout)
+	defer cancel()
+	query := url.Values{
+		"offset":          {strconv.FormatInt(offset, 10)},
+		"timeout":         {strconv.Itoa(int(telegramPollTimeout / time.Second))},
+		"allowed_updates": {`["message"]`},
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/getUpdates?%s", telegramAPI, app.config.TelegramToken, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, app.redactTelegram(err)
+	}
+	resp, err := app.client.Do(req)
+	if err != nil {
+		return nil, app.redactTelegram(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		OK          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []telegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("telegram: %s: %v", resp.Status, err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("telegram: %s: %s", resp.Status, result.Description)
+	}
+	return result.Result, nil
+}
+
+// redactTelegram removes the bot token, which is part of the URLs, from an
+// error
+func (app *NewsApp) redactTelegram(err error) error {
+	return fmt.Errorf("telegram: %s", strings.ReplaceAll(err.Error(), app.config.TelegramToken, "***"))
+}
+
+// botCommand runs a command of the chat and returns the answer, empty for
+// messages that are not commands
+func (app *NewsApp) botCommand(ctx context.Context, chat, text string) string {
+	command, argument, _ := strings.Cut(strings.TrimSpace(text), " ")
+	if !strings.HasPrefix(command, "/") {
+		return ""
+	}
+	// commands in groups are addressed as /latest@bot
+	command, _, _ = strings.Cut(command, "@")
+	argument = strings.TrimSpace(argument)
+	switch command {
+	case "/start", "/help":
+		return botHelp
+	case "/latest":
+		limit := botDefaultItems
+		if argument != "" {
+			n, err := strconv.Atoi(argument)
+			if err != nil || n < 1 {
+				return "usage: /latest [n]"
+			}
+			limit = min(n, botMaxItems)
+		}
+		return app.botNews(ctx, NewsFilter{Limit: limit}, "no items yet")
+	case "/search":
+		if argument == "" {
+			return "usage: /search <query>"
+		}
+		return app.botNews(ctx, NewsFilter{Query: argument, OrderBy: "relevance", Limit: botDefaultItems}, "nothing found")
+	case "/subscribe":
+		if argument == "" {
+			return "usage: /subscribe <keyword>"
+		}
+		if app.chatAlert(chat, argument) != nil {
+			return fmt.Sprintf("already subscribed to %q", argument)
+		}
+		alert := &Alert{Name: argument, Contains: argument, Channel: alertChannelTelegram, Target: chat}
+		if err := app.addAlert(ctx, alert); err != nil {
+			slog.Error("unable to add telegram subscription", "chat", chat, "err", err)
+			return "unable to subscribe: " + err.Error()
+		}
+		return fmt.Sprintf("subscribed to %q", argument)
+	case "/unsubscribe":
+		alert := app.chatAlert(chat, argument)
+		if alert == nil {
+			return fmt.Sprintf("not subscribed to %q", argument)
+		}
+		if err := app.deleteAlert(ctx, alert.ID); err != nil {
+			slog.Error("unable to remove telegram subscription", "chat", chat, "err", err)
+			return "unable to unsubscribe: " + err.Error()
+		}
+		return fmt.Sprintf("unsubscribed from %q", argument)
+	case "/subscriptions":
+		var keywords []string
+		for _, alert := range app.alerts.list() {
+			if alert.Channel == alertChannelTelegram && alert.Target == chat {
+				keywords = append(keywords, alert.Contains)
+			}
+		}
+		if len(keywords) == 0 {
+			return "no subscriptions, add one with /subscribe <keyword>"
+		}
+		return strings.Join(keywords, "\n")
+	}
+	return "unknown command\n\n" + botHelp
+}
+
+// botNews lists the items of the filter, or answers empty when there are none
+func (app *NewsApp) botNews(ctx context.Context, filter NewsFilter, empty string) string {
+	items, err := app.getNews(ctx, filter)
+	if err != nil {
+		slog.Error("unable to read news for telegram", "err", err)
+		return "unable to read the news: " + err.Error()
+	}
+	if len(items) == 0 {
+		return empty
+	}
+	text := alertText(items)
+	if len(text) > telegramMaxLength {
+		text = truncateText(text, telegramMaxLength)
+	}
+	return text
+}
+
+// chatAlert returns the telegram alert of the chat for the keyword, ignoring
+// case
+func (app *NewsApp) chatAlert(chat, keyword string) *Alert {
+	for _, alert := range app.alerts.list() {
+		if alert.Channel == alertChannelTelegram && alert.Target == chat && foldCase(alert.Contains) == foldCase(keyword) {
+			return alert
+		}
+	}
+	return nil
+}
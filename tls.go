@@ -0,0 +1,54 @@
+package aggregator
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultAutocertCache is the default of -autocertCache
+const defaultAutocertCache = "./autocert"
+
+// tlsEnabled reports whether the API is served over HTTPS
+func (app *NewsApp) tlsEnabled() bool {
+	return app.config.TLSCert != "" || len(app.config.AutocertHosts) > 0
+}
+
+// configureTLS sets the certificates of the server, read from -tlsCert and
+// -tlsKey or obtained from Let's Encrypt for -autocertHosts, and returns the
+// handler of the plain HTTP listener
+func (app *NewsApp) configureTLS(server *http.Server) (http.Handler, error) {
+	if len(app.config.AutocertHosts) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(app.config.AutocertHosts...),
+			Cache:      autocert.DirCache(app.config.AutocertCache),
+		}
+		server.TLSConfig = manager.TLSConfig()
+		// the listener answers the HTTP-01 challenges and redirects the rest
+		return manager.HTTPHandler(http.HandlerFunc(app.redirectToHTTPS)), nil
+	}
+	cert, err := tls.LoadX509KeyPair(app.config.TLSCert, app.config.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("error while loading the TLS certificate: %v", err)
+	}
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	return http.HandlerFunc(app.redirectToHTTPS), nil
+}
+
+// redirectToHTTPS redirects a plain HTTP request to the same URL on the
+// HTTPS port
+func (app *NewsApp) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if app.port != 443 {
+		host = net.JoinHostPort(host, strconv.FormatUint(uint64(app.port), 10))
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
@@ -0,0 +1,92 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cleonty/news-aggregator/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingShutdownTimeout limits sending the spans still buffered on exit
+const tracingShutdownTimeout = 5 * time.Second
+
+// tracer starts the spans of the application, they are dropped unless
+// -otlpEndpoint sets up an exporter
+var tracer = otel.Tracer("github.com/cleonty/news-aggregator")
+
+// setupTracing exports the spans to the OTLP/gRPC collector of -otlpEndpoint
+// and propagates the trace context in W3C headers. The returned function
+// flushes the spans, it does nothing without an endpoint.
+func (app *NewsApp) setupTracing(ctx context.Context) (func(), error) {
+	if app.config.OTLPEndpoint == "" {
+		return func() {}, nil
+	}
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(app.config.OTLPEndpoint)}
+	if app.config.OTLPInsecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the OTLP exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("news-aggregator"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	slog.Info("exporting traces", "endpoint", app.config.OTLPEndpoint)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Warn("unable to flush traces", "err", err)
+		}
+	}, nil
+}
+
+// endSpan records the error of the traced operation and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ruleAttributes identify the source of the spans of an update
+func ruleAttributes(rule *ParsingRule) trace.SpanStartOption {
+	return trace.WithAttributes(attribute.String("source.url", rule.URL), attribute.String("source.name", rule.Source()))
+}
+
+// traceRequests continues the trace of the caller of the route and records
+// the status of the response
+func traceRequests(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.HTTPRoute(route), semconv.URLPath(r.URL.Path)))
+		defer span.End()
+		rec := &server.StatusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.Status))
+		if rec.Status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status))
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package aggregator
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// TransformFunc modifies an extracted item. Returning false drops the item.
+type TransformFunc func(item *NewsItem) (*NewsItem, bool)
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]TransformFunc{
+		"trim":      trimTransform,
+		"strip-utm": stripUTMTransform,
+	}
+)
+
+// RegisterTransform makes a transform available to parsing rules under the
+// name. Registering a transform with an existing name replaces it.
+func RegisterTransform(name string, fn func(*NewsItem) (*NewsItem, bool)) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	transforms[name] = fn
+}
+
+func lookupTransform(name string) (TransformFunc, error) {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	fn, ok := transforms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown transform %q", name)
+	}
+	return fn, nil
+}
+
+// applyTransforms runs the named transforms in order, it returns false when
+// one of them drops the item
+func applyTransforms(item *NewsItem, names []string) (*NewsItem, bool, error) {
+	for _, name := range names {
+		fn, err := lookupTransform(name)
+		if err != nil {
+			return nil, false, err
+		}
+		var keep bool
+		if item, keep = fn(item); !keep {
+			return nil, false, nil
+		}
+	}
+	return item, true, nil
+}
+
+// trimTransform trims the link and collapses whitespace in the title and
+// the summary
+func trimTransform(item *NewsItem) (*NewsItem, bool) {
+	item.Link = strings.TrimSpace(item.Link)
+	item.Title = collapseSpace(item.Title)
+	item.Summary = collapseSpace(item.Summary)
+	return item, true
+}
+
+// collapseSpace trims the text and replaces runs of whitespace with one space
+func collapseSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// stripUTMTransform removes utm_* query parameters from the link
+func stripUTMTransform(item *NewsItem) (*NewsItem, bool) {
+	item.Link = stripQueryParams(item.Link, []string{"utm_*"})
+	return item, true
+}
+
+// stripQueryParams removes the named query parameters from the link ignoring
+// case, a name ending with * removes every parameter with the prefix
+func stripQueryParams(link string, names []string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	query := u.Query()
+	for param := range query {
+		if matchesParam(param, names) {
+			query.Del(param)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// matchesParam tells whether the query parameter is one of the names ignoring
+// case, a name ending with * matches every parameter with the prefix
+func matchesParam(param string, names []string) bool {
+	lower := strings.ToLower(param)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if lower == name || strings.HasSuffix(name, "*") && strings.HasPrefix(lower, strings.TrimSuffix(name, "*")) {
+			return true
+		}
+	}
+	return false
+}
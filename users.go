@@ -0,0 +1,374 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionLifetime    = 30 * 24 * time.Hour
+	passwordIterations = 600000
+	minPasswordLength  = 8
+)
+
+// User is an account with its own reading state and subscriptions
+type User struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Admin   bool      `json:"admin,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// pbkdf2SHA256 derives a key of keyLen bytes from the password as in RFC 8018
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	var counter [4]byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], block)
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// hashPassword returns pbkdf2-sha256$iterations$salt$hash with a random salt
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := pbkdf2SHA256([]byte(password), salt, passwordIterations, sha256.Size)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+func checkPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, pbkdf2SHA256([]byte(password), salt, iterations, len(hash))) == 1
+}
+
+// tokenHash is stored instead of the session token
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadUsers tells requireAuth whether there are users to authenticate
+func (app *NewsApp) loadUsers() error {
+	var count int64
+	if err := app.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return err
+	}
+	app.hasUsers.Store(count > 0)
+	return nil
+}
+
+// sessionUser returns the user of an unexpired session, nil when there is none
+func (app *NewsApp) sessionUser(ctx context.Context, token string) (*User, error) {
+	user := new(User)
+	var expires time.Time
+	err := app.db.QueryRowContext(ctx, `SELECT users.id, users.name, users.admin, users.created, sessions.expires
+		FROM sessions JOIN users ON users.id = sessions.user_id WHERE sessions.token_hash = ?`, tokenHash(token)).
+		Scan(&user.ID, &user.Name, &user.Admin, &user.Created, &expires)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(expires) {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// loginHandler exchanges {"name": ..., "password": ...} for a session token
+// which is sent as a bearer token or the token parameter
+func (app *NewsApp) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var credentials struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		http.Error(w, fmt.Sprintf("error while reading the credentials: %v", err), http.StatusBadRequest)
+		return
+	}
+	user := new(User)
+	var passwordHash string
+	err := app.db.QueryRowContext(r.Context(), "SELECT id, name, admin, created, password_hash FROM users WHERE name = ?", credentials.Name).
+		Scan(&user.ID, &user.Name, &user.Admin, &user.Created, &passwordHash)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if err == sql.ErrNoRows || !checkPassword(passwordHash, credentials.Password) {
+		http.Error(w, "invalid name or password", http.StatusUnauthorized)
+		return
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(secret)
+	now := time.Now().UTC()
+	expires := now.Add(sessionLifetime)
+	if _, err := app.db.ExecContext(r.Context(), "DELETE FROM sessions WHERE expires < ?", now); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if _, err := app.db.ExecContext(r.Context(), "INSERT INTO sessions(token_hash, user_id, expires) VALUES(?, ?, ?)",
+		tokenHash(token), user.ID, expires); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	writeRulesJSON(w, http.StatusOK, struct {
+		Token   string    `json:"token"`
+		Expires time.Time `json:"expires"`
+		User    *User     `json:"user"`
+	}{token, expires, user})
+}
+
+// logoutHandler ends the session of the token
+func (app *NewsApp) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := requestToken(r)
+	if token == "" {
+		http.Error(w, "no session token", http.StatusBadRequest)
+		return
+	}
+	if _, err := app.db.ExecContext(r.Context(), "DELETE FROM sessions WHERE token_hash = ?", tokenHash(token)); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *NewsApp) listUsers(ctx context.Context) ([]User, error) {
+	rows, err := app.db.QueryContext(ctx, "SELECT id, name, admin, created FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]User, 0)
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Admin, &user.Created); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// usersHandler lists, creates and deletes the users. The first user is an
+// administrator, so a server without an API key is not left without one.
+func (app *NewsApp) usersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := app.listUsers(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeRulesJSON(w, http.StatusOK, users)
+	case http.MethodPost:
+		var account struct {
+			Name     string `json:"name"`
+			Password string `json:"password"`
+			Admin    bool   `json:"admin"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+			http.Error(w, fmt.Sprintf("error while reading the user: %v", err), http.StatusBadRequest)
+			return
+		}
+		account.Name = strings.TrimSpace(account.Name)
+		if account.Name == "" {
+			http.Error(w, "name is empty", http.StatusBadRequest)
+			return
+		}
+		if len(account.Password) < minPasswordLength {
+			http.Error(w, fmt.Sprintf("password must have at least %d characters", minPasswordLength), http.StatusBadRequest)
+			return
+		}
+		passwordHash, err := hashPassword(account.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		user := &User{Name: account.Name, Admin: account.Admin || !app.hasUsers.Load()}
+		err = app.db.QueryRowContext(r.Context(), "INSERT INTO users(name, password_hash, admin) VALUES(?, ?, ?) RETURNING id, created",
+			user.Name, passwordHash, user.Admin).Scan(&user.ID, &user.Created)
+		if isUniqueError(err) {
+			http.Error(w, fmt.Sprintf("user %q already exists", user.Name), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		app.hasUsers.Store(true)
+		writeRulesJSON(w, http.StatusCreated, user)
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "id must be the number of a user", http.StatusBadRequest)
+			return
+		}
+		found, err := app.deleteUser(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("no user with id %d", id), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// deleteUser deletes the user with the sessions, subscriptions and item state
+func (app *NewsApp) deleteUser(ctx context.Context, id int64) (bool, error) {
+	tx, err := app.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"sessions", "subscriptions", "item_states"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ?", id); err != nil {
+			return false, err
+		}
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 0 {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, app.loadUsers()
+}
+
+func (app *NewsApp) subscriptions(ctx context.Context, userID int64) ([]string, error) {
+	rows, err := app.db.QueryContext(ctx, "SELECT source FROM subscriptions WHERE user_id = ? ORDER BY source", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sources := make([]string, 0)
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// subscriptionsHandler lists the sources the user subscribed to, POST and
+// DELETE with ?source= subscribe and unsubscribe. A user without
+// subscriptions gets the items of all sources.
+func (app *NewsApp) subscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	source := r.URL.Query().Get("source")
+	if r.Method != http.MethodGet && isReadOnly(r) {
+		http.Error(w, "read-only access", http.StatusForbidden)
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !app.isKnownSource(source) {
+			http.Error(w, fmt.Sprintf("unknown source %q", source), http.StatusBadRequest)
+			return
+		}
+		_, err = app.db.ExecContext(r.Context(), "INSERT OR IGNORE INTO subscriptions(user_id, source) VALUES(?, ?)", userID, source)
+	case http.MethodDelete:
+		_, err = app.db.ExecContext(r.Context(), "DELETE FROM subscriptions WHERE user_id = ? AND source = ?", userID, source)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	sources, err := app.subscriptions(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	writeRulesJSON(w, http.StatusOK, sources)
+}
+
+// isKnownSource tells whether a parsing rule has the source
+func (app *NewsApp) isKnownSource(source string) bool {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	for _, rule := range app.parsingRules {
+		if source != "" && rule.Source() == source {
+			return true
+		}
+	}
+	return false
+}
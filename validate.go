@@ -0,0 +1,232 @@
+package aggregator
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/http/httpguts"
+)
+
+// validateParsingRules checks every rule and returns one error listing all
+// problems, so a broken rules file is reported before any updater starts
+func validateParsingRules(rules []*ParsingRule) error {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		for _, problem := range rule.validate() {
+			problems = append(problems, fmt.Sprintf("rule %d (%s): %s", i+1, rule.URL, problem))
+		}
+		if seen[rule.URL] {
+			problems = append(problems, fmt.Sprintf("rule %d (%s): duplicate url", i+1, rule.URL))
+		}
+		seen[rule.URL] = true
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid parsing rules:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// validate returns the problems of the rule
+func (rule *ParsingRule) validate() []string {
+	var problems []string
+	if rule.URL == "" {
+		problems = append(problems, "url is empty")
+	} else if u, err := url.Parse(rule.URL); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid url: %v", err))
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "url must be an absolute http or https url")
+	}
+	if rule.Interval == 0 && rule.Schedule == "" {
+		problems = append(problems, "intervalMinutes must be positive or a schedule given")
+	} else if rule.Interval > 0 && rule.Schedule != "" {
+		problems = append(problems, "intervalMinutes and schedule are exclusive")
+	} else if rule.Schedule != "" {
+		if _, err := parseCron(rule.Schedule); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid schedule: %v", err))
+		}
+	}
+	for _, name := range rule.Transforms {
+		if _, err := lookupTransform(name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	switch rule.Render {
+	case "":
+	case renderChromium:
+		if rule.Type != "" && rule.Type != ruleTypeHTML {
+			problems = append(problems, "render applies only to html rules")
+		}
+		if (rule.Method != "" && !strings.EqualFold(rule.Method, "GET")) || rule.Body != "" {
+			problems = append(problems, "render only loads pages with GET requests without a body")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown render %q, expected chromium", rule.Render))
+	}
+	// the keys are queried with metaKey, which can not contain a quote
+	for _, name := range sortedRuleNames(rule.MetadataRules) {
+		if strings.Contains(name, `"`) {
+			problems = append(problems, fmt.Sprintf("metadataRules key %q must not contain a double quote", name))
+		}
+	}
+	if rule.Language != "" && !languagePattern.MatchString(rule.Language) {
+		problems = append(problems, fmt.Sprintf("language %q must be a lowercase ISO 639-1 code such as en", rule.Language))
+	}
+	for _, patterns := range [][]string{rule.IncludePatterns, rule.ExcludePatterns} {
+		if _, err := newPatternMatcher(patterns); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	problems = append(problems, rule.validateCredentials()...)
+	problems = append(problems, rule.validateTransforms()...)
+	if rule.URLPattern != "" {
+		if rule.Type != ruleTypeSitemap {
+			problems = append(problems, "urlPattern applies only to sitemap rules")
+		} else if _, err := regexp.Compile(rule.URLPattern); err != nil {
+			problems = append(problems, fmt.Sprintf("urlPattern %q does not compile: %v", rule.URLPattern, err))
+		}
+	}
+	if rule.MaxAgeHours > 0 && rule.Type != ruleTypeSitemap {
+		problems = append(problems, "maxAgeHours applies only to sitemap rules")
+	}
+	if rule.NextPageRule != nil && rule.Type != "" && rule.Type != ruleTypeHTML {
+		problems = append(problems, "nextPageRule applies only to html rules")
+	}
+	if rule.MaxPages > 0 && rule.NextPageRule == nil {
+		problems = append(problems, "maxPages needs a nextPageRule")
+	}
+	switch rule.Type {
+	case "", ruleTypeHTML:
+		problems = append(problems, rule.validateExpressions()...)
+	case ruleTypeJSON:
+		problems = append(problems, rule.validateJSONPaths()...)
+	case ruleTypeRSS, ruleTypeSitemap:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown type %q", rule.Type))
+	}
+	return problems
+}
+
+// validateCredentials checks the headers, cookies, basic authentication and
+// proxy of the rule
+func (rule *ParsingRule) validateCredentials() []string {
+	var problems []string
+	for _, name := range sortedKeys(rule.Headers) {
+		if !httpguts.ValidHeaderFieldName(name) {
+			problems = append(problems, fmt.Sprintf("invalid header name %q", name))
+		} else if !httpguts.ValidHeaderFieldValue(rule.Headers[name]) {
+			problems = append(problems, fmt.Sprintf("invalid value of header %s", name))
+		}
+	}
+	for _, name := range sortedKeys(rule.Cookies) {
+		if !httpguts.ValidHeaderFieldName(name) {
+			problems = append(problems, fmt.Sprintf("invalid cookie name %q", name))
+		}
+	}
+	if rule.BasicAuth != nil && (rule.BasicAuth.Username == "" || strings.Contains(rule.BasicAuth.Username, ":")) {
+		problems = append(problems, "basicAuth.username must be set and may not contain a colon")
+	}
+	if rule.Proxy != "" && rule.Proxy != proxyDirect {
+		if u, err := parseProxy(rule.Proxy); err != nil {
+			problems = append(problems, err.Error())
+		} else if u.User != nil && rule.Render == renderChromium {
+			problems = append(problems, "render does not support proxy credentials")
+		}
+	}
+	if rule.Render == renderChromium && (len(rule.Headers) > 0 || len(rule.Cookies) > 0 || rule.BasicAuth != nil) {
+		problems = append(problems, "headers, cookies and basicAuth are not sent by render")
+	}
+	return problems
+}
+
+// validateExpressions compiles the XPath expressions of an html rule
+func (rule *ParsingRule) validateExpressions() []string {
+	var problems []string
+	check := func(field, expr string, required bool) {
+		if expr == "" {
+			if required {
+				problems = append(problems, field+" is empty")
+			}
+			return
+		}
+		if _, err := xpath.Compile(expr); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q does not compile: %v", field, expr, err))
+		}
+	}
+	checkSelector := func(field, selector string) {
+		if _, err := cssToXPath(selector); err != nil {
+			problems = append(problems, fmt.Sprintf("%s does not compile: %v", field, err))
+		}
+	}
+	var checkRule func(field string, extract *ExtractRule)
+	checkRule = func(field string, extract *ExtractRule) {
+		if extract.Selector != "" {
+			checkSelector(field+".selector", extract.Selector)
+		} else {
+			// a rule may give only alternatives
+			check(field+".expr", extract.XPathExpr, len(extract.Alternatives) == 0)
+		}
+		for i := range extract.Alternatives {
+			checkRule(fmt.Sprintf("%s.alternatives[%d]", field, i), &extract.Alternatives[i])
+		}
+	}
+	if rule.NewsNodesSelector != "" {
+		checkSelector("newsNodesSelector", rule.NewsNodesSelector)
+	} else {
+		check("newsNodesExpr", rule.NewsNodesXPathExpr, true)
+	}
+	checkRule("linkRule", &rule.LinkRule)
+	if !rule.PageMetadata || !rule.TitleRule.isEmpty() {
+		checkRule("titleRule", &rule.TitleRule)
+	}
+	if rule.SummaryRule != nil {
+		checkRule("summaryRule", rule.SummaryRule)
+	}
+	if rule.DateRule != nil {
+		checkRule("dateRule", rule.DateRule)
+	}
+	if rule.ImageRule != nil {
+		checkRule("imageRule", rule.ImageRule)
+	}
+	if rule.ContentRule != nil {
+		checkRule("contentRule", rule.ContentRule)
+	}
+	if rule.NextPageRule != nil {
+		checkRule("nextPageRule", rule.NextPageRule)
+	}
+	if rule.Pairing != nil {
+		check("pairing.titleNodesExpr", rule.Pairing.TitleNodesXPathExpr, true)
+		check("pairing.linkNodesExpr", rule.Pairing.LinkNodesXPathExpr, true)
+	}
+	for _, field := range sortedRuleNames(rule.MetadataRules) {
+		extract := rule.MetadataRules[field]
+		checkRule("metadataRules."+field, &extract)
+	}
+	for _, field := range sortedRuleNames(rule.DetailRules) {
+		extract := rule.DetailRules[field]
+		checkRule("detailRules."+field, &extract)
+	}
+	return problems
+}
+
+func sortedRuleNames(rules map[string]ExtractRule) []string {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
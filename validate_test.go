@@ -0,0 +1,59 @@
+package aggregator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAlternatives(t *testing.T) {
+	tests := []struct {
+		name      string
+		titleRule ExtractRule
+		problem   string
+	}{
+		{"expression", ExtractRule{XPathExpr: "a"}, ""},
+		{"expression and alternatives", ExtractRule{XPathExpr: "h2", Alternatives: []ExtractRule{{XPathExpr: "a"}}}, ""},
+		{"only alternatives", ExtractRule{Alternatives: []ExtractRule{{XPathExpr: "h2"}, {Selector: "a"}}}, ""},
+		{"neither", ExtractRule{}, "titleRule.expr is empty"},
+		{"empty alternative", ExtractRule{Alternatives: []ExtractRule{{}}}, "titleRule.alternatives[0].expr is empty"},
+		{"invalid alternative", ExtractRule{Alternatives: []ExtractRule{{XPathExpr: "a["}}}, "titleRule.alternatives[0].expr"},
+	}
+	for _, test := range tests {
+		rule := &ParsingRule{
+			URL:                "https://example.com/",
+			Interval:           30,
+			NewsNodesXPathExpr: `//div[@class="news"]`,
+			LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+			TitleRule:          test.titleRule,
+		}
+		problems := strings.Join(rule.validate(), "; ")
+		if test.problem == "" && problems != "" || !strings.Contains(problems, test.problem) {
+			t.Errorf("%s: got problems %q, want %q", test.name, problems, test.problem)
+		}
+	}
+}
+
+func TestValidateMetadataKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem bool
+	}{
+		{"author", false},
+		{"dc.creator", false},
+		{`au"thor`, true},
+	}
+	for _, test := range tests {
+		rule := &ParsingRule{
+			URL:                "https://example.com/",
+			Interval:           30,
+			NewsNodesXPathExpr: `//div[@class="news"]`,
+			LinkRule:           ExtractRule{XPathExpr: "a", Attribute: "href"},
+			TitleRule:          ExtractRule{XPathExpr: "a"},
+			MetadataRules:      map[string]ExtractRule{test.name: {XPathExpr: "span"}},
+		}
+		problems := strings.Join(rule.validate(), "; ")
+		if got := strings.Contains(problems, "double quote"); got != test.problem {
+			t.Errorf("%s: got problems %q", test.name, problems)
+		}
+	}
+}
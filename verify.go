@@ -0,0 +1,57 @@
+package aggregator
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	linkCheckTimeout  = 10 * time.Second
+	linkCheckInterval = 200 * time.Millisecond
+	linkCacheSize     = 10000
+)
+
+// linkVerifier checks with HEAD requests that links are not dead. Requests are
+// serialized and spaced by linkCheckInterval, results are cached.
+type linkVerifier struct {
+	mu     sync.Mutex
+	client *http.Client
+	alive  map[string]bool
+	last   time.Time
+}
+
+func (v *linkVerifier) isAlive(link string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if alive, ok := v.alive[link]; ok {
+		return alive
+	}
+	if v.client == nil {
+		v.client = &http.Client{Timeout: linkCheckTimeout}
+	}
+	if wait := linkCheckInterval - time.Since(v.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	v.last = time.Now()
+	resp, err := v.client.Head(link)
+	if err != nil {
+		// network errors may be transient so they are not cached
+		slog.Warn("unable to verify link", "link", link, "err", err)
+		return false
+	}
+	resp.Body.Close()
+	// some servers do not implement HEAD, such links are not considered dead
+	alive := resp.StatusCode < 400 ||
+		resp.StatusCode == http.StatusMethodNotAllowed ||
+		resp.StatusCode == http.StatusNotImplemented
+	if !alive {
+		slog.Info("skipping dead link", "link", link, "status", resp.Status)
+	}
+	if v.alive == nil || len(v.alive) >= linkCacheSize {
+		v.alive = make(map[string]bool)
+	}
+	v.alive[link] = alive
+	return alive
+}
@@ -0,0 +1,45 @@
+package aggregator
+
+import (
+	"fmt"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// xpathPanic is raised by find and findOne when an expression can not be
+// compiled or evaluated
+type xpathPanic struct {
+	expr  string
+	cause interface{}
+}
+
+func annotateXPathPanic(expr string) {
+	if r := recover(); r != nil {
+		panic(xpathPanic{expr: expr, cause: r})
+	}
+}
+
+func find(top *html.Node, expr string) []*html.Node {
+	defer annotateXPathPanic(expr)
+	return htmlquery.Find(top, expr)
+}
+
+func findOne(top *html.Node, expr string) *html.Node {
+	defer annotateXPathPanic(expr)
+	return htmlquery.FindOne(top, expr)
+}
+
+// recoverXPathPanic converts a panic raised by find or findOne into an error
+// of the rule. Other panics are not recovered.
+func recoverXPathPanic(rule *ParsingRule, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	p, ok := r.(xpathPanic)
+	if !ok {
+		panic(r)
+	}
+	*err = fmt.Errorf("rule %s: XPath expression %q failed: %v", rule.URL, p.expr, p.cause)
+}